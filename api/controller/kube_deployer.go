@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -22,16 +25,26 @@ type KubeReq struct {
 
 type KubeDeployer struct {
 	requestStore map[string]KubeReq
+
+	// deployedStore 保存部署成功的请求，用于检查漂移
+	mu            sync.Mutex
+	deployedStore map[string]KubeReq
 }
 
 func NewKubeDeployer() *KubeDeployer {
 	return &KubeDeployer{
-		requestStore: make(map[string]KubeReq),
+		requestStore:  make(map[string]KubeReq),
+		deployedStore: make(map[string]KubeReq),
 	}
 }
 
 func (deployer *KubeDeployer) Submit(c *gin.Context) {
+	// 默认开启的选项在绑定前设置，未传入时保持开启，传入 false 时关闭
 	var req KubeReq
+	req.KubeOptions.ServiceOptions.Enabled = true
+	req.KubeOptions.IngressOptions.Enabled = true
+	req.KubeOptions.ServiceAccountOptions.Enabled = true
+	req.KubeOptions.Prune = true
 	if err := c.ShouldBind(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"msg": err.Error(),
@@ -43,15 +56,21 @@ func (deployer *KubeDeployer) Submit(c *gin.Context) {
 	helpers.SetDefault(&req.DockerOptions.Dockerfile, "./Dockerfile")
 	helpers.SetDefault(&req.DockerOptions.Registry, docker.DOCKERHUB)
 	helpers.SetDefault(&req.DockerOptions.Tag, "latest")
+	helpers.SetDefault(&req.DockerOptions.TagStrategy, docker.TagStrategyExplicit)
 	helpers.SetDefault(&req.KubeOptions.Kubeconfig, "~/.kube/config")
+	helpers.SetDefault(&req.KubeOptions.Workload, kube.WorkloadDeployment)
+	helpers.SetDefault(&req.KubeOptions.FailurePolicy, cmd.FailurePolicyContinue)
 	helpers.SetDefault(&req.KubeOptions.IngressOptions.TLS, false)
 	helpers.SetDefault(&req.KubeOptions.IngressOptions.SelfSigned, false)
 	helpers.SetDefault(&req.KubeOptions.IngressOptions.SelfSignedYears, 1)
+	helpers.SetDefault(&req.KubeOptions.IngressOptions.Controller, kube.IngressControllerNginx)
 	helpers.SetDefault(&req.KubeOptions.ServiceOptions.Port, int32(8000))
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.Replicas, int32(1))
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.Port, int32(8000))
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.RollingUpdate.MaxSurge, "1")
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.RollingUpdate.MaxUnavailable, "0")
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.Strategy, kube.UpdateStrategyRollingUpdate)
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.ImagePullPolicy, kube.PullPolicyIfNotPresent)
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.LivenessProbe.Enabled, false)
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.LivenessProbe.Type, kube.ProbeTypeHTTPGet)
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.LivenessProbe.Path, "/")
@@ -70,15 +89,40 @@ func (deployer *KubeDeployer) Submit(c *gin.Context) {
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.ReadinessProbe.PeriodSeconds, int32(10))
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.ReadinessProbe.SuccessThreshold, int32(1))
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.ReadinessProbe.FailureThreshold, int32(3))
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.Enabled, false)
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.Type, kube.ProbeTypeHTTPGet)
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.Path, "/")
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.Scheme, "http")
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.InitialDelaySeconds, int32(0))
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.TimeoutSeconds, int32(1))
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.PeriodSeconds, int32(10))
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.SuccessThreshold, int32(1))
+	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.StartupProbe.FailureThreshold, int32(3))
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.VolumeMount.Enabled, false)
 	helpers.SetDefault(&req.KubeOptions.DeploymentOptions.VolumeMount.MountPath, "/app/data")
+	helpers.SetDefault(&req.KubeOptions.StatefulSetOptions.PodManagementPolicy, kube.PodManagementPolicyOrderedReady)
+	helpers.SetDefault(&req.KubeOptions.DaemonSetOptions.HostNetwork, false)
 	helpers.SetDefault(&req.KubeOptions.HpaOptions.Enabled, false)
 	helpers.SetDefault(&req.KubeOptions.HpaOptions.MinReplicas, int32(1))
 	helpers.SetDefault(&req.KubeOptions.HpaOptions.MaxReplicas, int32(10))
 	helpers.SetDefault(&req.KubeOptions.HpaOptions.CPURate, int32(50))
+	helpers.SetDefault(&req.KubeOptions.Metrics.Enabled, false)
+	helpers.SetDefault(&req.KubeOptions.Metrics.Path, "/metrics")
+	helpers.SetDefault(&req.KubeOptions.Metrics.Scheme, "http")
 	helpers.SetDefault(&req.KubeOptions.PvcOptions.AccessMode, "readwriteonce")
 	helpers.SetDefault(&req.KubeOptions.PvcOptions.StorageClassName, "openebs-hostpath")
 	helpers.SetDefault(&req.KubeOptions.PvcOptions.StorageSize, "1G")
+	helpers.SetDefault(&req.KubeOptions.PvcOptions.RetentionPolicy, kube.RetentionPolicyRetain)
+	helpers.SetDefault(&req.KubeOptions.ResourceQuota.Enabled, false)
+	helpers.SetDefault(&req.KubeOptions.LimitRange.Enabled, false)
+	helpers.SetDefault(&req.KubeOptions.HookOptions.PreDeploy.ActiveDeadlineSeconds, int64(600))
+	helpers.SetDefault(&req.KubeOptions.HookOptions.PreDeploy.TTLSecondsAfterFinished, int32(600))
+	helpers.SetDefault(&req.KubeOptions.HookOptions.PostDeploy.ActiveDeadlineSeconds, int64(600))
+	helpers.SetDefault(&req.KubeOptions.HookOptions.PostDeploy.TTLSecondsAfterFinished, int32(600))
+	helpers.SetDefault(&req.KubeOptions.Canary.Enabled, false)
+	helpers.SetDefault(&req.KubeOptions.Canary.Steps, []int32{5, 25, 50, 100})
+	helpers.SetDefault(&req.KubeOptions.Canary.PauseSeconds, int32(60))
+	helpers.SetDefault(&req.KubeOptions.Canary.Replicas, int32(1))
 
 	requestID := fmt.Sprintf("%d", time.Now().UnixNano())
 	deployer.requestStore[requestID] = req
@@ -113,6 +157,10 @@ func (deployer *KubeDeployer) Deploy(c *gin.Context) {
 			logCh <- msg
 		}); err != nil {
 			logCh <- err.Error()
+		} else {
+			deployer.mu.Lock()
+			deployer.deployedStore[requestID] = req
+			deployer.mu.Unlock()
 		}
 		logCh <- "Done"
 		close(logCh)
@@ -127,3 +175,70 @@ func (deployer *KubeDeployer) Deploy(c *gin.Context) {
 		flusher.Flush()
 	}
 }
+
+// Drift 报告已部署请求的应用在 appdeployer 之外被修改的字段，reapply=true 时恢复为最近一次部署的内容
+func (deployer *KubeDeployer) Drift(c *gin.Context) {
+	requestID := c.Query("requestID")
+	deployer.mu.Lock()
+	req, ok := deployer.deployedStore[requestID]
+	deployer.mu.Unlock()
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"msg": "No deployed requestID found, call kube/deploy first",
+		})
+		return
+	}
+
+	var logs []string
+	drifts, err := cmd.KubeDrift(&req.DefaultOptions, &req.KubeOptions, c.Query("reapply") == "true", func(msg string) {
+		fmt.Println(msg)
+		logs = append(logs, msg)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"msg": err.Error(),
+		})
+		return
+	}
+
+	fields := make([]string, 0, len(drifts))
+	for _, drift := range drifts {
+		fields = append(fields, drift.String())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"drifts": fields,
+		"logs":   logs,
+	})
+}
+
+// WatchDrift 每隔 interval 检查一次所有已部署请求的漂移并记录到日志，直到 ctx 结束
+func (deployer *KubeDeployer) WatchDrift(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deployer.mu.Lock()
+		requests := make(map[string]KubeReq, len(deployer.deployedStore))
+		for requestID, req := range deployer.deployedStore {
+			requests[requestID] = req
+		}
+		deployer.mu.Unlock()
+
+		for requestID, req := range requests {
+			drifts, err := cmd.KubeDrift(&req.DefaultOptions, &req.KubeOptions, false, func(msg string) {})
+			if err != nil {
+				log.Printf("drift check of request %s failed: %v", requestID, err)
+				continue
+			}
+			for _, drift := range drifts {
+				log.Printf("drift of request %s: %s", requestID, drift)
+			}
+		}
+	}
+}
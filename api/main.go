@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -15,6 +16,9 @@ import (
 )
 
 func main() {
+	driftInterval := flag.Duration("drift-interval", 0, "Interval to check the deployed apps for changes made outside appdeployer, 0 to disable")
+	flag.Parse()
+
 	// db := service.NewAppDeployerDB("test.db")
 	// db.Migrate()
 
@@ -35,6 +39,7 @@ func main() {
 
 	r.POST("/kube/submit", kubeDeployer.Submit)
 	r.GET("/kube/deploy", kubeDeployer.Deploy)
+	r.GET("/kube/drift", kubeDeployer.Drift)
 
 	r.POST("/vm/submit", vmDeployer.Submit)
 	r.GET("/vm/deploy", vmDeployer.Deploy)
@@ -44,6 +49,12 @@ func main() {
 		Handler: r,
 	}
 
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	if *driftInterval > 0 {
+		go kubeDeployer.WatchDrift(watchCtx, *driftInterval)
+	}
+
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("listen: %s\n", err)
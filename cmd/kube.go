@@ -3,6 +3,9 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/guobinqiu/appdeployer/docker"
 	"github.com/guobinqiu/appdeployer/git"
@@ -10,22 +13,56 @@ import (
 	"github.com/guobinqiu/appdeployer/kube"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/rest"
 )
 
 type KubeOptions struct {
-	Kubeconfig        string                 `form:"kubeconfig" json:"kubeconfig"`
-	Namespace         string                 `form:"namespace" json:"namespace"`
-	IngressOptions    kube.IngressOptions    `form:"ingress" json:"ingress"`
-	ServiceOptions    kube.ServiceOptions    `form:"service" json:"service"`
-	DeploymentOptions kube.DeploymentOptions `form:"deployment" json:"deployment"`
-	HpaOptions        kube.HPAOptions        `form:"hpa" json:"hpa"`
-	PvcOptions        kube.PVCOptions        `form:"pvc" json:"pvc"`
+	Kubeconfig            string                     `form:"kubeconfig" json:"kubeconfig"`
+	KubeconfigData        string                     `form:"kubeconfigdata" json:"kubeconfigdata"`
+	Context               string                     `form:"context" json:"context"`
+	Token                 string                     `form:"token" json:"token"`
+	Namespace             string                     `form:"namespace" json:"namespace"`
+	Workload              string                     `form:"workload" json:"workload"`
+	IngressOptions        kube.IngressOptions        `form:"ingress" json:"ingress"`
+	Routing               string                     `form:"routing" json:"routing"`
+	RouteOptions          kube.RouteOptions          `form:"route" json:"route"`
+	ServiceOptions        kube.ServiceOptions        `form:"service" json:"service"`
+	DeploymentOptions     kube.DeploymentOptions     `form:"deployment" json:"deployment"`
+	StatefulSetOptions    kube.StatefulSetOptions    `form:"statefulset" json:"statefulset"`
+	DaemonSetOptions      kube.DaemonSetOptions      `form:"daemonset" json:"daemonset"`
+	Canary                kube.CanaryOptions         `form:"canary" json:"canary"`
+	HpaOptions            kube.HPAOptions            `form:"hpa" json:"hpa"`
+	Metrics               kube.MetricsOptions        `form:"metrics" json:"metrics"`
+	PvcOptions            kube.PVCOptions            `form:"pvc" json:"pvc"`
+	ResourceQuota         kube.ResourceQuotaOptions  `form:"resourcequota" json:"resourcequota"`
+	LimitRange            kube.LimitRangeOptions     `form:"limitrange" json:"limitrange"`
+	HookOptions           kube.HookOptions           `form:"hooks" json:"hooks"`
+	PullSecrets           kube.PullSecretOptions     `form:"pullsecrets" json:"pullsecrets"`
+	ServiceAccountOptions kube.ServiceAccountOptions `form:"serviceaccount" json:"serviceaccount"`
+	ConfirmDataLoss       bool                       `form:"confirmdataloss" json:"confirmdataloss"`
+	PlanOnly              bool                       `form:"planonly" json:"planonly"`
+	SkipPreflight         bool                       `form:"skippreflight" json:"skippreflight"`
+	Adopt                 bool                       `form:"adopt" json:"adopt"`
+	Prune                 bool                       `form:"prune" json:"prune"`
+	Clusters              []ClusterOptions           `form:"clusters" json:"clusters"`
+	Parallelism           int                        `form:"parallelism" json:"parallelism"`
+	FailurePolicy         string                     `form:"failurepolicy" json:"failurepolicy"`
 }
 
+// rolloutTimeout bounds how long post-deploy hooks wait for the workload to become ready
+const rolloutTimeout = 10 * time.Minute
+
 var dockerOptions docker.DockerOptions
 var kubeOptions KubeOptions
+var volumeSpecs []string
+var clusterSpecs []string
+var registrySpecs []string
+var routeBackendSpecs []string
+var canaryStepSpecs []string
+var canaryQuerySpecs []string
 
 func init() {
 	// set default values
@@ -33,42 +70,58 @@ func init() {
 	viper.SetDefault("docker.dockerfile", "./Dockerfile")
 	viper.SetDefault("docker.registry", docker.DOCKERHUB)
 	viper.SetDefault("docker.tag", "latest")
+	viper.SetDefault("docker.tagstrategy", docker.TagStrategyExplicit)
 	viper.SetDefault("kube.kubeconfig", "~/.kube/config")
+	viper.SetDefault("kube.workload", kube.WorkloadDeployment)
+	viper.SetDefault("kube.parallelism", 0)
+	viper.SetDefault("kube.failurepolicy", FailurePolicyContinue)
+	viper.SetDefault("kube.prune", true)
+	viper.SetDefault("kube.ingress.enabled", true)
 	viper.SetDefault("kube.ingress.tls", false)
 	viper.SetDefault("kube.ingress.selfsigned", false)
 	viper.SetDefault("kube.ingress.selfsignedyears", 1)
+	viper.SetDefault("kube.ingress.controller", kube.IngressControllerNginx)
+	viper.SetDefault("kube.routing", kube.RoutingIngress)
+	viper.SetDefault("kube.route.kind", kube.RouteKindHTTP)
+	viper.SetDefault("kube.service.enabled", true)
 	viper.SetDefault("kube.service.port", 8000)
+	viper.SetDefault("kube.serviceaccount.enabled", true)
 	viper.SetDefault("kube.deployment.replicas", 1)
 	viper.SetDefault("kube.deployment.port", 8000)
 	viper.SetDefault("kube.deployment.rollingupdate.maxsurge", "1")
 	viper.SetDefault("kube.deployment.rollingupdate.maxunavailable", "0")
-	viper.SetDefault("kube.deployment.livenessprobe.enabled", false)
-	viper.SetDefault("kube.deployment.livenessprobe.type", kube.ProbeTypeHTTPGet)
-	viper.SetDefault("kube.deployment.livenessprobe.path", "/")
-	viper.SetDefault("kube.deployment.livenessprobe.scheme", "http")
-	viper.SetDefault("kube.deployment.livenessprobe.initialdelayseconds", 0)
-	viper.SetDefault("kube.deployment.livenessprobe.timeoutseconds", 1)
-	viper.SetDefault("kube.deployment.livenessprobe.periodseconds", 10)
-	viper.SetDefault("kube.deployment.livenessprobe.successthreshold", 1)
-	viper.SetDefault("kube.deployment.livenessprobe.failurethreshold", 3)
-	viper.SetDefault("kube.deployment.readinessprobe.enabled", false)
-	viper.SetDefault("kube.deployment.readinessprobe.type", kube.ProbeTypeHTTPGet)
-	viper.SetDefault("kube.deployment.readinessprobe.path", "/")
-	viper.SetDefault("kube.deployment.readinessprobe.scheme", "http")
-	viper.SetDefault("kube.deployment.readinessprobe.initialdelayseconds", 0)
-	viper.SetDefault("kube.deployment.readinessprobe.timeoutseconds", 1)
-	viper.SetDefault("kube.deployment.readinessprobe.periodseconds", 10)
-	viper.SetDefault("kube.deployment.readinessprobe.successthreshold", 1)
-	viper.SetDefault("kube.deployment.readinessprobe.failurethreshold", 3)
+	viper.SetDefault("kube.deployment.strategy", kube.UpdateStrategyRollingUpdate)
+	viper.SetDefault("kube.deployment.imagepullpolicy", kube.PullPolicyIfNotPresent)
 	viper.SetDefault("kube.deployment.volumemount.enabled", false)
 	viper.SetDefault("kube.deployment.volumemount.mountpath", "/app/data")
+	viper.SetDefault("kube.statefulset.podmanagementpolicy", kube.PodManagementPolicyOrderedReady)
+	viper.SetDefault("kube.daemonset.hostnetwork", false)
 	viper.SetDefault("kube.hpa.enabled", false)
 	viper.SetDefault("kube.hpa.minreplicas", 1)
 	viper.SetDefault("kube.hpa.maxreplicas", 10)
 	viper.SetDefault("kube.hpa.cpurate", 50)
+	viper.SetDefault("kube.metrics.enabled", false)
+	viper.SetDefault("kube.metrics.path", "/metrics")
+	viper.SetDefault("kube.metrics.scheme", "http")
 	viper.SetDefault("kube.pvc.accessmode", "readwriteonce")
 	viper.SetDefault("kube.pvc.storageclassname", "openebs-hostpath")
 	viper.SetDefault("kube.pvc.storagesize", "1Gi")
+	viper.SetDefault("kube.pvc.retentionpolicy", kube.RetentionPolicyRetain)
+	viper.SetDefault("kube.resourcequota.enabled", false)
+	viper.SetDefault("kube.limitrange.enabled", false)
+	viper.SetDefault("kube.hooks.predeploy.enabled", false)
+	viper.SetDefault("kube.hooks.predeploy.backofflimit", 0)
+	viper.SetDefault("kube.hooks.predeploy.activedeadlineseconds", 600)
+	viper.SetDefault("kube.hooks.predeploy.ttlsecondsafterfinished", 600)
+	viper.SetDefault("kube.hooks.postdeploy.enabled", false)
+	viper.SetDefault("kube.hooks.postdeploy.backofflimit", 0)
+	viper.SetDefault("kube.hooks.postdeploy.activedeadlineseconds", 600)
+	viper.SetDefault("kube.hooks.postdeploy.ttlsecondsafterfinished", 600)
+	viper.SetDefault("kube.hooks.rollback", false)
+	viper.SetDefault("kube.canary.enabled", false)
+	viper.SetDefault("kube.canary.steps", []string{"5", "25", "50", "100"})
+	viper.SetDefault("kube.canary.pauseseconds", 60)
+	viper.SetDefault("kube.canary.replicas", 1)
 
 	// docker
 	kubeCmd.Flags().StringVar(&dockerOptions.Dockerconfig, "docker.dockerconfig", viper.GetString("docker.dockerconfig"), "Path to docker configuration. Defaults to ~/.docker/config.json")
@@ -77,62 +130,215 @@ func init() {
 	kubeCmd.Flags().StringVar(&dockerOptions.Username, "docker.username", viper.GetString("docker.username"), "Username for docker registry")
 	kubeCmd.Flags().StringVar(&dockerOptions.Password, "docker.password", viper.GetString("docker.password"), "Password for docker registry")
 	kubeCmd.Flags().StringVar(&dockerOptions.Repository, "docker.repository", viper.GetString("docker.repository"), "Repository for docker registry")
-	kubeCmd.Flags().StringVar(&dockerOptions.Tag, "docker.tag", viper.GetString("docker.tag"), "Tag for docker registry. Defaults to latest")
+	kubeCmd.Flags().StringVar(&dockerOptions.Tag, "docker.tag", viper.GetString("docker.tag"), "Tag for docker registry, used by the explicit tag strategy. Defaults to latest")
+	kubeCmd.Flags().StringVar(&dockerOptions.TagStrategy, "docker.tagstrategy", viper.GetString("docker.tagstrategy"), "How the image is tagged. Such as explicit (docker.tag), gitsha (commit of appdir), timestamp and semver (version tag of appdir HEAD). Defaults to explicit")
 
 	//kube
-	kubeCmd.Flags().StringVar(&kubeOptions.Kubeconfig, "kube.kubeconfig", viper.GetString("kube.kubeconfig"), "Path to kubernetes configuration. Defaults to ~/.kube/config")
-	kubeCmd.Flags().StringVar(&kubeOptions.Namespace, "kube.namespace", viper.GetString("kube.namespace"), "Namespace for app resources. Defaults to appname")
+	kubeCmd.PersistentFlags().StringVar(&kubeOptions.Kubeconfig, "kube.kubeconfig", viper.GetString("kube.kubeconfig"), "Path to kubernetes configuration. Defaults to ~/.kube/config")
+	kubeCmd.PersistentFlags().StringVar(&kubeOptions.KubeconfigData, "kube.kubeconfigdata", viper.GetString("kube.kubeconfigdata"), "Content of kubernetes configuration, plain or base64 encoded. Takes precedence over kube.kubeconfig")
+	kubeCmd.PersistentFlags().StringVar(&kubeOptions.Context, "kube.context", viper.GetString("kube.context"), "Context of kubernetes configuration to use. Defaults to current-context")
+	kubeCmd.PersistentFlags().StringVar(&kubeOptions.Token, "kube.token", viper.GetString("kube.token"), "Bearer token overriding the credentials of kubernetes configuration")
+	kubeCmd.PersistentFlags().StringVar(&kubeOptions.Namespace, "kube.namespace", viper.GetString("kube.namespace"), "Namespace for app resources. Defaults to appname")
+	kubeCmd.Flags().StringArrayVar(&clusterSpecs, "kube.clusters", nil, "Deploy to several clusters in the form of name=prod,context=prod,replicas=3,ingresshost=app.com,storageclassname=ssd. Kubeconfig can also be set per cluster")
+	kubeCmd.Flags().IntVar(&kubeOptions.Parallelism, "kube.parallelism", viper.GetInt("kube.parallelism"), "Number of clusters deployed to at the same time. Defaults to 0, all at once")
+	kubeCmd.Flags().StringVar(&kubeOptions.FailurePolicy, "kube.failurepolicy", viper.GetString("kube.failurepolicy"), "What to do with clusters not yet started when one fails. Such as continue and failfast. Defaults to continue")
+	kubeCmd.Flags().StringVar(&kubeOptions.Workload, "kube.workload", viper.GetString("kube.workload"), "Kind of workload running app pods. Such as deployment, statefulset and daemonset. Defaults to deployment")
+	kubeCmd.Flags().BoolVar(&kubeOptions.IngressOptions.Enabled, "kube.ingress.enabled", viper.GetBool("kube.ingress.enabled"), "Enable or disable the ingress exposing the app outside the cluster. Defaults to true")
 	kubeCmd.Flags().StringVar(&kubeOptions.IngressOptions.Host, "kube.ingress.host", viper.GetString("kube.ingress.host"), "Host for app ingress. Defaults to appName.com")
 	kubeCmd.Flags().BoolVar(&kubeOptions.IngressOptions.TLS, "kube.ingress.tls", viper.GetBool("kube.ingress.tls"), "Enable or disable TLS for app host. Defaults to false")
 	kubeCmd.Flags().BoolVar(&kubeOptions.IngressOptions.SelfSigned, "kube.ingress.selfsigned", viper.GetBool("kube.ingress.selfsigned"), "Enable or disable self-signed certificate. Defaults to false")
 	kubeCmd.Flags().IntVar(&kubeOptions.IngressOptions.SelfSignedYears, "kube.ingress.selfsignedyears", viper.GetInt("kube.ingress.selfsignedyears"), "Validity of self-signed certificate. Defaults to 1 year")
 	kubeCmd.Flags().StringVar(&kubeOptions.IngressOptions.CrtPath, "kube.ingress.crtpath", viper.GetString("kube.ingress.crtpath"), "Path to .crt file (PEM format) for non self-signed certificate")
 	kubeCmd.Flags().StringVar(&kubeOptions.IngressOptions.KeyPath, "kube.ingress.keypath", viper.GetString("kube.ingress.keypath"), "Path to .key file (PEM format) for non self-signed certificate")
+	kubeCmd.Flags().StringVar(&kubeOptions.IngressOptions.Controller, "kube.ingress.controller", viper.GetString("kube.ingress.controller"), "Ingress controller the access control is translated for. Such as nginx (ingress-nginx annotations) and traefik (Traefik middlewares). Defaults to nginx")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.IngressOptions.AuthUsers, "kube.ingress.authusers", viper.GetStringSlice("kube.ingress.authusers"), "Basic auth users in the form of user:password, stored bcrypt hashed in an htpasswd secret. Basic auth is disabled when empty")
+	kubeCmd.Flags().StringVar(&kubeOptions.IngressOptions.AuthRealm, "kube.ingress.authrealm", viper.GetString("kube.ingress.authrealm"), "Realm shown in the basic auth prompt. Defaults to Authentication Required")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.IngressOptions.AllowSourceRanges, "kube.ingress.allowsourceranges", viper.GetStringSlice("kube.ingress.allowsourceranges"), "CIDRs allowed to access the app, such as 10.0.0.0/8. All sources are allowed when empty")
+	kubeCmd.Flags().Int32Var(&kubeOptions.IngressOptions.RateLimit, "kube.ingress.ratelimit", viper.GetInt32("kube.ingress.ratelimit"), "Requests per second allowed from each client IP. Defaults to 0, unlimited")
+	kubeCmd.Flags().Int32Var(&kubeOptions.IngressOptions.RateLimitBurst, "kube.ingress.ratelimitburst", viper.GetInt32("kube.ingress.ratelimitburst"), "Requests allowed in a burst above the rate limit. Defaults to the ingress controller default")
+	kubeCmd.Flags().StringVar(&kubeOptions.IngressOptions.MaxBodySize, "kube.ingress.maxbodysize", viper.GetString("kube.ingress.maxbodysize"), "Maximum size of a request body, such as 10Mi. Defaults to the ingress controller default")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.IngressOptions.CORSAllowOrigins, "kube.ingress.corsalloworigins", viper.GetStringSlice("kube.ingress.corsalloworigins"), "Origins allowed to access the app cross-origin, such as https://app.com. CORS is disabled when empty")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.IngressOptions.CORSAllowMethods, "kube.ingress.corsallowmethods", viper.GetStringSlice("kube.ingress.corsallowmethods"), "Methods allowed in cross-origin requests. Defaults to the ingress controller default")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.IngressOptions.CORSAllowHeaders, "kube.ingress.corsallowheaders", viper.GetStringSlice("kube.ingress.corsallowheaders"), "Headers allowed in cross-origin requests. Defaults to the ingress controller default")
+	kubeCmd.Flags().BoolVar(&kubeOptions.IngressOptions.CORSAllowCredentials, "kube.ingress.corsallowcredentials", viper.GetBool("kube.ingress.corsallowcredentials"), "Allow cross-origin requests with credentials. Defaults to false")
+	kubeCmd.Flags().Int32Var(&kubeOptions.IngressOptions.CORSMaxAge, "kube.ingress.corsmaxage", viper.GetInt32("kube.ingress.corsmaxage"), "Seconds the result of a preflight request is cached. Defaults to the ingress controller default")
+	kubeCmd.Flags().StringVar(&kubeOptions.Routing, "kube.routing", viper.GetString("kube.routing"), "How app is exposed. Such as ingress and gateway (Gateway API route). Defaults to ingress")
+	kubeCmd.Flags().StringVar(&kubeOptions.RouteOptions.Kind, "kube.route.kind", viper.GetString("kube.route.kind"), "Kind of Gateway API route. Such as http (HTTPRoute) and grpc (GRPCRoute). Defaults to http")
+	kubeCmd.Flags().StringVar(&kubeOptions.RouteOptions.Gateway, "kube.route.gateway", viper.GetString("kube.route.gateway"), "Name of the gateway the route is attached to. Required when kube.routing is gateway")
+	kubeCmd.Flags().StringVar(&kubeOptions.RouteOptions.GatewayNamespace, "kube.route.gatewaynamespace", viper.GetString("kube.route.gatewaynamespace"), "Namespace of the gateway. Defaults to the app namespace")
+	kubeCmd.Flags().StringVar(&kubeOptions.RouteOptions.SectionName, "kube.route.sectionname", viper.GetString("kube.route.sectionname"), "Listener of the gateway the route is attached to. Defaults to all listeners")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.RouteOptions.Hostnames, "kube.route.hostnames", viper.GetStringSlice("kube.route.hostnames"), "Hostnames of the route. Defaults to kube.ingress.host")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.RouteOptions.Paths, "kube.route.paths", viper.GetStringSlice("kube.route.paths"), "Path prefixes matched by the http route. Prefix a path with = for exact match or ~ for regular expression match")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.RouteOptions.Methods, "kube.route.methods", viper.GetStringSlice("kube.route.methods"), "Methods matched by the grpc route in the form of service or service/method")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.RouteOptions.Headers, "kube.route.headers", viper.GetStringSlice("kube.route.headers"), "Headers matched exactly by the route in the form of name:value")
+	kubeCmd.Flags().StringArrayVar(&routeBackendSpecs, "kube.route.backends", nil, "Weighted backends of the route in the form of service=hellogo-canary,port=8000,weight=10. Defaults to the app service")
+	kubeCmd.Flags().BoolVar(&kubeOptions.ServiceOptions.Enabled, "kube.service.enabled", viper.GetBool("kube.service.enabled"), "Enable or disable the app service. Disable it for background workers serving no traffic. Defaults to true")
+	kubeCmd.Flags().BoolVar(&kubeOptions.ServiceAccountOptions.Enabled, "kube.serviceaccount.enabled", viper.GetBool("kube.serviceaccount.enabled"), "Enable or disable the app service account. When disabled app pods run as the default service account and reference the pull secrets themselves. Defaults to true")
 	kubeCmd.Flags().Int32Var(&kubeOptions.ServiceOptions.Port, "kube.service.port", viper.GetInt32("kube.service.port"), "Port for app service. Defaults to 8000")
 	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.Replicas, "kube.deployment.replicas", viper.GetInt32("kube.deployment.replicas"), "Number of app pods. Defaults to 1")
 	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.Port, "kube.deployment.port", viper.GetInt32("kube.deployment.port"), "Container port for each app pod. Defaults to 8000, as same as service port")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.RollingUpdate.MaxSurge, "kube.deployment.rollingupdate.maxsurge", viper.GetString("kube.deployment.rollingupdate.maxsurge"), "MaxSurge for rolling update app pods. Defaults to 1")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.RollingUpdate.MaxUnavailable, "kube.deployment.rollingupdate.maxunavailable", viper.GetString("kube.deployment.rollingupdate.maxunavailable"), "MaxUnavailable for rolling update app pods. Defaults to 0")
+	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Strategy, "kube.deployment.strategy", viper.GetString("kube.deployment.strategy"), "Strategy for updating app pods of deployment. Such as RollingUpdate and Recreate (stop all old pods before starting new ones). Defaults to RollingUpdate")
+	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.MinReadySeconds, "kube.deployment.minreadyseconds", viper.GetInt32("kube.deployment.minreadyseconds"), "Seconds a new pod must be ready without crashing before it is counted as available. Defaults to 0")
+	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.ProgressDeadlineSeconds, "kube.deployment.progressdeadlineseconds", viper.GetInt32("kube.deployment.progressdeadlineseconds"), "Seconds for a deployment rollout to make progress before it is reported as failed. Defaults to 600")
+	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.RevisionHistoryLimit, "kube.deployment.revisionhistorylimit", viper.GetInt32("kube.deployment.revisionhistorylimit"), "Number of old revisions kept for rollback. Defaults to 10")
+	kubeCmd.Flags().Int64Var(&kubeOptions.DeploymentOptions.TerminationGracePeriodSeconds, "kube.deployment.terminationgraceperiodseconds", viper.GetInt64("kube.deployment.terminationgraceperiodseconds"), "Seconds for each app pod to shut down gracefully, including the prestop hook, before it is killed. Defaults to 30")
+	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.ImagePullPolicy, "kube.deployment.imagepullpolicy", viper.GetString("kube.deployment.imagepullpolicy"), "Pull policy of the app image. Such as Always, IfNotPresent and Never. Defaults to IfNotPresent, as the image is deployed by digest")
+	addLifecycleFlags(&kubeOptions.DeploymentOptions.Lifecycle.PreStop, "prestop", "prestop hook, run before the container is stopped")
+	addLifecycleFlags(&kubeOptions.DeploymentOptions.Lifecycle.PostStart, "poststart", "poststart hook, run right after the container is started")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Quota.CPULimit, "kube.deployment.quota.cpulimit", viper.GetString("kube.deployment.quota.cpulimit"), "CPU limit for each app container (one pod one container)")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Quota.MemLimit, "kube.deployment.quota.memlimit", viper.GetString("kube.deployment.quota.memlimit"), "Memory limit for each app container (one pod one container)")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Quota.CPURequest, "kube.deployment.quota.cpurequest", viper.GetString("kube.deployment.quota.cpurequest"), "CPU request for each app container (one pod one container)")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Quota.MemRequest, "kube.deployment.quota.memrequest", viper.GetString("kube.deployment.quota.memrequest"), "Memory request for each app container (one pod one container)")
-	kubeCmd.Flags().BoolVar(&kubeOptions.DeploymentOptions.LivenessProbe.Enabled, "kube.deployment.livenessprobe.enabled", viper.GetBool("kube.deployment.livenessprobe.enabled"), "Enable or disable liveness probe for each app container (one pod one container). Defaults to false")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.LivenessProbe.Type, "kube.deployment.livenessprobe.type", viper.GetString("kube.deployment.livenessprobe.type"), "Type of liveness probe for each app container (one pod one container). Such as HTTPGet, TCPSocket and Exec. Defaults to HTTPGet")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.LivenessProbe.Path, "kube.deployment.livenessprobe.path", viper.GetString("kube.deployment.livenessprobe.path"), "Path of liveness probe for each app container (one pod one container). Correspond to HTTPGet type. Defaults to /")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.LivenessProbe.Scheme, "kube.deployment.livenessprobe.scheme", viper.GetString("kube.deployment.livenessprobe.scheme"), "Scheme of liveness probe for each app container (one pod one container). Correspond to HTTPGet type. Such as HTTP and HTTPS. Defaults to HTTP")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.LivenessProbe.Command, "kube.deployment.livenessprobe.command", viper.GetString("kube.deployment.livenessprobe.command"), "Command of liveness probe for each app container (one pod one container). Correspond to Exec type")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.LivenessProbe.InitialDelaySeconds, "kube.deployment.livenessprobe.initialdelayseconds", viper.GetInt32("kube.deployment.livenessprobe.initialdelayseconds"), "Initial delay seconds of liveness probe for each app container (one pod one container). Defaults to 0")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.LivenessProbe.TimeoutSeconds, "kube.deployment.livenessprobe.timeoutseconds", viper.GetInt32("kube.deployment.livenessprobe.timeoutseconds"), "Timeout seconds of liveness probe for each app container (one pod one container). Defaults to 1")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.LivenessProbe.PeriodSeconds, "kube.deployment.livenessprobe.periodseconds", viper.GetInt32("kube.deployment.livenessprobe.periodseconds"), "Period seconds of liveness probe for each app container (one pod one container). Defaults to 10")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.LivenessProbe.SuccessThreshold, "kube.deployment.livenessprobe.successthreshold", viper.GetInt32("kube.deployment.livenessprobe.successthreshold"), "Success threshold of liveness probe for each app container (one pod one container). Defaults to 1")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.LivenessProbe.FailureThreshold, "kube.deployment.livenessprobe.failurethreshold", viper.GetInt32("kube.deployment.livenessprobe.failurethreshold"), "Failure threshold of liveness probe for each app container (one pod one container). Defaults to 3")
-	kubeCmd.Flags().BoolVar(&kubeOptions.DeploymentOptions.ReadinessProbe.Enabled, "kube.deployment.readinessprobe.enabled", viper.GetBool("kube.deployment.readinessprobe.enabled"), "Enable or disable readiness probe for each app container (one pod one container)")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.ReadinessProbe.Type, "kube.deployment.readinessprobe.type", viper.GetString("kube.deployment.readinessprobe.type"), "Type of readiness probe for each app container (one pod one container). Such as HTTPGet, TCPSocket and Exec. Defaults to HTTPGet")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.ReadinessProbe.Path, "kube.deployment.readinessprobe.path", viper.GetString("kube.deployment.readinessprobe.path"), "Path of readiness probe for each app container (one pod one container). Correspond to HTTPGet type. Defaults to /")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.ReadinessProbe.Scheme, "kube.deployment.readinessprobe.scheme", viper.GetString("kube.deployment.readinessprobe.scheme"), "Scheme of readiness probe for each app container (one pod one container). Correspond to HTTPGet type. Such as HTTP and HTTPS. Defaults to HTTP")
-	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.ReadinessProbe.Command, "kube.deployment.readinessprobe.command", viper.GetString("kube.deployment.readinessprobe.command"), "Command of readiness probe for each app container (one pod one container). Correspond to Exec type")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.ReadinessProbe.InitialDelaySeconds, "kube.deployment.readinessprobe.initialdelayseconds", viper.GetInt32("kube.deployment.readinessprobe.initialdelayseconds"), "Initial delay seconds of readiness probe for each app container (one pod one container). Defaults to 0")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.ReadinessProbe.TimeoutSeconds, "kube.deployment.readinessprobe.timeoutseconds", viper.GetInt32("kube.deployment.readinessprobe.timeoutseconds"), "Timeout seconds of readiness probe for each app container (one pod one container). Defaults to 1")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.ReadinessProbe.PeriodSeconds, "kube.deployment.readinessprobe.periodseconds", viper.GetInt32("kube.deployment.readinessprobe.periodseconds"), "Period seconds of readiness probe for each app container (one pod one container). Defaults to 10")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.ReadinessProbe.SuccessThreshold, "kube.deployment.readinessprobe.successthreshold", viper.GetInt32("kube.deployment.readinessprobe.successthreshold"), "Success threshold of readiness probe for each app container (one pod one container). Defaults to 1")
-	kubeCmd.Flags().Int32Var(&kubeOptions.DeploymentOptions.ReadinessProbe.FailureThreshold, "kube.deployment.readinessprobe.failurethreshold", viper.GetInt32("kube.deployment.readinessprobe.failurethreshold"), "Failure threshold of readiness probe for each app container (one pod one container). Defaults to 3")
+	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Quota.EphemeralStorageLimit, "kube.deployment.quota.ephemeralstoragelimit", viper.GetString("kube.deployment.quota.ephemeralstoragelimit"), "Ephemeral storage limit for each app container (one pod one container)")
+	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.Quota.EphemeralStorageRequest, "kube.deployment.quota.ephemeralstoragerequest", viper.GetString("kube.deployment.quota.ephemeralstoragerequest"), "Ephemeral storage request for each app container (one pod one container)")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.DeploymentOptions.Quota.Extended, "kube.deployment.quota.extended", viper.GetStringSlice("kube.deployment.quota.extended"), "Extended resources for each app container (one pod one container) in the form of name=quantity, such as nvidia.com/gpu=1")
+	addProbeFlags(&kubeOptions.DeploymentOptions.LivenessProbe.ProbeOptions, "livenessprobe", "liveness probe")
+	addProbeFlags(&kubeOptions.DeploymentOptions.ReadinessProbe.ProbeOptions, "readinessprobe", "readiness probe")
+	addProbeFlags(&kubeOptions.DeploymentOptions.StartupProbe.ProbeOptions, "startupprobe", "startup probe")
 	kubeCmd.Flags().BoolVar(&kubeOptions.DeploymentOptions.VolumeMount.Enabled, "kube.deployment.volumemount.enabled", viper.GetBool("kube.deployment.volumemount.enabled"), "Enable or disable volume mount for each app pod. Defaults to false")
 	kubeCmd.Flags().StringVar(&kubeOptions.DeploymentOptions.VolumeMount.MountPath, "kube.deployment.volumemount.mountpath", viper.GetString("kube.deployment.volumemount.mountpath"), "Path of volume mount for each app pod. Defaults to /app/data")
+	kubeCmd.Flags().StringArrayVar(&volumeSpecs, "kube.deployment.volumes", nil, "Mount volumes into each app pod in the form of name=data,type=pvc,mountpath=/data,storagesize=1Gi. Types are pvc, emptydir, claim, hostpath, nfs, configmap and secret")
+	kubeCmd.Flags().StringVar(&kubeOptions.StatefulSetOptions.PodManagementPolicy, "kube.statefulset.podmanagementpolicy", viper.GetString("kube.statefulset.podmanagementpolicy"), "Pod management policy of statefulset. Such as OrderedReady and Parallel. Defaults to OrderedReady")
+	kubeCmd.Flags().BoolVar(&kubeOptions.DaemonSetOptions.HostNetwork, "kube.daemonset.hostnetwork", viper.GetBool("kube.daemonset.hostnetwork"), "Enable or disable host network for daemonset pods. Defaults to false")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.DaemonSetOptions.HostPaths, "kube.daemonset.hostpaths", nil, "Mount host paths into daemonset pods in the form of hostPath:mountPath[:ro]")
 	kubeCmd.Flags().BoolVar(&kubeOptions.HpaOptions.Enabled, "kube.hpa.enabled", viper.GetBool("kube.hpa.enabled"), "Enable or disable HPA (Horizontal Pod Autoscaler) for app pods. Defaults to false")
 	kubeCmd.Flags().Int32Var(&kubeOptions.HpaOptions.MinReplicas, "kube.hpa.minreplicas", viper.GetInt32("kube.hpa.minreplicas"), "Number of minimum pods for HPA (Horizontal Pod Autoscaler). Defaults to 1")
 	kubeCmd.Flags().Int32Var(&kubeOptions.HpaOptions.MaxReplicas, "kube.hpa.maxreplicas", viper.GetInt32("kube.hpa.maxreplicas"), "Number of maximum pods for HPA (Horizontal Pod Autoscaler). Defaults to 10")
 	kubeCmd.Flags().Int32Var(&kubeOptions.HpaOptions.CPURate, "kube.hpa.cpurate", viper.GetInt32("kube.hpa.cpurate"), "Average CPU utilization for HPA (Horizontal Pod Autoscaler). Defaults to 50")
+	kubeCmd.Flags().BoolVar(&kubeOptions.Metrics.Enabled, "kube.metrics.enabled", viper.GetBool("kube.metrics.enabled"), "Enable or disable exposing prometheus metrics of app pods. Defaults to false")
+	kubeCmd.Flags().Int32Var(&kubeOptions.Metrics.Port, "kube.metrics.port", viper.GetInt32("kube.metrics.port"), "Port of prometheus metrics, exposed on the container and service. Defaults to container port")
+	kubeCmd.Flags().StringVar(&kubeOptions.Metrics.Path, "kube.metrics.path", viper.GetString("kube.metrics.path"), "Path of prometheus metrics. Defaults to /metrics")
+	kubeCmd.Flags().StringVar(&kubeOptions.Metrics.Scheme, "kube.metrics.scheme", viper.GetString("kube.metrics.scheme"), "Scheme of prometheus metrics. Such as http and https. Defaults to http")
+	kubeCmd.Flags().StringVar(&kubeOptions.Metrics.Interval, "kube.metrics.interval", viper.GetString("kube.metrics.interval"), "Scrape interval of the monitor, such as 30s. Defaults to the prometheus scrape interval")
+	kubeCmd.Flags().StringVar(&kubeOptions.Metrics.Monitor, "kube.metrics.monitor", viper.GetString("kube.metrics.monitor"), "Prometheus-operator monitor to create. Such as servicemonitor and podmonitor. Defaults to none (prometheus.io annotations only)")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.Metrics.Labels, "kube.metrics.labels", viper.GetStringSlice("kube.metrics.labels"), "Labels of the monitor matched by the prometheus monitor selector in the form of key=value, such as release=kube-prometheus-stack")
 	kubeCmd.Flags().StringVar(&kubeOptions.PvcOptions.AccessMode, "kube.pvc.accessmode", viper.GetString("kube.pvc.accessmode"), "Access mode of persistent storage for pod volumn mount. Such as ReadWriteOnce, ReadOnlyMany and ReadWriteMany. Defaults to ReadWriteOnce")
 	kubeCmd.Flags().StringVar(&kubeOptions.PvcOptions.StorageClassName, "kube.pvc.storageclassname", viper.GetString("kube.pvc.storageclassname"), "Classname of persistent storage for pod volumn mount. Defaults to openebs-hostpath")
 	kubeCmd.Flags().StringVar(&kubeOptions.PvcOptions.StorageSize, "kube.pvc.storagesize", viper.GetString("kube.pvc.storagesize"), "Size of persistent storage for pod volumn mount. Defaults to 1Gi")
+	kubeCmd.Flags().StringVar(&kubeOptions.PvcOptions.RetentionPolicy, "kube.pvc.retentionpolicy", viper.GetString("kube.pvc.retentionpolicy"), "What to do with the PVC once volume mount is disabled. Such as retain and delete. Defaults to retain")
+	kubeCmd.Flags().StringVar(&kubeOptions.PvcOptions.SnapshotClassName, "kube.pvc.snapshotclassname", viper.GetString("kube.pvc.snapshotclassname"), "VolumeSnapshotClass of the snapshot taken before deleting the PVC. Defaults to the cluster default")
+	kubeCmd.Flags().BoolVar(&kubeOptions.ResourceQuota.Enabled, "kube.resourcequota.enabled", viper.GetBool("kube.resourcequota.enabled"), "Enable or disable the ResourceQuota capping total resource usage of the namespace. Defaults to false")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.ResourceQuota.Hard, "kube.resourcequota.hard", viper.GetStringSlice("kube.resourcequota.hard"), "Hard limits of the ResourceQuota in the form of name=quantity, such as requests.cpu=4,limits.memory=8Gi,pods=20")
+	kubeCmd.Flags().BoolVar(&kubeOptions.LimitRange.Enabled, "kube.limitrange.enabled", viper.GetBool("kube.limitrange.enabled"), "Enable or disable the LimitRange giving containers of the namespace default resources. Defaults to false")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.LimitRange.Default, "kube.limitrange.default", viper.GetStringSlice("kube.limitrange.default"), "Default limits of containers in the form of name=quantity, such as cpu=500m,memory=512Mi")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.LimitRange.DefaultRequest, "kube.limitrange.defaultrequest", viper.GetStringSlice("kube.limitrange.defaultrequest"), "Default requests of containers in the form of name=quantity, such as cpu=100m,memory=128Mi")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.LimitRange.Max, "kube.limitrange.max", viper.GetStringSlice("kube.limitrange.max"), "Maximum resources of a container in the form of name=quantity")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.LimitRange.Min, "kube.limitrange.min", viper.GetStringSlice("kube.limitrange.min"), "Minimum resources of a container in the form of name=quantity")
+	kubeCmd.Flags().BoolVar(&kubeOptions.HookOptions.PreDeploy.Enabled, "kube.hooks.predeploy.enabled", viper.GetBool("kube.hooks.predeploy.enabled"), "Enable or disable the job run before updating app workload. Defaults to false")
+	kubeCmd.Flags().StringVar(&kubeOptions.HookOptions.PreDeploy.Image, "kube.hooks.predeploy.image", viper.GetString("kube.hooks.predeploy.image"), "Image of the pre-deploy job. Defaults to the freshly built app image")
+	kubeCmd.Flags().StringVar(&kubeOptions.HookOptions.PreDeploy.Command, "kube.hooks.predeploy.command", viper.GetString("kube.hooks.predeploy.command"), "Command of the pre-deploy job, such as database migrations")
+	kubeCmd.Flags().Int32Var(&kubeOptions.HookOptions.PreDeploy.BackoffLimit, "kube.hooks.predeploy.backofflimit", viper.GetInt32("kube.hooks.predeploy.backofflimit"), "Number of retries before marking the pre-deploy job as failed. Defaults to 0")
+	kubeCmd.Flags().Int64Var(&kubeOptions.HookOptions.PreDeploy.ActiveDeadlineSeconds, "kube.hooks.predeploy.activedeadlineseconds", viper.GetInt64("kube.hooks.predeploy.activedeadlineseconds"), "Maximum running seconds of the pre-deploy job. Defaults to 600")
+	kubeCmd.Flags().Int32Var(&kubeOptions.HookOptions.PreDeploy.TTLSecondsAfterFinished, "kube.hooks.predeploy.ttlsecondsafterfinished", viper.GetInt32("kube.hooks.predeploy.ttlsecondsafterfinished"), "Seconds to keep the finished pre-deploy job before it is cleaned up. Defaults to 600")
+	kubeCmd.Flags().BoolVar(&kubeOptions.HookOptions.PostDeploy.Enabled, "kube.hooks.postdeploy.enabled", viper.GetBool("kube.hooks.postdeploy.enabled"), "Enable or disable the job run after app workload is rolled out. Defaults to false")
+	kubeCmd.Flags().StringVar(&kubeOptions.HookOptions.PostDeploy.Image, "kube.hooks.postdeploy.image", viper.GetString("kube.hooks.postdeploy.image"), "Image of the post-deploy job. Defaults to the freshly built app image")
+	kubeCmd.Flags().StringVar(&kubeOptions.HookOptions.PostDeploy.Command, "kube.hooks.postdeploy.command", viper.GetString("kube.hooks.postdeploy.command"), "Command of the post-deploy job, such as smoke tests")
+	kubeCmd.Flags().Int32Var(&kubeOptions.HookOptions.PostDeploy.BackoffLimit, "kube.hooks.postdeploy.backofflimit", viper.GetInt32("kube.hooks.postdeploy.backofflimit"), "Number of retries before marking the post-deploy job as failed. Defaults to 0")
+	kubeCmd.Flags().Int64Var(&kubeOptions.HookOptions.PostDeploy.ActiveDeadlineSeconds, "kube.hooks.postdeploy.activedeadlineseconds", viper.GetInt64("kube.hooks.postdeploy.activedeadlineseconds"), "Maximum running seconds of the post-deploy job. Defaults to 600")
+	kubeCmd.Flags().Int32Var(&kubeOptions.HookOptions.PostDeploy.TTLSecondsAfterFinished, "kube.hooks.postdeploy.ttlsecondsafterfinished", viper.GetInt32("kube.hooks.postdeploy.ttlsecondsafterfinished"), "Seconds to keep the finished post-deploy job before it is cleaned up. Defaults to 600")
+	kubeCmd.Flags().BoolVar(&kubeOptions.HookOptions.Rollback, "kube.hooks.rollback", viper.GetBool("kube.hooks.rollback"), "Roll back app workload to the previous revision when the post-deploy job fails. Defaults to false")
+	kubeCmd.Flags().BoolVar(&kubeOptions.PullSecrets.Public, "kube.pullsecrets.public", viper.GetBool("kube.pullsecrets.public"), "Pull the app image anonymously without creating the docker secret. Defaults to false")
+	kubeCmd.Flags().BoolVar(&kubeOptions.Canary.Enabled, "kube.canary.enabled", viper.GetBool("kube.canary.enabled"), "Roll out a new version of a deployment as a canary taking a growing share of the traffic before promoting it. Needs nginx ingress or gateway routing. Defaults to false")
+	kubeCmd.Flags().StringSliceVar(&canaryStepSpecs, "kube.canary.steps", viper.GetStringSlice("kube.canary.steps"), "Percentages of the traffic sent to the canary step by step. Defaults to 5,25,50,100")
+	kubeCmd.Flags().Int32Var(&kubeOptions.Canary.PauseSeconds, "kube.canary.pauseseconds", viper.GetInt32("kube.canary.pauseseconds"), "Seconds to wait at each step before analyzing the canary. Defaults to 60")
+	kubeCmd.Flags().Int32Var(&kubeOptions.Canary.Replicas, "kube.canary.replicas", viper.GetInt32("kube.canary.replicas"), "Number of canary pods. Defaults to 1")
+	kubeCmd.Flags().StringVar(&kubeOptions.Canary.PrometheusURL, "kube.canary.prometheusurl", viper.GetString("kube.canary.prometheusurl"), "URL of the prometheus the canary queries run against, such as http://prometheus.monitoring:9090")
+	kubeCmd.Flags().StringArrayVar(&canaryQuerySpecs, "kube.canary.queries", nil, "Queries analyzing the canary at each step in the form of name<threshold:promql or name>threshold:promql. $app, $canary and $namespace in promql are replaced. The canary is rolled back when one fails")
+	kubeCmd.Flags().StringSliceVar(&kubeOptions.PullSecrets.Existing, "kube.pullsecrets.existing", viper.GetStringSlice("kube.pullsecrets.existing"), "Pre-existing pull secrets in the namespace to add to the app service account, or to app pods when it is disabled")
+	kubeCmd.Flags().StringArrayVar(&registrySpecs, "kube.pullsecrets.registries", nil, "Credentials of other registries merged into the docker secret in the form of registry=ghcr.io,username=user,password=token")
 	kubeCmd.Flags().StringSliceVarP(&kubeOptions.DeploymentOptions.EnvVars, "env", "e", nil, "Set environment variables in the form of key=value")
+	kubeCmd.Flags().BoolVar(&kubeOptions.ConfirmDataLoss, "confirm-data-loss", false, "Confirm deleting PVCs whose retention policy is delete. A snapshot is taken before deletion")
+	kubeCmd.Flags().BoolVar(&kubeOptions.PlanOnly, "plan", false, "Print the deploy plan without building the image or changing the cluster")
+	kubeCmd.PersistentFlags().BoolVar(&kubeOptions.Adopt, "adopt", false, "Take over the namespace and resources of the app that were not created by appdeployer or belong to another app")
+	kubeCmd.Flags().BoolVar(&kubeOptions.Prune, "prune", viper.GetBool("kube.prune"), "Delete the objects labeled for the app that are no longer deployed, such as the tls secret after TLS is turned off. The deletions are logged")
+	kubeCmd.Flags().BoolVar(&kubeOptions.SkipPreflight, "skip-preflight", false, "Skip checking the ingress class or gateway api, storage classes, metrics-server, prometheus-operator and RBAC permissions before deploying")
+}
+
+// addLifecycleFlags binds flags for one of the container lifecycle hooks
+func addLifecycleFlags(handler *kube.LifecycleHandler, name string, desc string) {
+	prefix := "kube.deployment.lifecycle." + name
+	kubeCmd.Flags().StringVar(&handler.Type, prefix+".type", viper.GetString(prefix+".type"), fmt.Sprintf("Type of %s. Such as Exec, HTTPGet and Sleep. Defaults to none", desc))
+	kubeCmd.Flags().StringVar(&handler.Command, prefix+".command", viper.GetString(prefix+".command"), fmt.Sprintf("Command of %s. Correspond to Exec type", desc))
+	kubeCmd.Flags().StringVar(&handler.Path, prefix+".path", viper.GetString(prefix+".path"), fmt.Sprintf("Path of %s. Correspond to HTTPGet type", desc))
+	kubeCmd.Flags().StringVar(&handler.Port, prefix+".port", viper.GetString(prefix+".port"), fmt.Sprintf("Port number or name of %s. Correspond to HTTPGet type. Defaults to container port", desc))
+	kubeCmd.Flags().StringVar(&handler.Scheme, prefix+".scheme", viper.GetString(prefix+".scheme"), fmt.Sprintf("Scheme of %s. Correspond to HTTPGet type. Defaults to HTTP", desc))
+	kubeCmd.Flags().Int64Var(&handler.Seconds, prefix+".seconds", viper.GetInt64(prefix+".seconds"), fmt.Sprintf("Seconds of %s. Correspond to Sleep type, which needs kubernetes 1.30 or later", desc))
+}
+
+// addProbeFlags sets default values and binds flags for one of the container probes
+func addProbeFlags(probe *kube.ProbeOptions, name string, desc string) {
+	prefix := "kube.deployment." + name
+	viper.SetDefault(prefix+".enabled", false)
+	viper.SetDefault(prefix+".type", kube.ProbeTypeHTTPGet)
+	viper.SetDefault(prefix+".path", "/")
+	viper.SetDefault(prefix+".scheme", "http")
+	viper.SetDefault(prefix+".initialdelayseconds", 0)
+	viper.SetDefault(prefix+".timeoutseconds", 1)
+	viper.SetDefault(prefix+".periodseconds", 10)
+	viper.SetDefault(prefix+".successthreshold", 1)
+	viper.SetDefault(prefix+".failurethreshold", 3)
+
+	kubeCmd.Flags().BoolVar(&probe.Enabled, prefix+".enabled", viper.GetBool(prefix+".enabled"), fmt.Sprintf("Enable or disable %s for each app container (one pod one container). Defaults to false", desc))
+	kubeCmd.Flags().StringVar(&probe.Type, prefix+".type", viper.GetString(prefix+".type"), fmt.Sprintf("Type of %s for each app container (one pod one container). Such as HTTPGet, TCPSocket, Exec and GRPC. Defaults to HTTPGet", desc))
+	kubeCmd.Flags().StringVar(&probe.Path, prefix+".path", viper.GetString(prefix+".path"), fmt.Sprintf("Path of %s for each app container (one pod one container). Correspond to HTTPGet type. Defaults to /", desc))
+	kubeCmd.Flags().StringVar(&probe.Port, prefix+".port", viper.GetString(prefix+".port"), fmt.Sprintf("Port number or name of %s for each app container (one pod one container). Correspond to HTTPGet, TCPSocket and GRPC types. Defaults to container port", desc))
+	kubeCmd.Flags().StringVar(&probe.Host, prefix+".host", viper.GetString(prefix+".host"), fmt.Sprintf("Host of %s for each app container (one pod one container). Correspond to HTTPGet and TCPSocket types. Defaults to pod IP", desc))
+	kubeCmd.Flags().StringVar(&probe.Scheme, prefix+".scheme", viper.GetString(prefix+".scheme"), fmt.Sprintf("Scheme of %s for each app container (one pod one container). Correspond to HTTPGet type. Such as HTTP and HTTPS. Defaults to HTTP", desc))
+	kubeCmd.Flags().StringSliceVar(&probe.Headers, prefix+".headers", viper.GetStringSlice(prefix+".headers"), fmt.Sprintf("HTTP headers of %s for each app container (one pod one container) in the form of name:value. Correspond to HTTPGet type", desc))
+	kubeCmd.Flags().StringVar(&probe.Command, prefix+".command", viper.GetString(prefix+".command"), fmt.Sprintf("Command of %s for each app container (one pod one container). Correspond to Exec type", desc))
+	kubeCmd.Flags().StringVar(&probe.Service, prefix+".service", viper.GetString(prefix+".service"), fmt.Sprintf("Service name of %s for each app container (one pod one container). Correspond to GRPC type", desc))
+	kubeCmd.Flags().Int32Var(&probe.InitialDelaySeconds, prefix+".initialdelayseconds", viper.GetInt32(prefix+".initialdelayseconds"), fmt.Sprintf("Initial delay seconds of %s for each app container (one pod one container). Defaults to 0", desc))
+	kubeCmd.Flags().Int32Var(&probe.TimeoutSeconds, prefix+".timeoutseconds", viper.GetInt32(prefix+".timeoutseconds"), fmt.Sprintf("Timeout seconds of %s for each app container (one pod one container). Defaults to 1", desc))
+	kubeCmd.Flags().Int32Var(&probe.PeriodSeconds, prefix+".periodseconds", viper.GetInt32(prefix+".periodseconds"), fmt.Sprintf("Period seconds of %s for each app container (one pod one container). Defaults to 10", desc))
+	kubeCmd.Flags().Int32Var(&probe.SuccessThreshold, prefix+".successthreshold", viper.GetInt32(prefix+".successthreshold"), fmt.Sprintf("Success threshold of %s for each app container (one pod one container). Defaults to 1", desc))
+	kubeCmd.Flags().Int32Var(&probe.FailureThreshold, prefix+".failurethreshold", viper.GetInt32(prefix+".failurethreshold"), fmt.Sprintf("Failure threshold of %s for each app container (one pod one container). Defaults to 3", desc))
+	kubeCmd.Flags().Int64Var(&probe.TerminationGracePeriodSeconds, prefix+".terminationgraceperiodseconds", viper.GetInt64(prefix+".terminationgraceperiodseconds"), fmt.Sprintf("Termination grace period seconds after %s fails, overriding the pod level setting. Defaults to 0 (not overridden)", desc))
 }
 
 var kubeCmd = &cobra.Command{
 	Use:   "kube",
 	Short: "Deploy app to kubernetes cluster",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		volumes, err := parseVolumes(volumeSpecs)
+		if err != nil {
+			return err
+		}
+		kubeOptions.DeploymentOptions.Volumes = append(kubeOptions.DeploymentOptions.Volumes, volumes...)
+
+		registries, err := parseRegistries(registrySpecs)
+		if err != nil {
+			return err
+		}
+		kubeOptions.PullSecrets.Registries = append(kubeOptions.PullSecrets.Registries, registries...)
+
+		backends, err := parseRouteBackends(routeBackendSpecs)
+		if err != nil {
+			return err
+		}
+		kubeOptions.RouteOptions.Backends = append(kubeOptions.RouteOptions.Backends, backends...)
+
+		steps, err := parseCanarySteps(canaryStepSpecs)
+		if err != nil {
+			return err
+		}
+		kubeOptions.Canary.Steps = steps
+
+		for _, spec := range canaryQuerySpecs {
+			query, err := kube.ParseCanaryQuery(spec)
+			if err != nil {
+				return err
+			}
+			kubeOptions.Canary.Queries = append(kubeOptions.Canary.Queries, query)
+		}
+
+		clusters, err := parseClusters(clusterSpecs)
+		if err != nil {
+			return err
+		}
+		kubeOptions.Clusters = append(kubeOptions.Clusters, clusters...)
+
 		return KubeDeploy(&defaultOptions, &gitOptions, &kubeOptions, &dockerOptions, func(msg string) {
 			fmt.Println(msg)
 		})
@@ -154,115 +360,777 @@ func KubeDeploy(defaultOptions *DefaultOptions, gitOptions *git.GitOptions, kube
 		return err
 	}
 
-	// Create a docker service
-	dockerservice, err := docker.NewDockerService()
+	// Tag the image now that the source of the app is pulled
+	tag, err := docker.ResolveTag(*dockerOptions)
 	if err != nil {
 		return err
 	}
+	dockerOptions.Tag = tag
 
 	//TODO handle timeout or cancel
 	ctx := context.TODO()
 
+	targets, err := newKubeTargets(kubeOptions, logHandler)
+	if err != nil {
+		return err
+	}
+
+	// Work out how live objects change in every cluster before spending time on the build
+	for _, target := range targets {
+		if err := planKube(ctx, target, defaultOptions); err != nil {
+			return err
+		}
+	}
+	if kubeOptions.PlanOnly {
+		return nil
+	}
+
+	// Create a docker service
+	dockerservice, err := docker.NewDockerService()
+	if err != nil {
+		return err
+	}
+
 	// Build an app into a docker image
 	if err := dockerservice.BuildImage(ctx, *dockerOptions, logHandler); err != nil {
 		return err
 	}
 
-	// Push the docker image to docker registry
-	if err := dockerservice.PushImage(ctx, *dockerOptions, logHandler); err != nil {
+	// Push the docker image to docker registry, deploying it by digest so that every pod runs the same content
+	digest, err := dockerservice.PushImage(ctx, *dockerOptions, logHandler)
+	if err != nil {
 		return err
 	}
+	dockerOptions.Digest = digest
+	logHandler(fmt.Sprintf("Image pushed as %s", dockerOptions.ImageRef()))
 
 	if err := dockerservice.Close(); err != nil {
 		return err
 	}
 
-	// Create a kubernetes client by the specified kubeconfig
-	config, err := clientcmd.BuildConfigFromFlags("", kubeOptions.Kubeconfig)
+	if len(targets) == 1 {
+		return applyKube(ctx, targets[0], defaultOptions, dockerOptions)
+	}
+	return applyClusters(ctx, targets, kubeOptions, defaultOptions, dockerOptions, logHandler)
+}
+
+// planKube connects to the cluster of the target and works out the deploy plan
+func planKube(ctx context.Context, target *kubeTarget, defaultOptions *DefaultOptions) error {
+	kubeOptions := target.options
+	logHandler := target.logHandler
+
+	// Create kubernetes clients by the specified kubeconfig
+	clientset, dynamicClient, err := newKubeClients(kubeOptions)
 	if err != nil {
 		return err
 	}
+	target.clientset = clientset
+	target.dynamicClient = dynamicClient
 
-	clientset, err := kubernetes.NewForConfig(config)
+	kubeOptions.DeploymentOptions.Name = defaultOptions.AppName
+	kubeOptions.DeploymentOptions.Namespace = kubeOptions.Namespace
+	kubeOptions.ServiceOptions.Name = defaultOptions.AppName
+	kubeOptions.ServiceOptions.Namespace = kubeOptions.Namespace
+	kubeOptions.ServiceOptions.TargetPort = kubeOptions.DeploymentOptions.Port
+	kubeOptions.StatefulSetOptions.ServiceName = kube.HeadlessServiceName(defaultOptions.AppName)
+	kubeOptions.StatefulSetOptions.PVCOptions = kubeOptions.PvcOptions
+	kubeOptions.StatefulSetOptions.DeploymentOptions = kubeOptions.DeploymentOptions
+	kubeOptions.PvcOptions.Name = defaultOptions.AppName
+	kubeOptions.PvcOptions.App = defaultOptions.AppName
+	kubeOptions.PvcOptions.Namespace = kubeOptions.Namespace
+	kubeOptions.HpaOptions.Name = defaultOptions.AppName
+	kubeOptions.HpaOptions.Namespace = kubeOptions.Namespace
+	kubeOptions.ResourceQuota.Name = defaultOptions.AppName
+	kubeOptions.ResourceQuota.Namespace = kubeOptions.Namespace
+	kubeOptions.LimitRange.Name = defaultOptions.AppName
+	kubeOptions.LimitRange.Namespace = kubeOptions.Namespace
+
+	// Check the cluster has what the deploy depends on before changing anything
+	if !kubeOptions.SkipPreflight {
+		if err := runPreflight(clientset, ctx, kubeOptions, defaultOptions.AppName, logHandler); err != nil {
+			return err
+		}
+	}
+
+	// Never modify resources of someone else unless they are explicitly adopted
+	if err := kube.CheckOwnership(clientset, dynamicClient, ctx, kube.OwnershipOptions{
+		App:       defaultOptions.AppName,
+		Namespace: kubeOptions.Namespace,
+		Adopt:     kubeOptions.Adopt,
+		Objects:   ownedObjects(kubeOptions, defaultOptions.AppName),
+	}, logHandler); err != nil {
+		return err
+	}
+
+	// Work out how live objects change before spending time on the build
+	plan, err := kube.BuildPlan(clientset, ctx, kube.PlanOptions{
+		Workload:           kubeOptions.Workload,
+		DeploymentOptions:  kubeOptions.DeploymentOptions,
+		StatefulSetOptions: kubeOptions.StatefulSetOptions,
+		PVCOptions:         kubeOptions.PvcOptions,
+		ConfirmDataLoss:    kubeOptions.ConfirmDataLoss,
+	})
 	if err != nil {
 		return err
 	}
+	plan.Print(logHandler)
+	target.plan = plan
+	return plan.Blocked()
+}
+
+// applyKube updates or creates kubernetes resource objects in the cluster of the target
+func applyKube(ctx context.Context, target *kubeTarget, defaultOptions *DefaultOptions, dockerOptions *docker.DockerOptions) error {
+	kubeOptions := target.options
+	clientset := target.clientset
+	dynamicClient := target.dynamicClient
+	plan := target.plan
+	logHandler := target.logHandler
 
 	// Update or create kubernetes resource objects
-	if err := kube.CreateOrUpdateNamespace(clientset, ctx, kubeOptions.Namespace, logHandler); err != nil {
+	if err := kube.CreateOrUpdateNamespace(clientset, ctx, kubeOptions.Namespace, defaultOptions.AppName, logHandler); err != nil {
 		return err
 	}
 
-	if err := kube.CreateOrUpdateDockerSecret(clientset, ctx, kube.DockerSecretOptions{
-		Name:          defaultOptions.AppName,
-		Namespace:     kubeOptions.Namespace,
-		DockerOptions: *dockerOptions,
-	}, logHandler); err != nil {
-		return err
+	// Forward warning events of the app, such as FailedScheduling and BackOff, while it is being deployed
+	stopEvents := kube.WatchEvents(clientset, ctx, defaultOptions.AppName, kubeOptions.Namespace, logHandler)
+	defer stopEvents()
+
+	// The route is needed up front to shift the traffic between the canary and the app service
+	kubeOptions.IngressOptions.Name = defaultOptions.AppName
+	kubeOptions.IngressOptions.Namespace = kubeOptions.Namespace
+	kubeOptions.RouteOptions.Name = defaultOptions.AppName
+	kubeOptions.RouteOptions.Namespace = kubeOptions.Namespace
+	kubeOptions.RouteOptions.Port = kubeOptions.ServiceOptions.Port
+	if len(kubeOptions.RouteOptions.Hostnames) == 0 {
+		kubeOptions.RouteOptions.Hostnames = []string{kubeOptions.IngressOptions.Host}
 	}
 
-	if err := kube.CreateOrUpdateServiceAccount(clientset, ctx, kube.ServiceAccountOptions{
-		Name:      defaultOptions.AppName,
-		Namespace: kubeOptions.Namespace,
-	}, logHandler); err != nil {
+	// A canary of an interrupted deploy would otherwise keep its share of the traffic
+	if err := removeLeftoverCanary(clientset, dynamicClient, ctx, kubeOptions, defaultOptions.AppName, logHandler); err != nil {
 		return err
 	}
 
-	if kubeOptions.DeploymentOptions.VolumeMount.Enabled {
-		kubeOptions.PvcOptions.Name = defaultOptions.AppName
-		kubeOptions.PvcOptions.Namespace = kubeOptions.Namespace
-		if err := kube.CreateOrUpdatePVC(clientset, ctx, kubeOptions.PvcOptions, logHandler); err != nil {
+	if kubeOptions.ResourceQuota.Enabled {
+		if err := kube.CreateOrUpdateResourceQuota(clientset, ctx, kubeOptions.ResourceQuota, logHandler); err != nil {
 			return err
 		}
 	} else {
-		kubeOptions.DeploymentOptions.Name = defaultOptions.AppName
-		kubeOptions.DeploymentOptions.Namespace = kubeOptions.Namespace
-		kubeOptions.DeploymentOptions.Image = dockerOptions.Image()
-		if err := kube.DeleteDeployment(clientset, ctx, kubeOptions.DeploymentOptions, logHandler); err != nil {
+		if err := kube.DeleteResourceQuota(clientset, ctx, kubeOptions.ResourceQuota, logHandler); err != nil {
 			return err
 		}
+	}
 
-		kubeOptions.HpaOptions.Name = defaultOptions.AppName
-		kubeOptions.HpaOptions.Namespace = kubeOptions.Namespace
-		if err := kube.DeletePVC(clientset, ctx, kubeOptions.HpaOptions, logHandler); err != nil {
+	if kubeOptions.LimitRange.Enabled {
+		if err := kube.CreateOrUpdateLimitRange(clientset, ctx, kubeOptions.LimitRange, logHandler); err != nil {
+			return err
+		}
+	} else {
+		if err := kube.DeleteLimitRange(clientset, ctx, kubeOptions.LimitRange, logHandler); err != nil {
 			return err
 		}
 	}
 
-	kubeOptions.DeploymentOptions.Name = defaultOptions.AppName
-	kubeOptions.DeploymentOptions.Namespace = kubeOptions.Namespace
-	kubeOptions.DeploymentOptions.Image = dockerOptions.Image()
-	if err := kube.CreateOrUpdateDeployment(clientset, ctx, kubeOptions.DeploymentOptions, logHandler); err != nil {
+	imagePullSecrets, err := syncPullSecrets(clientset, ctx, kubeOptions, defaultOptions, dockerOptions, logHandler)
+	if err != nil {
 		return err
 	}
 
-	kubeOptions.ServiceOptions.Name = defaultOptions.AppName
-	kubeOptions.ServiceOptions.Namespace = kubeOptions.Namespace
-	kubeOptions.ServiceOptions.TargetPort = kubeOptions.DeploymentOptions.Port
-	if err := kube.CreateOrUpdateService(clientset, ctx, kubeOptions.ServiceOptions, logHandler); err != nil {
+	// Without the app service account, pods run as the default one and reference the pull secrets themselves
+	if kubeOptions.ServiceAccountOptions.Enabled {
+		kubeOptions.ServiceAccountOptions.Name = defaultOptions.AppName
+		kubeOptions.ServiceAccountOptions.Namespace = kubeOptions.Namespace
+		kubeOptions.ServiceAccountOptions.ImagePullSecrets = imagePullSecrets
+		if err := kube.CreateOrUpdateServiceAccount(clientset, ctx, kubeOptions.ServiceAccountOptions, logHandler); err != nil {
+			return err
+		}
+		kubeOptions.DeploymentOptions.ServiceAccountName = defaultOptions.AppName
+	} else {
+		logHandler("serviceaccount skipped as it is disabled, pods run as the default service account")
+		kubeOptions.DeploymentOptions.ImagePullSecrets = imagePullSecrets
+	}
+
+	kubeOptions.DeploymentOptions.Image = dockerOptions.ImageRef()
+	kubeOptions.DeploymentOptions.Metrics = kubeOptions.Metrics
+	kubeOptions.DeploymentOptions.VolumeMount.ClaimName = plan.ClaimName
+	kubeOptions.PvcOptions.Name = plan.ClaimName
+	kubeOptions.StatefulSetOptions.DeploymentOptions = kubeOptions.DeploymentOptions
+	kubeOptions.DaemonSetOptions.DeploymentOptions = kubeOptions.DeploymentOptions
+
+	// Remember the running revision so that a failed post-deploy hook can roll back to it
+	previousTemplate, err := kube.GetPodTemplate(clientset, ctx, kubeOptions.Workload, defaultOptions.AppName, kubeOptions.Namespace)
+	if err != nil {
 		return err
 	}
 
-	kubeOptions.IngressOptions.Name = defaultOptions.AppName
-	kubeOptions.IngressOptions.Namespace = kubeOptions.Namespace
-	if err := kube.CreateOrUpdateIngress(clientset, ctx, kubeOptions.IngressOptions, logHandler); err != nil {
+	if kubeOptions.HookOptions.PreDeploy.Enabled {
+		if err := kube.RunHook(clientset, ctx, kube.HookPreDeploy, kubeOptions.HookOptions.PreDeploy, kubeOptions.DeploymentOptions, logHandler); err != nil {
+			return fmt.Errorf("pre-deploy hook failed, deploy aborted: %v", err)
+		}
+	}
+
+	canary, err := runCanary(clientset, dynamicClient, ctx, kubeOptions, previousTemplate, logHandler)
+	if err != nil {
+		return err
+	}
+
+	if err := recreateWorkload(clientset, ctx, kubeOptions, plan, logHandler); err != nil {
 		return err
 	}
 
-	if kubeOptions.HpaOptions.Enabled {
-		kubeOptions.HpaOptions.Name = defaultOptions.AppName
-		kubeOptions.HpaOptions.Namespace = kubeOptions.Namespace
+	switch kubeOptions.Workload {
+	case kube.WorkloadStatefulSet:
+		if err := kube.CreateOrUpdateHeadlessService(clientset, ctx, kubeOptions.ServiceOptions, logHandler); err != nil {
+			return err
+		}
+
+		if err := kube.CreateOrUpdateStatefulSet(clientset, ctx, kubeOptions.StatefulSetOptions, logHandler); err != nil {
+			return err
+		}
+
+		kubeOptions.HpaOptions.Kind = "StatefulSet"
+	case kube.WorkloadDaemonSet:
+		if kubeOptions.DeploymentOptions.VolumeMount.Enabled {
+			if err := kube.CreateOrUpdatePVC(clientset, ctx, kubeOptions.PvcOptions, logHandler); err != nil {
+				return err
+			}
+		} else {
+			if err := kube.DeletePVC(clientset, dynamicClient, ctx, kubeOptions.PvcOptions, kubeOptions.ConfirmDataLoss, logHandler); err != nil {
+				return err
+			}
+		}
+
+		if err := kube.CreateOrUpdateVolumePVCs(clientset, ctx, kubeOptions.DeploymentOptions, logHandler); err != nil {
+			return err
+		}
+
+		if err := kube.CreateOrUpdateDaemonSet(clientset, ctx, kubeOptions.DaemonSetOptions, logHandler); err != nil {
+			return err
+		}
+	default:
+		if kubeOptions.DeploymentOptions.VolumeMount.Enabled {
+			// Storage class and access mode of a PVC are immutable, so its data is copied to a new one
+			if change, ok := plan.Find(kube.KindPVC, plan.ClaimName); ok && change.Strategy == kube.StrategyMigrate {
+				claimName, err := kube.MigratePVC(clientset, ctx, kubeOptions.PvcOptions, defaultOptions.AppName, logHandler)
+				if err != nil {
+					return err
+				}
+				kubeOptions.PvcOptions.Name = claimName
+				kubeOptions.DeploymentOptions.VolumeMount.ClaimName = claimName
+			}
+
+			if err := kube.CreateOrUpdatePVC(clientset, ctx, kubeOptions.PvcOptions, logHandler); err != nil {
+				return err
+			}
+		} else {
+			if err := kube.DeletePVC(clientset, dynamicClient, ctx, kubeOptions.PvcOptions, kubeOptions.ConfirmDataLoss, logHandler); err != nil {
+				return err
+			}
+		}
+
+		if err := kube.CreateOrUpdateVolumePVCs(clientset, ctx, kubeOptions.DeploymentOptions, logHandler); err != nil {
+			return err
+		}
+
+		if err := kube.CreateOrUpdateDeployment(clientset, ctx, kubeOptions.DeploymentOptions, logHandler); err != nil {
+			return err
+		}
+
+		if canary {
+			if err := promoteCanary(clientset, dynamicClient, ctx, kubeOptions, logHandler); err != nil {
+				return err
+			}
+		}
+
+		kubeOptions.HpaOptions.Kind = "Deployment"
+	}
+
+	if kubeOptions.Metrics.Enabled && kube.MetricsPortName(kubeOptions.Metrics, kubeOptions.DeploymentOptions.Port) == "metrics" {
+		kubeOptions.ServiceOptions.MetricsPort = kubeOptions.Metrics.Port
+	}
+	if kubeOptions.ServiceOptions.Enabled {
+		if err := kube.CreateOrUpdateService(clientset, ctx, kubeOptions.ServiceOptions, logHandler); err != nil {
+			return err
+		}
+	} else {
+		logHandler("service skipped as it is disabled")
+	}
+
+	// Scraped by prometheus-operator as soon as the deploy finishes
+	if kubeOptions.Metrics.Enabled && kubeOptions.Metrics.Monitor != "" {
+		kubeOptions.Metrics.Name = defaultOptions.AppName
+		kubeOptions.Metrics.Namespace = kubeOptions.Namespace
+		if err := kube.CreateOrUpdateMonitor(dynamicClient, ctx, kubeOptions.Metrics, kubeOptions.DeploymentOptions.Port, logHandler); err != nil {
+			return err
+		}
+	}
+
+	// Superseded workloads keep serving until the new one is ready to take over
+	if err := removeReplacedWorkloads(clientset, ctx, kubeOptions, plan, logHandler); err != nil {
+		return err
+	}
+
+	// Node agents are neither exposed through ingress nor scaled horizontally
+	if kubeOptions.Workload == kube.WorkloadDaemonSet {
+		logHandler("ingress skipped for daemonset workload")
+	} else if kubeOptions.Routing == kube.RoutingGateway {
+		if err := kube.CreateOrUpdateRoute(dynamicClient, ctx, kubeOptions.RouteOptions, logHandler); err != nil {
+			return err
+		}
+
+		// The route takes over the traffic, so an ingress left over from the ingress routing is removed
+		if err := kube.DeleteIngress(clientset, ctx, kubeOptions.IngressOptions, logHandler); err != nil {
+			return err
+		}
+	} else if kubeOptions.IngressOptions.Enabled {
+		if err := kube.CreateOrUpdateIngress(clientset, dynamicClient, ctx, kubeOptions.IngressOptions, logHandler); err != nil {
+			return err
+		}
+	} else {
+		logHandler("ingress skipped as it is disabled")
+	}
+
+	if kubeOptions.HpaOptions.Enabled && kubeOptions.Workload != kube.WorkloadDaemonSet {
 		if err := kube.CreateOrUpdateHPA(clientset, ctx, kubeOptions.HpaOptions, logHandler); err != nil {
 			return err
 		}
 	} else {
-		kubeOptions.HpaOptions.Name = defaultOptions.AppName
-		kubeOptions.HpaOptions.Namespace = kubeOptions.Namespace
+		if kubeOptions.HpaOptions.Enabled {
+			logHandler("hpa skipped for daemonset workload")
+		}
 		if err := kube.DeleteHPA(clientset, ctx, kubeOptions.HpaOptions, logHandler); err != nil {
 			return err
 		}
 	}
 
+	if kubeOptions.HookOptions.PostDeploy.Enabled {
+		if err := runPostDeployHook(clientset, ctx, kubeOptions, previousTemplate, logHandler); err != nil {
+			return err
+		}
+	}
+
+	// Objects left over from components that were turned off are deleted once the app is up
+	if kubeOptions.Prune {
+		if _, err := kube.Prune(clientset, dynamicClient, ctx, kube.PruneOptions{
+			App:       defaultOptions.AppName,
+			Namespace: kubeOptions.Namespace,
+			Keep:      desiredObjects(kubeOptions, defaultOptions.AppName),
+		}, logHandler); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ownedObjects lists the resources named after the app that the deploy creates, updates or deletes
+func ownedObjects(kubeOptions *KubeOptions, appName string) []kube.OwnedObject {
+	objects := []kube.OwnedObject{
+		{Kind: kubeOptions.Workload, Name: appName},
+		{Kind: kube.KindSecret, Name: kube.DockerSecretName(appName)},
+		{Kind: kube.KindIngress, Name: appName},
+		{Kind: kube.KindHPA, Name: appName},
+		{Kind: kube.KindPVC, Name: kubeOptions.PvcOptions.Name},
+		// Created when enabled and deleted otherwise
+		{Kind: kube.KindResourceQuota, Name: appName},
+		{Kind: kube.KindLimitRange, Name: appName},
+	}
+	for _, volume := range kubeOptions.DeploymentOptions.Volumes {
+		if strings.ToLower(volume.Type) == kube.VolumeTypePVC {
+			objects = append(objects, kube.OwnedObject{Kind: kube.KindPVC, Name: kube.VolumePVCName(appName, volume)})
+		}
+	}
+	if kubeOptions.Workload == kube.WorkloadStatefulSet {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindService, Name: kube.HeadlessServiceName(appName)})
+	}
+	if kubeOptions.ServiceOptions.Enabled {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindService, Name: appName})
+	}
+	if kubeOptions.ServiceAccountOptions.Enabled {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindServiceAccount, Name: appName})
+	}
+	ingress := kubeOptions.Routing != kube.RoutingGateway && kubeOptions.IngressOptions.Enabled
+	if ingress && kubeOptions.IngressOptions.TLS {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindSecret, Name: kube.TLSSecretName(appName)})
+	}
+	if ingress && len(kubeOptions.IngressOptions.AuthUsers) > 0 {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindSecret, Name: kube.BasicAuthSecretName(appName)})
+	}
+	if ingress && kubeOptions.IngressOptions.Controller == kube.IngressControllerTraefik {
+		ingressOptions := kubeOptions.IngressOptions
+		ingressOptions.Name = appName
+		for _, name := range kube.TraefikMiddlewareNames(ingressOptions) {
+			objects = append(objects, kube.OwnedObject{Kind: kube.KindMiddleware, Name: name})
+		}
+	}
+	if kubeOptions.Routing == kube.RoutingGateway {
+		objects = append(objects, kube.OwnedObject{Kind: kubeOptions.RouteOptions.Kind + "route", Name: appName})
+	}
+	if kubeOptions.Metrics.Enabled && kubeOptions.Metrics.Monitor != "" {
+		objects = append(objects, kube.OwnedObject{Kind: kubeOptions.Metrics.Monitor, Name: appName})
+	}
+	if kubeOptions.Canary.Enabled && kubeOptions.Workload == kube.WorkloadDeployment {
+		canaryName := kube.CanaryName(appName)
+		objects = append(objects,
+			kube.OwnedObject{Kind: kube.WorkloadDeployment, Name: canaryName},
+			kube.OwnedObject{Kind: kube.KindService, Name: canaryName},
+		)
+		if kubeOptions.Routing != kube.RoutingGateway {
+			objects = append(objects, kube.OwnedObject{Kind: kube.KindIngress, Name: canaryName})
+		}
+	}
+	return objects
+}
+
+// desiredObjects lists the objects labeled for the app that the deploy keeps, the others labeled for it are pruned
+func desiredObjects(kubeOptions *KubeOptions, appName string) []kube.OwnedObject {
+	objects := []kube.OwnedObject{{Kind: kubeOptions.Workload, Name: appName}}
+	if kubeOptions.Workload == kube.WorkloadStatefulSet {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindService, Name: kube.HeadlessServiceName(appName)})
+	}
+	if kubeOptions.ServiceOptions.Enabled {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindService, Name: appName})
+	}
+	if kubeOptions.ServiceAccountOptions.Enabled {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindServiceAccount, Name: appName})
+	}
+	if !kubeOptions.PullSecrets.Public {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindSecret, Name: kube.DockerSecretName(appName)})
+	}
+
+	// Node agents are neither exposed nor scaled horizontally
+	if kubeOptions.Workload != kube.WorkloadDaemonSet {
+		if kubeOptions.Routing == kube.RoutingGateway {
+			objects = append(objects, kube.OwnedObject{Kind: kubeOptions.RouteOptions.Kind + "route", Name: appName})
+		} else if kubeOptions.IngressOptions.Enabled {
+			objects = append(objects, kube.OwnedObject{Kind: kube.KindIngress, Name: appName})
+			if kubeOptions.IngressOptions.TLS {
+				objects = append(objects, kube.OwnedObject{Kind: kube.KindSecret, Name: kube.TLSSecretName(appName)})
+			}
+			if len(kubeOptions.IngressOptions.AuthUsers) > 0 {
+				objects = append(objects, kube.OwnedObject{Kind: kube.KindSecret, Name: kube.BasicAuthSecretName(appName)})
+			}
+			if kubeOptions.IngressOptions.Controller == kube.IngressControllerTraefik {
+				ingressOptions := kubeOptions.IngressOptions
+				ingressOptions.Name = appName
+				for _, name := range kube.TraefikMiddlewareNames(ingressOptions) {
+					objects = append(objects, kube.OwnedObject{Kind: kube.KindMiddleware, Name: name})
+				}
+			}
+		}
+		if kubeOptions.HpaOptions.Enabled {
+			objects = append(objects, kube.OwnedObject{Kind: kube.KindHPA, Name: appName})
+		}
+	}
+
+	if kubeOptions.Metrics.Enabled && kubeOptions.Metrics.Monitor != "" {
+		objects = append(objects, kube.OwnedObject{Kind: kubeOptions.Metrics.Monitor, Name: appName})
+	}
+	if kubeOptions.ResourceQuota.Enabled {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindResourceQuota, Name: appName})
+	}
+	if kubeOptions.LimitRange.Enabled {
+		objects = append(objects, kube.OwnedObject{Kind: kube.KindLimitRange, Name: appName})
+	}
+	return objects
+}
+
+// syncPullSecrets creates or removes the app docker secret and returns the pull secrets of the app service account
+func syncPullSecrets(clientset kubernetes.Interface, ctx context.Context, kubeOptions *KubeOptions, defaultOptions *DefaultOptions, dockerOptions *docker.DockerOptions, logHandler func(msg string)) ([]string, error) {
+	secretOptions := kube.DockerSecretOptions{
+		Name:          defaultOptions.AppName,
+		Namespace:     kubeOptions.Namespace,
+		Registries:    kubeOptions.PullSecrets.Registries,
+		DockerOptions: *dockerOptions,
+	}
+
+	var imagePullSecrets []string
+	if kubeOptions.PullSecrets.Public {
+		if err := kube.DeleteDockerSecret(clientset, ctx, secretOptions, logHandler); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := kube.CreateOrUpdateDockerSecret(clientset, ctx, secretOptions, logHandler); err != nil {
+			return nil, err
+		}
+		imagePullSecrets = append(imagePullSecrets, kube.DockerSecretName(defaultOptions.AppName))
+	}
+
+	if err := kube.CheckPullSecrets(clientset, ctx, kubeOptions.PullSecrets.Existing, kubeOptions.Namespace); err != nil {
+		return nil, err
+	}
+	for _, name := range kubeOptions.PullSecrets.Existing {
+		if !helpers.Contains(imagePullSecrets, name) {
+			imagePullSecrets = append(imagePullSecrets, name)
+		}
+	}
+
+	return imagePullSecrets, nil
+}
+
+// parseRegistries parses registry flags in the form of registry=ghcr.io,username=user,password=token
+func parseRegistries(specs []string) ([]kube.RegistryCredential, error) {
+	var registries []kube.RegistryCredential
+	for _, spec := range specs {
+		values, err := helpers.ParseKeyValues(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid registry '%s': %v", spec, err)
+		}
+
+		var registry kube.RegistryCredential
+		for key, value := range values {
+			switch key {
+			case "registry":
+				registry.Registry = value
+			case "username":
+				registry.Username = value
+			case "password":
+				registry.Password = value
+			default:
+				return nil, fmt.Errorf("unknown key '%s' of registry '%s'", key, registry.Registry)
+			}
+		}
+		if helpers.IsBlank(registry.Registry) || helpers.IsBlank(registry.Username) || helpers.IsBlank(registry.Password) {
+			return nil, fmt.Errorf("registry, username and password of registry '%s' are required", registry.Registry)
+		}
+		registries = append(registries, registry)
+	}
+	return registries, nil
+}
+
+// parseRouteBackends parses route backend flags in the form of service=hellogo-canary,port=8000,weight=10
+func parseRouteBackends(specs []string) ([]kube.RouteBackend, error) {
+	var backends []kube.RouteBackend
+	for _, spec := range specs {
+		values, err := helpers.ParseKeyValues(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route backend '%s': %v", spec, err)
+		}
+
+		var backend kube.RouteBackend
+		for key, value := range values {
+			switch key {
+			case "service":
+				backend.Service = value
+			case "port", "weight":
+				number, err := strconv.ParseInt(value, 10, 32)
+				if err != nil || number < 0 {
+					return nil, fmt.Errorf("invalid %s of route backend '%s'", key, spec)
+				}
+				if key == "port" {
+					backend.Port = int32(number)
+				} else {
+					weight := int32(number)
+					backend.Weight = &weight
+				}
+			default:
+				return nil, fmt.Errorf("unknown key '%s' of route backend '%s'", key, spec)
+			}
+		}
+		backends = append(backends, backend)
+	}
+	return backends, nil
+}
+
+// parseCanarySteps parses the traffic percentages of the canary steps, each of which may hold several comma separated ones as read from the config file
+func parseCanarySteps(specs []string) ([]int32, error) {
+	var steps []int32
+	for _, spec := range specs {
+		for _, value := range strings.Split(spec, ",") {
+			if helpers.IsBlank(value) {
+				continue
+			}
+			step, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid canary step '%s'", value)
+			}
+			steps = append(steps, int32(step))
+		}
+	}
+	return steps, nil
+}
+
+// runCanary rolls out the new image as a canary through the steps of traffic weights before the app deployment is updated.
+// The first deploy has no running version to compare with, so it goes straight to the app deployment
+func runCanary(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, kubeOptions *KubeOptions, previousTemplate *corev1.PodTemplateSpec, logHandler func(msg string)) (bool, error) {
+	if !kubeOptions.Canary.Enabled {
+		return false, nil
+	}
+	if previousTemplate == nil {
+		logHandler("canary skipped as no version of the app is running yet")
+		return false, nil
+	}
+
+	kubeOptions.Canary.Name = kubeOptions.DeploymentOptions.Name
+	kubeOptions.Canary.Namespace = kubeOptions.Namespace
+	kubeOptions.Canary.Routing = kubeOptions.Routing
+	kubeOptions.Canary.RouteOptions = kubeOptions.RouteOptions
+	kubeOptions.Canary.DeploymentOptions = kubeOptions.DeploymentOptions
+	kubeOptions.Canary.ServicePort = kubeOptions.ServiceOptions.Port
+	if err := kube.RunCanary(clientset, dynamicClient, ctx, kubeOptions.Canary, logHandler); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removeLeftoverCanary moves the traffic back to the app and removes the canary left over by an interrupted deploy
+func removeLeftoverCanary(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, kubeOptions *KubeOptions, appName string, logHandler func(msg string)) error {
+	exists, err := kube.CanaryExists(clientset, ctx, appName, kubeOptions.Namespace)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	logHandler(fmt.Sprintf("canary %s left over by an interrupted deploy, removing it", kube.CanaryName(appName)))
+	canary := kubeOptions.Canary
+	canary.Name = appName
+	canary.Namespace = kubeOptions.Namespace
+	canary.Routing = kubeOptions.Routing
+	canary.RouteOptions = kubeOptions.RouteOptions
+	return kube.DeleteCanary(clientset, dynamicClient, ctx, canary, logHandler)
+}
+
+// promoteCanary waits for the updated app deployment to roll out, then moves the traffic back to it and removes the canary
+func promoteCanary(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, kubeOptions *KubeOptions, logHandler func(msg string)) error {
+	rolloutCtx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+	defer cancel()
+	if err := kube.WaitForRollout(clientset, rolloutCtx, kube.WorkloadDeployment, kubeOptions.DeploymentOptions.Name, kubeOptions.Namespace, logHandler); err != nil {
+		return fmt.Errorf("canary kept serving as the promoted deployment failed to roll out: %v", err)
+	}
+	return kube.DeleteCanary(clientset, dynamicClient, ctx, kubeOptions.Canary, logHandler)
+}
+
+func runPostDeployHook(clientset kubernetes.Interface, ctx context.Context, kubeOptions *KubeOptions, previousTemplate *corev1.PodTemplateSpec, logHandler func(msg string)) error {
+	name := kubeOptions.DeploymentOptions.Name
+	namespace := kubeOptions.Namespace
+
+	rolloutCtx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+	defer cancel()
+	err := kube.WaitForRollout(clientset, rolloutCtx, kubeOptions.Workload, name, namespace, logHandler)
+	if err == nil {
+		err = kube.RunHook(clientset, ctx, kube.HookPostDeploy, kubeOptions.HookOptions.PostDeploy, kubeOptions.DeploymentOptions, logHandler)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if kubeOptions.HookOptions.Rollback {
+		if rollbackErr := kube.RollbackPodTemplate(clientset, ctx, kubeOptions.Workload, name, namespace, previousTemplate, logHandler); rollbackErr != nil {
+			return fmt.Errorf("post-deploy hook failed: %v, %v", err, rollbackErr)
+		}
+	}
+	return fmt.Errorf("post-deploy hook failed: %v", err)
+}
+
+// parseVolumes parses volume flags in the form of name=data,type=pvc,mountpath=/data,storagesize=1Gi
+func parseVolumes(specs []string) ([]kube.Volume, error) {
+	var volumes []kube.Volume
+	for _, spec := range specs {
+		values, err := helpers.ParseKeyValues(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume '%s': %v", spec, err)
+		}
+
+		var volume kube.Volume
+		for key, value := range values {
+			switch key {
+			case "name":
+				volume.Name = value
+			case "type":
+				volume.Type = value
+			case "mountpath":
+				volume.MountPath = value
+			case "subpath":
+				volume.SubPath = value
+			case "readonly":
+				if volume.ReadOnly, err = strconv.ParseBool(value); err != nil {
+					return nil, fmt.Errorf("invalid readonly of volume '%s': %v", spec, err)
+				}
+			case "accessmode":
+				volume.AccessMode = value
+			case "storageclassname":
+				volume.StorageClassName = value
+			case "storagesize":
+				volume.StorageSize = value
+			case "medium":
+				volume.Medium = value
+			case "sizelimit":
+				volume.SizeLimit = value
+			case "claimname":
+				volume.ClaimName = value
+			case "server":
+				volume.Server = value
+			case "path":
+				volume.Path = value
+			case "configmapname":
+				volume.ConfigMapName = value
+			case "secretname":
+				volume.SecretName = value
+			default:
+				return nil, fmt.Errorf("unknown key '%s' of volume '%s'", key, spec)
+			}
+		}
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
+
+// recreateWorkload makes way for a workload whose immutable fields changed
+func recreateWorkload(clientset kubernetes.Interface, ctx context.Context, kubeOptions *KubeOptions, plan *kube.Plan, logHandler func(msg string)) error {
+	name := kubeOptions.DeploymentOptions.Name
+	change, ok := plan.Find(kubeOptions.Workload, name)
+	if !ok || change.Action != kube.ActionRecreate {
+		return nil
+	}
+
+	switch change.Strategy {
+	case kube.StrategyOrphan:
+		return kube.OrphanWorkload(clientset, ctx, kubeOptions.Workload, name, kubeOptions.Namespace, logHandler)
+	case kube.StrategySurge:
+		surgeCtx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+		defer cancel()
+		return kube.SurgeDeployment(clientset, surgeCtx, name, kubeOptions.Namespace, logHandler)
+	}
+	return nil
+}
+
+// removeReplacedWorkloads waits for the new workload to roll out, then deletes the ones it replaces
+func removeReplacedWorkloads(clientset kubernetes.Interface, ctx context.Context, kubeOptions *KubeOptions, plan *kube.Plan, logHandler func(msg string)) error {
+	name := kubeOptions.DeploymentOptions.Name
+	namespace := kubeOptions.Namespace
+
+	rolledOut := false
+	for _, change := range plan.Changes {
+		if change.Strategy != kube.StrategyReplace && change.Strategy != kube.StrategySurge {
+			continue
+		}
+
+		if !rolledOut {
+			rolloutCtx, cancel := context.WithTimeout(ctx, rolloutTimeout)
+			err := kube.WaitForRollout(clientset, rolloutCtx, kubeOptions.Workload, name, namespace, logHandler)
+			cancel()
+			if err != nil {
+				return err
+			}
+			rolledOut = true
+		}
+
+		var err error
+		switch {
+		case change.Strategy == kube.StrategySurge:
+			err = kube.DeleteSurgeDeployment(clientset, ctx, name, namespace, logHandler)
+		case change.Kind == kube.WorkloadStatefulSet:
+			err = kube.DeleteStatefulSet(clientset, ctx, kubeOptions.StatefulSetOptions, logHandler)
+		case change.Kind == kube.WorkloadDaemonSet:
+			err = kube.DeleteDaemonSet(clientset, ctx, kubeOptions.DaemonSetOptions, logHandler)
+		default:
+			err = kube.DeleteDeployment(clientset, ctx, kubeOptions.DeploymentOptions, logHandler)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -285,27 +1153,257 @@ func setDockerOptions(dockerOptions *docker.DockerOptions, defaultOptions *Defau
 		dockerOptions.Repository = fmt.Sprintf("%s/%s", dockerOptions.Username, defaultOptions.AppName)
 	}
 
+	dockerOptions.TagStrategy = strings.ToLower(dockerOptions.TagStrategy)
+	if helpers.IsBlank(dockerOptions.TagStrategy) {
+		dockerOptions.TagStrategy = docker.TagStrategyExplicit
+	}
+	if !helpers.Contains([]string{docker.TagStrategyExplicit, docker.TagStrategyGitSHA, docker.TagStrategyTimestamp, docker.TagStrategySemver}, dockerOptions.TagStrategy) {
+		return fmt.Errorf("unsupported tag strategy: %s", dockerOptions.TagStrategy)
+	}
+
 	return nil
 }
 
-func setKubeOptions(kubeOptions *KubeOptions, defaultOptions *DefaultOptions) error {
-	kubeOptions.Kubeconfig = helpers.ExpandUser(kubeOptions.Kubeconfig)
-	exist, err := helpers.IsFileExist(kubeOptions.Kubeconfig)
+// newKubeClients creates a typed and a dynamic kubernetes client by the specified kubeconfig,
+// falling back to the service account when running inside a cluster
+func newKubeClients(kubeOptions *KubeOptions) (kubernetes.Interface, dynamic.Interface, error) {
+	config, err := newKubeRestConfig(kubeOptions)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
-	if !exist {
-		return fmt.Errorf("kubeconfig does not exist")
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	return clientset, dynamicClient, nil
+}
+
+func newKubeRestConfig(kubeOptions *KubeOptions) (*rest.Config, error) {
+	return kube.NewRestConfig(kube.ClientOptions{
+		Kubeconfig:     kubeOptions.Kubeconfig,
+		KubeconfigData: kubeOptions.KubeconfigData,
+		Context:        kubeOptions.Context,
+		Token:          kubeOptions.Token,
+	})
+}
+
+// setKubeClusterOptions checks the options needed to talk to the cluster, shared by kube and its sub commands
+func setKubeClusterOptions(kubeOptions *KubeOptions, appName string) error {
+	// Whether the kubeconfig exists is checked when the client is created, as it may be inline or in-cluster
+	kubeOptions.Kubeconfig = helpers.ExpandUser(kubeOptions.Kubeconfig)
+
 	if helpers.IsBlank(kubeOptions.Namespace) {
-		kubeOptions.Namespace = defaultOptions.AppName
+		kubeOptions.Namespace = appName
+	}
+	if helpers.IsBlank(kubeOptions.Namespace) {
+		return fmt.Errorf("kube.namespace is required")
+	}
+
+	return nil
+}
+
+// setMetricsOptions checks the prometheus metrics options
+func setMetricsOptions(kubeOptions *KubeOptions) error {
+	kubeOptions.Metrics.Monitor = strings.ToLower(kubeOptions.Metrics.Monitor)
+	if !kubeOptions.Metrics.Enabled {
+		return nil
+	}
+
+	if !helpers.Contains([]string{"", kube.MonitorServiceMonitor, kube.MonitorPodMonitor}, kubeOptions.Metrics.Monitor) {
+		return fmt.Errorf("unsupported metrics monitor: %s", kubeOptions.Metrics.Monitor)
+	}
+	if kubeOptions.Metrics.Port < 0 {
+		return fmt.Errorf("kube.metrics.port must not be negative")
+	}
+	if helpers.IsBlank(kubeOptions.Metrics.Path) {
+		kubeOptions.Metrics.Path = "/metrics"
+	}
+	kubeOptions.Metrics.Scheme = strings.ToLower(kubeOptions.Metrics.Scheme)
+	if helpers.IsBlank(kubeOptions.Metrics.Scheme) {
+		kubeOptions.Metrics.Scheme = "http"
+	}
+	return nil
+}
+
+// setIngressOptions checks the ingress controller and the access control translated for it
+func setIngressOptions(kubeOptions *KubeOptions) error {
+	kubeOptions.IngressOptions.Controller = strings.ToLower(kubeOptions.IngressOptions.Controller)
+	if helpers.IsBlank(kubeOptions.IngressOptions.Controller) {
+		kubeOptions.IngressOptions.Controller = kube.IngressControllerNginx
+	}
+	return kube.ValidateIngressProtection(kubeOptions.IngressOptions)
+}
+
+// setRouteOptions checks how app is exposed and the gateway route options
+func setRouteOptions(kubeOptions *KubeOptions) error {
+	kubeOptions.Routing = strings.ToLower(kubeOptions.Routing)
+	if helpers.IsBlank(kubeOptions.Routing) {
+		kubeOptions.Routing = kube.RoutingIngress
+	}
+	if !helpers.Contains([]string{kube.RoutingIngress, kube.RoutingGateway}, kubeOptions.Routing) {
+		return fmt.Errorf("unsupported routing: %s", kubeOptions.Routing)
+	}
+	if kubeOptions.Routing != kube.RoutingGateway {
+		return nil
+	}
+
+	kubeOptions.RouteOptions.Kind = strings.ToLower(kubeOptions.RouteOptions.Kind)
+	if helpers.IsBlank(kubeOptions.RouteOptions.Kind) {
+		kubeOptions.RouteOptions.Kind = kube.RouteKindHTTP
+	}
+	if !helpers.Contains([]string{kube.RouteKindHTTP, kube.RouteKindGRPC}, kubeOptions.RouteOptions.Kind) {
+		return fmt.Errorf("unsupported route kind: %s", kubeOptions.RouteOptions.Kind)
+	}
+	if helpers.IsBlank(kubeOptions.RouteOptions.Gateway) {
+		return fmt.Errorf("kube.route.gateway is required")
+	}
+	return nil
+}
+
+// setCanaryOptions checks that the canary can share the traffic with the app, which needs a deployment exposed through nginx ingress or a gateway route
+func setCanaryOptions(kubeOptions *KubeOptions) error {
+	canary := &kubeOptions.Canary
+	if !canary.Enabled {
+		return nil
+	}
+	if kubeOptions.Workload != kube.WorkloadDeployment {
+		return fmt.Errorf("canary is only supported by deployment workload")
+	}
+	if kubeOptions.DeploymentOptions.VolumeMount.Enabled {
+		return fmt.Errorf("canary does not support kube.deployment.volumemount, its pods cannot share the app pvc")
+	}
+	if kubeOptions.Routing == kube.RoutingGateway {
+		if len(kubeOptions.RouteOptions.Backends) > 0 {
+			return fmt.Errorf("canary sets the route backends itself, remove kube.route.backends")
+		}
+	} else if !kubeOptions.IngressOptions.Enabled || kubeOptions.IngressOptions.Controller != kube.IngressControllerNginx {
+		return fmt.Errorf("canary needs kube.routing=gateway or an enabled ingress of the nginx controller")
+	}
+
+	if len(canary.Steps) == 0 {
+		return fmt.Errorf("kube.canary.steps is required")
+	}
+	for i, step := range canary.Steps {
+		if step <= 0 || step > 100 || (i > 0 && step <= canary.Steps[i-1]) {
+			return fmt.Errorf("kube.canary.steps must be increasing percentages between 1 and 100, got %v", canary.Steps)
+		}
+	}
+	if canary.Replicas <= 0 {
+		return fmt.Errorf("kube.canary.replicas must be greater than 0")
+	}
+	if canary.PauseSeconds < 0 {
+		return fmt.Errorf("kube.canary.pauseseconds must not be negative")
+	}
+	for _, query := range canary.Queries {
+		if helpers.IsBlank(query.Name) || helpers.IsBlank(query.Query) {
+			return fmt.Errorf("name and query of canary queries are required")
+		}
+		if query.Op != "<" && query.Op != ">" {
+			return fmt.Errorf("unsupported op '%s' of canary query %s, expected < or >", query.Op, query.Name)
+		}
+	}
+	if len(canary.Queries) > 0 && helpers.IsBlank(canary.PrometheusURL) {
+		return fmt.Errorf("kube.canary.prometheusurl is required to run the canary queries")
+	}
+	return nil
+}
+
+func setKubeOptions(kubeOptions *KubeOptions, defaultOptions *DefaultOptions) error {
+	if err := setKubeClusterOptions(kubeOptions, defaultOptions.AppName); err != nil {
+		return err
+	}
+
+	kubeOptions.Workload = strings.ToLower(kubeOptions.Workload)
+	if helpers.IsBlank(kubeOptions.Workload) {
+		kubeOptions.Workload = kube.WorkloadDeployment
+	}
+	if !helpers.Contains([]string{kube.WorkloadDeployment, kube.WorkloadStatefulSet, kube.WorkloadDaemonSet}, kubeOptions.Workload) {
+		return fmt.Errorf("unsupported workload: %s", kubeOptions.Workload)
+	}
+
+	kubeOptions.PvcOptions.RetentionPolicy = strings.ToLower(kubeOptions.PvcOptions.RetentionPolicy)
+	if helpers.IsBlank(kubeOptions.PvcOptions.RetentionPolicy) {
+		kubeOptions.PvcOptions.RetentionPolicy = kube.RetentionPolicyRetain
+	}
+	if !helpers.Contains([]string{kube.RetentionPolicyRetain, kube.RetentionPolicyDelete}, kubeOptions.PvcOptions.RetentionPolicy) {
+		return fmt.Errorf("unsupported pvc retention policy: %s", kubeOptions.PvcOptions.RetentionPolicy)
+	}
+
+	if err := setRouteOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	kubeOptions.FailurePolicy = strings.ToLower(kubeOptions.FailurePolicy)
+	if err := setClusterOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	if err := setMetricsOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	kubeOptions.DeploymentOptions.Strategy = strings.ToLower(kubeOptions.DeploymentOptions.Strategy)
+	if helpers.IsBlank(kubeOptions.DeploymentOptions.Strategy) {
+		kubeOptions.DeploymentOptions.Strategy = kube.UpdateStrategyRollingUpdate
+	}
+	if !helpers.Contains([]string{kube.UpdateStrategyRollingUpdate, kube.UpdateStrategyRecreate}, kubeOptions.DeploymentOptions.Strategy) {
+		return fmt.Errorf("unsupported deployment strategy: %s", kubeOptions.DeploymentOptions.Strategy)
+	}
+	if kubeOptions.DeploymentOptions.Strategy == kube.UpdateStrategyRecreate && kubeOptions.Workload != kube.WorkloadDeployment {
+		return fmt.Errorf("recreate strategy is only supported by deployment workload")
+	}
+
+	kubeOptions.DeploymentOptions.ImagePullPolicy = strings.ToLower(kubeOptions.DeploymentOptions.ImagePullPolicy)
+	if helpers.IsBlank(kubeOptions.DeploymentOptions.ImagePullPolicy) {
+		kubeOptions.DeploymentOptions.ImagePullPolicy = kube.PullPolicyIfNotPresent
+	}
+	if !helpers.Contains([]string{kube.PullPolicyAlways, kube.PullPolicyIfNotPresent, kube.PullPolicyNever}, kubeOptions.DeploymentOptions.ImagePullPolicy) {
+		return fmt.Errorf("unsupported image pull policy: %s", kubeOptions.DeploymentOptions.ImagePullPolicy)
+	}
+
+	if kubeOptions.ResourceQuota.Enabled && len(kubeOptions.ResourceQuota.Hard) == 0 {
+		return fmt.Errorf("kube.resourcequota.hard is required")
+	}
+
+	if kubeOptions.HookOptions.PreDeploy.Enabled && helpers.IsBlank(kubeOptions.HookOptions.PreDeploy.Command) {
+		return fmt.Errorf("kube.hooks.predeploy.command is required")
+	}
+	if kubeOptions.HookOptions.PostDeploy.Enabled && helpers.IsBlank(kubeOptions.HookOptions.PostDeploy.Command) {
+		return fmt.Errorf("kube.hooks.postdeploy.command is required")
 	}
 
 	if helpers.IsBlank(kubeOptions.IngressOptions.Host) {
 		kubeOptions.IngressOptions.Host = fmt.Sprintf("%s.com", defaultOptions.AppName)
 	}
 
+	if err := setIngressOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	// The ingress, the route and the servicemonitor all point at the app service
+	if !kubeOptions.ServiceOptions.Enabled {
+		if kubeOptions.Workload != kube.WorkloadDaemonSet && kubeOptions.Routing == kube.RoutingGateway {
+			return fmt.Errorf("kube.routing=gateway requires kube.service.enabled")
+		}
+		if kubeOptions.Workload != kube.WorkloadDaemonSet && kubeOptions.IngressOptions.Enabled {
+			return fmt.Errorf("kube.ingress.enabled requires kube.service.enabled, disable the ingress as well")
+		}
+		if kubeOptions.Metrics.Enabled && kubeOptions.Metrics.Monitor == kube.MonitorServiceMonitor {
+			return fmt.Errorf("kube.metrics.monitor=servicemonitor requires kube.service.enabled, use podmonitor instead")
+		}
+	}
+
+	if err := setCanaryOptions(kubeOptions); err != nil {
+		return err
+	}
+
 	if kubeOptions.IngressOptions.TLS && !kubeOptions.IngressOptions.SelfSigned {
 		if helpers.IsBlank(kubeOptions.IngressOptions.CrtPath) {
 			return fmt.Errorf("crt path does not exist")
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/guobinqiu/appdeployer/docker"
+	"github.com/guobinqiu/appdeployer/helpers"
+	"github.com/guobinqiu/appdeployer/kube"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	FailurePolicyContinue = "continue"
+	FailurePolicyFailFast = "failfast"
+)
+
+// ClusterOptions describes one of the clusters the app is deployed to, overriding the shared kube options
+type ClusterOptions struct {
+	Name             string `form:"name" json:"name"`
+	Kubeconfig       string `form:"kubeconfig" json:"kubeconfig"`
+	Context          string `form:"context" json:"context"`
+	Replicas         int32  `form:"replicas" json:"replicas"`
+	IngressHost      string `form:"ingresshost" json:"ingresshost"`
+	StorageClassName string `form:"storageclassname" json:"storageclassname"`
+}
+
+// kubeTarget holds the options and clients for deploying to one cluster
+type kubeTarget struct {
+	name          string
+	options       *KubeOptions
+	clientset     kubernetes.Interface
+	dynamicClient dynamic.Interface
+	plan          *kube.Plan
+	logHandler    func(msg string)
+}
+
+type clusterResult struct {
+	name     string
+	status   string
+	err      error
+	duration time.Duration
+}
+
+// newKubeTargets returns a target per cluster, or a single target for the shared kube options when no cluster is listed
+func newKubeTargets(kubeOptions *KubeOptions, logHandler func(msg string)) ([]*kubeTarget, error) {
+	if len(kubeOptions.Clusters) == 0 {
+		return []*kubeTarget{{
+			options:    kubeOptions,
+			logHandler: logHandler,
+		}}, nil
+	}
+
+	var targets []*kubeTarget
+	for _, cluster := range kubeOptions.Clusters {
+		options := *kubeOptions
+		options.Clusters = nil
+		if !helpers.IsBlank(cluster.Kubeconfig) {
+			options.Kubeconfig = helpers.ExpandUser(cluster.Kubeconfig)
+			options.KubeconfigData = ""
+		}
+		if !helpers.IsBlank(cluster.Context) {
+			options.Context = cluster.Context
+		}
+		if cluster.Replicas > 0 {
+			options.DeploymentOptions.Replicas = cluster.Replicas
+		}
+		if !helpers.IsBlank(cluster.IngressHost) {
+			options.IngressOptions.Host = cluster.IngressHost
+		}
+		if !helpers.IsBlank(cluster.StorageClassName) {
+			options.PvcOptions.StorageClassName = cluster.StorageClassName
+		}
+
+		name := cluster.Name
+		targets = append(targets, &kubeTarget{
+			name:    name,
+			options: &options,
+			logHandler: func(msg string) {
+				logHandler(fmt.Sprintf("[%s] %s", name, msg))
+			},
+		})
+	}
+	return targets, nil
+}
+
+// applyClusters applies the app to the clusters concurrently and prints a summary per cluster
+func applyClusters(ctx context.Context, targets []*kubeTarget, kubeOptions *KubeOptions, defaultOptions *DefaultOptions, dockerOptions *docker.DockerOptions, logHandler func(msg string)) error {
+	parallelism := kubeOptions.Parallelism
+	if parallelism <= 0 || parallelism > len(targets) {
+		parallelism = len(targets)
+	}
+
+	results := make([]clusterResult, len(targets))
+	sem := make(chan struct{}, parallelism)
+	var mu sync.Mutex
+	failed := false
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		sem <- struct{}{}
+
+		mu.Lock()
+		skip := failed && kubeOptions.FailurePolicy == FailurePolicyFailFast
+		mu.Unlock()
+		if skip {
+			<-sem
+			results[i] = clusterResult{name: target.name, status: "skipped"}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, target *kubeTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			err := applyKube(ctx, target, defaultOptions, dockerOptions)
+			results[i] = clusterResult{name: target.name, status: "succeeded", err: err, duration: time.Since(start)}
+			if err != nil {
+				results[i].status = "failed"
+				target.logHandler(err.Error())
+				mu.Lock()
+				failed = true
+				mu.Unlock()
+			}
+		}(i, target)
+	}
+	wg.Wait()
+
+	logHandler("deploy summary:")
+	failures := 0
+	for _, result := range results {
+		switch result.status {
+		case "succeeded":
+			logHandler(fmt.Sprintf("  %s: succeeded in %s", result.name, result.duration.Round(time.Second)))
+		case "failed":
+			failures++
+			logHandler(fmt.Sprintf("  %s: failed in %s, %v", result.name, result.duration.Round(time.Second), result.err))
+		default:
+			failures++
+			logHandler(fmt.Sprintf("  %s: skipped after an earlier failure", result.name))
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("deploy failed on %d of %d clusters", failures, len(targets))
+	}
+	return nil
+}
+
+// parseClusters parses cluster flags in the form of name=prod,context=prod,replicas=3,ingresshost=app.com,storageclassname=ssd
+func parseClusters(specs []string) ([]ClusterOptions, error) {
+	var clusters []ClusterOptions
+	for _, spec := range specs {
+		values, err := helpers.ParseKeyValues(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cluster '%s': %v", spec, err)
+		}
+
+		var cluster ClusterOptions
+		for key, value := range values {
+			switch key {
+			case "name":
+				cluster.Name = value
+			case "kubeconfig":
+				cluster.Kubeconfig = value
+			case "context":
+				cluster.Context = value
+			case "replicas":
+				replicas, err := strconv.ParseInt(value, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("invalid replicas of cluster '%s': %v", spec, err)
+				}
+				cluster.Replicas = int32(replicas)
+			case "ingresshost":
+				cluster.IngressHost = value
+			case "storageclassname":
+				cluster.StorageClassName = value
+			default:
+				return nil, fmt.Errorf("unknown key '%s' of cluster '%s'", key, spec)
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, nil
+}
+
+// setClusterOptions names every cluster and checks the fan-out options
+func setClusterOptions(kubeOptions *KubeOptions) error {
+	names := make(map[string]bool)
+	for i := range kubeOptions.Clusters {
+		cluster := &kubeOptions.Clusters[i]
+		if helpers.IsBlank(cluster.Name) {
+			cluster.Name = cluster.Context
+		}
+		if helpers.IsBlank(cluster.Name) {
+			return fmt.Errorf("name or context of cluster %d is required", i+1)
+		}
+		if names[cluster.Name] {
+			return fmt.Errorf("duplicate cluster name: %s", cluster.Name)
+		}
+		names[cluster.Name] = true
+	}
+
+	if kubeOptions.Parallelism < 0 {
+		return fmt.Errorf("kube.parallelism must not be negative")
+	}
+
+	if helpers.IsBlank(kubeOptions.FailurePolicy) {
+		kubeOptions.FailurePolicy = FailurePolicyContinue
+	}
+	if !helpers.Contains([]string{FailurePolicyContinue, FailurePolicyFailFast}, kubeOptions.FailurePolicy) {
+		return fmt.Errorf("unsupported failure policy: %s", kubeOptions.FailurePolicy)
+	}
+
+	return nil
+}
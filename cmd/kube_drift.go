@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"github.com/guobinqiu/appdeployer/kube"
+	"github.com/spf13/cobra"
+)
+
+var reapplyDrift bool
+
+func init() {
+	kubeDriftCmd.Flags().BoolVar(&reapplyDrift, "reapply", false, "Restore the objects changed outside appdeployer to the spec of the last deploy")
+
+	kubeCmd.AddCommand(kubeDriftCmd)
+}
+
+var kubeDriftCmd = &cobra.Command{
+	Use:   "drift",
+	Short: "Report fields of the app objects changed outside appdeployer since the last deploy, e.g. by kubectl edit",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		drifts, err := KubeDrift(&defaultOptions, &kubeOptions, reapplyDrift, func(msg string) {
+			fmt.Println(msg)
+		})
+		if err != nil {
+			return err
+		}
+		if len(drifts) > 0 && !reapplyDrift {
+			return fmt.Errorf("%d fields changed outside appdeployer, rerun with --reapply to restore them", len(drifts))
+		}
+		return nil
+	},
+}
+
+// KubeDrift compares the objects of the app in every cluster with the spec recorded by the last deploy,
+// logs the fields changed outside appdeployer and optionally re-applies the recorded spec
+func KubeDrift(defaultOptions *DefaultOptions, kubeOptions *KubeOptions, reapply bool, logHandler func(msg string)) ([]kube.Drift, error) {
+	appName := resolveAppName(defaultOptions)
+	if helpers.IsBlank(appName) {
+		return nil, fmt.Errorf("default.appname is required")
+	}
+	if err := setKubeClusterOptions(kubeOptions, appName); err != nil {
+		return nil, err
+	}
+
+	targets, err := newKubeTargets(kubeOptions, logHandler)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []kube.Drift
+	for _, target := range targets {
+		clientset, _, err := newKubeClients(target.options)
+		if err != nil {
+			return nil, err
+		}
+
+		clusterDrifts, err := kube.CheckDrift(clientset, context.TODO(), kube.DriftOptions{
+			Name:      appName,
+			Namespace: target.options.Namespace,
+			Reapply:   reapply,
+		}, target.logHandler)
+		if err != nil {
+			return nil, err
+		}
+		if len(clusterDrifts) == 0 {
+			target.logHandler(fmt.Sprintf("no drift found for app %s in namespace %s", appName, target.options.Namespace))
+		}
+		drifts = append(drifts, clusterDrifts...)
+	}
+	return drifts, nil
+}
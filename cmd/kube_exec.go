@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"github.com/guobinqiu/appdeployer/kube"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+var execOptions kube.ExecOptions
+
+func init() {
+	kubeExecCmd.Flags().StringVar(&execOptions.Container, "container", "", "Container to execute in. Defaults to the app container")
+	kubeExecCmd.Flags().BoolVar(&execOptions.TTY, "tty", true, "Allocate a terminal. Ignored when stdin is not a terminal")
+
+	kubeCmd.AddCommand(kubeExecCmd)
+}
+
+var kubeExecCmd = &cobra.Command{
+	Use:   "exec [-- command]",
+	Short: "Execute a command in a ready pod of the app, sh by default",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appName := resolveAppName(&defaultOptions)
+		if helpers.IsBlank(appName) {
+			return fmt.Errorf("default.appname is required")
+		}
+		if err := setKubeClusterOptions(&kubeOptions, appName); err != nil {
+			return err
+		}
+
+		config, err := newKubeRestConfig(&kubeOptions)
+		if err != nil {
+			return err
+		}
+		clientset, _, err := newKubeClients(&kubeOptions)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		execOptions.Name = appName
+		execOptions.Namespace = kubeOptions.Namespace
+		execOptions.Command = args
+		execOptions.Stdin = os.Stdin
+		execOptions.Stdout = os.Stdout
+		execOptions.Stderr = os.Stderr
+
+		fd := int(os.Stdin.Fd())
+		execOptions.TTY = execOptions.TTY && term.IsTerminal(fd)
+		if !execOptions.TTY {
+			return kube.Exec(config, clientset, ctx, execOptions, func(msg string) {
+				fmt.Fprintln(os.Stderr, msg)
+			})
+		}
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to set terminal to raw mode: %v", err)
+		}
+		defer term.Restore(fd, state)
+
+		execOptions.TerminalSizeQueue = &terminalSizeQueue{ctx: ctx, fd: fd}
+		return kube.Exec(config, clientset, ctx, execOptions, func(msg string) {
+			// The terminal is in raw mode, so return the carriage explicitly
+			fmt.Fprint(os.Stderr, msg+"\r\n")
+		})
+	},
+}
+
+// terminalSizeQueue reports the size of the local terminal to the remote one.
+// It polls the size as resize signals are not available on every platform
+type terminalSizeQueue struct {
+	ctx  context.Context
+	fd   int
+	last remotecommand.TerminalSize
+}
+
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	for {
+		width, height, err := term.GetSize(q.fd)
+		if err == nil {
+			size := remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+			if size != q.last {
+				q.last = size
+				return &size
+			}
+		}
+
+		select {
+		case <-q.ctx.Done():
+			return nil
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
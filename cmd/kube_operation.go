@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"github.com/guobinqiu/appdeployer/kube"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+var scaleOptions kube.ScaleOptions
+var waitForOperation bool
+
+func init() {
+	kubeScaleCmd.Flags().Int32Var(&scaleOptions.Replicas, "replicas", -1, "Number of app pods to scale to")
+	kubeScaleCmd.Flags().BoolVar(&scaleOptions.AdjustHPA, "adjust-hpa", false, "Temporarily widen the min/max of the HPA when replicas is out of its range. The next deploy restores the configured range")
+	for _, cmd := range []*cobra.Command{kubeScaleCmd, kubeRestartCmd, kubeResumeCmd} {
+		cmd.Flags().BoolVar(&waitForOperation, "wait", true, "Wait for the deployment to roll out")
+	}
+
+	kubeCmd.AddCommand(kubeScaleCmd)
+	kubeCmd.AddCommand(kubeRestartCmd)
+	kubeCmd.AddCommand(kubePauseCmd)
+	kubeCmd.AddCommand(kubeResumeCmd)
+}
+
+var kubeScaleCmd = &cobra.Command{
+	Use:   "scale",
+	Short: "Scale the app deployment to the given number of replicas",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if scaleOptions.Replicas < 0 {
+			return fmt.Errorf("replicas is required")
+		}
+		var hpa []kube.OwnedObject
+		if scaleOptions.AdjustHPA {
+			hpa = append(hpa, kube.OwnedObject{Kind: kube.KindHPA, Name: resolveAppName(&defaultOptions)})
+		}
+		return runOperation(func(clientset kubernetes.Interface, ctx context.Context, appName string, logHandler func(msg string)) error {
+			scaleOptions.Name = appName
+			scaleOptions.Namespace = kubeOptions.Namespace
+			return kube.ScaleDeployment(clientset, ctx, scaleOptions, logHandler)
+		}, waitForOperation, hpa...)
+	},
+}
+
+var kubeRestartCmd = &cobra.Command{
+	Use:   "restart",
+	Short: "Restart the pods of the app deployment one by one, as kubectl rollout restart does",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOperation(func(clientset kubernetes.Interface, ctx context.Context, appName string, logHandler func(msg string)) error {
+			return kube.RestartDeployment(clientset, ctx, appName, kubeOptions.Namespace, logHandler)
+		}, waitForOperation)
+	},
+}
+
+var kubePauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause rolling out the app deployment, changes to it are held until it is resumed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOperation(func(clientset kubernetes.Interface, ctx context.Context, appName string, logHandler func(msg string)) error {
+			return kube.PauseDeployment(clientset, ctx, appName, kubeOptions.Namespace, logHandler)
+		}, false)
+	},
+}
+
+var kubeResumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume rolling out the app deployment, rolling out the changes held while it was paused",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOperation(func(clientset kubernetes.Interface, ctx context.Context, appName string, logHandler func(msg string)) error {
+			return kube.ResumeDeployment(clientset, ctx, appName, kubeOptions.Namespace, logHandler)
+		}, waitForOperation)
+	},
+}
+
+// runOperation resolves the app deployment the same way as deploying does, checks it and the other modified
+// objects belong to the app and runs the operation on it, then optionally waits for the rollout
+func runOperation(operation func(clientset kubernetes.Interface, ctx context.Context, appName string, logHandler func(msg string)) error, wait bool, objects ...kube.OwnedObject) error {
+	logHandler := func(msg string) {
+		fmt.Println(msg)
+	}
+
+	appName := resolveAppName(&defaultOptions)
+	if helpers.IsBlank(appName) {
+		return fmt.Errorf("default.appname is required")
+	}
+	if err := setKubeClusterOptions(&kubeOptions, appName); err != nil {
+		return err
+	}
+	kubeOptions.Workload = strings.ToLower(kubeOptions.Workload)
+	if kubeOptions.Workload != kube.WorkloadDeployment {
+		return fmt.Errorf("only supported by deployment workload, got %s", kubeOptions.Workload)
+	}
+
+	clientset, dynamicClient, err := newKubeClients(&kubeOptions)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rolloutTimeout)
+	defer cancel()
+
+	if err := kube.CheckOwnership(clientset, dynamicClient, ctx, kube.OwnershipOptions{
+		App:       appName,
+		Namespace: kubeOptions.Namespace,
+		Adopt:     kubeOptions.Adopt,
+		Objects:   append([]kube.OwnedObject{{Kind: kube.WorkloadDeployment, Name: appName}}, objects...),
+	}, logHandler); err != nil {
+		return err
+	}
+
+	if err := operation(clientset, ctx, appName, logHandler); err != nil {
+		return err
+	}
+	if !wait {
+		return nil
+	}
+	return kube.WaitForRollout(clientset, ctx, kube.WorkloadDeployment, appName, kubeOptions.Namespace, logHandler)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"github.com/guobinqiu/appdeployer/kube"
+	"github.com/spf13/cobra"
+)
+
+var portForwardOptions kube.PortForwardOptions
+
+func init() {
+	kubePortForwardCmd.Flags().BoolVar(&portForwardOptions.Pod, "pod", false, "Forward to a container port of a pod instead of a port of the app service")
+
+	kubeCmd.AddCommand(kubePortForwardCmd)
+}
+
+var kubePortForwardCmd = &cobra.Command{
+	Use:   "port-forward LOCAL:REMOTE...",
+	Short: "Forward local ports to the app service or a pod, selecting another pod when the forwarded one dies",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appName := resolveAppName(&defaultOptions)
+		if helpers.IsBlank(appName) {
+			return fmt.Errorf("default.appname is required")
+		}
+		if err := setKubeClusterOptions(&kubeOptions, appName); err != nil {
+			return err
+		}
+
+		config, err := newKubeRestConfig(&kubeOptions)
+		if err != nil {
+			return err
+		}
+		clientset, _, err := newKubeClients(&kubeOptions)
+		if err != nil {
+			return err
+		}
+
+		// Forward until interrupted
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		portForwardOptions.Name = appName
+		portForwardOptions.Namespace = kubeOptions.Namespace
+		portForwardOptions.Ports = args
+		return kube.PortForward(config, clientset, ctx, portForwardOptions, func(msg string) {
+			fmt.Println(msg)
+		})
+	},
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/kube"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+func init() {
+	kubeCmd.AddCommand(kubePreflightCmd)
+}
+
+var kubePreflightCmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "Check the cluster is ready for the app to be deployed",
+	Long:  "Check the ingress class or gateway api, storage classes, metrics-server, prometheus-operator and RBAC permissions the deploy needs, using the kube settings in config.ini",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appName := resolveAppName(&defaultOptions)
+		if err := setKubeClusterOptions(&kubeOptions, appName); err != nil {
+			return err
+		}
+		kubeOptions.Workload = strings.ToLower(kubeOptions.Workload)
+		if err := setRouteOptions(&kubeOptions); err != nil {
+			return err
+		}
+		if err := setMetricsOptions(&kubeOptions); err != nil {
+			return err
+		}
+		if err := setIngressOptions(&kubeOptions); err != nil {
+			return err
+		}
+
+		clientset, _, err := newKubeClients(&kubeOptions)
+		if err != nil {
+			return err
+		}
+
+		return runPreflight(clientset, context.TODO(), &kubeOptions, appName, func(msg string) {
+			fmt.Println(msg)
+		})
+	},
+}
+
+// runPreflight checks the cluster dependencies of the deploy and fails on any error finding
+func runPreflight(clientset kubernetes.Interface, ctx context.Context, kubeOptions *KubeOptions, appName string, logHandler func(msg string)) error {
+	findings, err := kube.Preflight(clientset, ctx, newPreflightOptions(kubeOptions, appName))
+	if err != nil {
+		return err
+	}
+	kube.PrintFindings(findings, logHandler)
+	return kube.PreflightFailed(findings)
+}
+
+func newPreflightOptions(kubeOptions *KubeOptions, appName string) kube.PreflightOptions {
+	opts := kube.PreflightOptions{
+		Name:          appName,
+		Namespace:     kubeOptions.Namespace,
+		Workload:      kubeOptions.Workload,
+		Ingress:       kubeOptions.Workload != kube.WorkloadDaemonSet && kubeOptions.Routing != kube.RoutingGateway && kubeOptions.IngressOptions.Enabled,
+		HPA:           kubeOptions.HpaOptions.Enabled && kubeOptions.Workload != kube.WorkloadDaemonSet,
+		Jobs:          kubeOptions.HookOptions.PreDeploy.Enabled || kubeOptions.HookOptions.PostDeploy.Enabled,
+		ResourceQuota: kubeOptions.ResourceQuota.Enabled,
+		LimitRange:    kubeOptions.LimitRange.Enabled,
+		Snapshot:      strings.ToLower(kubeOptions.PvcOptions.RetentionPolicy) == kube.RetentionPolicyDelete,
+		Prune:         kubeOptions.Prune,
+		Canary:        kubeOptions.Canary.Enabled && kubeOptions.Workload == kube.WorkloadDeployment,
+		Migrate:       kubeOptions.DeploymentOptions.VolumeMount.Enabled && kubeOptions.Workload == kube.WorkloadDeployment,
+	}
+
+	if opts.Ingress {
+		opts.IngressController = kubeOptions.IngressOptions.Controller
+	}
+
+	if kubeOptions.Workload != kube.WorkloadDaemonSet && kubeOptions.Routing == kube.RoutingGateway {
+		opts.Route = kubeOptions.RouteOptions.Kind
+	}
+
+	if kubeOptions.Metrics.Enabled {
+		opts.Monitor = kubeOptions.Metrics.Monitor
+	}
+
+	if kubeOptions.DeploymentOptions.VolumeMount.Enabled {
+		opts.StorageClassNames = append(opts.StorageClassNames, kubeOptions.PvcOptions.StorageClassName)
+	}
+	for _, volume := range kubeOptions.DeploymentOptions.Volumes {
+		if strings.ToLower(volume.Type) == kube.VolumeTypePVC {
+			opts.StorageClassNames = append(opts.StorageClassNames, volume.StorageClassName)
+		}
+	}
+
+	return opts
+}
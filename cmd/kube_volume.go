@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"github.com/guobinqiu/appdeployer/kube"
+	"github.com/spf13/cobra"
+)
+
+var restoreOptions kube.RestoreOptions
+
+func init() {
+	kubeVolumeRestoreCmd.Flags().StringVar(&restoreOptions.SnapshotName, "snapshot", "", "Name of the VolumeSnapshot to restore from")
+	kubeVolumeRestoreCmd.Flags().StringVar(&restoreOptions.Name, "pvc", "", "Name of the PVC to create. Defaults to appname")
+	kubeVolumeRestoreCmd.Flags().StringVar(&restoreOptions.AccessMode, "accessmode", "readwriteonce", "Access mode of the restored PVC. Such as ReadWriteOnce, ReadOnlyMany and ReadWriteMany. Defaults to ReadWriteOnce")
+	kubeVolumeRestoreCmd.Flags().StringVar(&restoreOptions.StorageClassName, "storageclassname", "", "Classname of the restored PVC. Defaults to the cluster default")
+	kubeVolumeRestoreCmd.Flags().StringVar(&restoreOptions.StorageSize, "storagesize", "", "Size of the restored PVC. Defaults to the restore size of the snapshot")
+
+	kubeVolumeCmd.AddCommand(kubeVolumeRestoreCmd)
+	kubeCmd.AddCommand(kubeVolumeCmd)
+}
+
+var kubeVolumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "Manage app volumes",
+}
+
+var kubeVolumeRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Create a PVC from a volume snapshot",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		appName := resolveAppName(&defaultOptions)
+		if err := setKubeClusterOptions(&kubeOptions, appName); err != nil {
+			return err
+		}
+
+		if helpers.IsBlank(restoreOptions.SnapshotName) {
+			return fmt.Errorf("snapshot is required")
+		}
+		if helpers.IsBlank(restoreOptions.Name) {
+			restoreOptions.Name = appName
+		}
+		if helpers.IsBlank(restoreOptions.Name) {
+			return fmt.Errorf("pvc is required")
+		}
+		restoreOptions.Namespace = kubeOptions.Namespace
+		restoreOptions.App = appName
+
+		clientset, dynamicClient, err := newKubeClients(&kubeOptions)
+		if err != nil {
+			return err
+		}
+
+		return kube.RestorePVC(clientset, dynamicClient, context.TODO(), restoreOptions, func(msg string) {
+			fmt.Println(msg)
+		})
+	},
+}
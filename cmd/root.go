@@ -70,6 +70,17 @@ func setDefaultOptions(defaultOptions *DefaultOptions) error {
 	return nil
 }
 
+// resolveAppName returns the app name for sub commands that do not require appdir to exist
+func resolveAppName(defaultOptions *DefaultOptions) string {
+	if !helpers.IsBlank(defaultOptions.AppName) {
+		return defaultOptions.AppName
+	}
+	if !helpers.IsBlank(defaultOptions.AppDir) {
+		return filepath.Base(helpers.ExpandUser(defaultOptions.AppDir))
+	}
+	return ""
+}
+
 // Pull or clone into appdir
 func gitPull(gitOptions *git.GitOptions, logHandler func(msg string)) error {
 	gitOptions.AppDir = defaultOptions.AppDir
@@ -28,6 +28,10 @@ type DockerOptions struct {
 	Password     string `form:"password" json:"password"`
 	Repository   string `form:"repository" json:"repository"`
 	Tag          string `form:"tag" json:"tag"`
+	TagStrategy  string `form:"tagstrategy" json:"tagstrategy"`
+
+	// Digest 为推送镜像后 registry 返回的摘要，部署时用它固定镜像内容
+	Digest string
 }
 
 func (opts DockerOptions) Validate() error {
@@ -42,11 +46,7 @@ func (opts DockerOptions) Validate() error {
 
 func (opts DockerOptions) Image() string {
 	builder := new(strings.Builder)
-	if opts.Registry != DOCKERHUB {
-		builder.WriteString(opts.Registry)
-		builder.WriteByte('/')
-	}
-	builder.WriteString(opts.Repository)
+	builder.WriteString(opts.repository())
 	if !helpers.IsBlank(opts.Tag) {
 		builder.WriteByte(':')
 		builder.WriteString(opts.Tag)
@@ -54,6 +54,21 @@ func (opts DockerOptions) Image() string {
 	return builder.String()
 }
 
+// ImageRef 返回部署使用的镜像引用，推送后为不可变的 repository@sha256:... 形式
+func (opts DockerOptions) ImageRef() string {
+	if helpers.IsBlank(opts.Digest) {
+		return opts.Image()
+	}
+	return opts.repository() + "@" + opts.Digest
+}
+
+func (opts DockerOptions) repository() string {
+	if opts.Registry != DOCKERHUB {
+		return opts.Registry + "/" + opts.Repository
+	}
+	return opts.Repository
+}
+
 type DockerService struct {
 	cli *client.Client
 }
@@ -124,11 +139,13 @@ type PushMessage struct {
 	ProgressDetail map[string]interface{} `json:"progressDetail"`
 	ID             string                 `json:"id"`
 	Aux            map[string]interface{} `json:"aux"`
+	Error          string                 `json:"error"`
 }
 
-func (ds *DockerService) PushImage(ctx context.Context, opts DockerOptions, logHandler func(msg string)) error {
+// PushImage 推送镜像并返回 registry 上报的镜像摘要
+func (ds *DockerService) PushImage(ctx context.Context, opts DockerOptions, logHandler func(msg string)) (string, error) {
 	if err := opts.Validate(); err != nil {
-		return err
+		return "", err
 	}
 
 	// 登录到Docker registry
@@ -140,7 +157,7 @@ func (ds *DockerService) PushImage(ctx context.Context, opts DockerOptions, logH
 
 	encodedJSON, err := json.Marshal(authConfig)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
@@ -148,18 +165,31 @@ func (ds *DockerService) PushImage(ctx context.Context, opts DockerOptions, logH
 	// 推送镜像
 	resp, err := ds.cli.ImagePush(ctx, opts.Image(), image.PushOptions{RegistryAuth: authStr})
 	if err != nil {
-		return fmt.Errorf("failed to marshal auth configuration to JSON: %v", err)
+		return "", fmt.Errorf("failed to marshal auth configuration to JSON: %v", err)
 	}
 	defer resp.Close()
 
-	// 逐行打印响应流
+	// 逐行打印响应流，推送完成时 aux 中带有镜像摘要
+	var digest string
 	scanner := bufio.NewScanner(resp)
 	for scanner.Scan() {
 		line := scanner.Text()
 		var msg PushMessage
 		json.Unmarshal([]byte(line), &msg)
+		if msg.Error != "" {
+			return "", fmt.Errorf("failed to push Docker image: %s", msg.Error)
+		}
+		if value, ok := msg.Aux["Digest"].(string); ok {
+			digest = value
+		}
 		logHandler(msg.Status)
 	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read push response: %v", err)
+	}
+	if digest == "" {
+		return "", fmt.Errorf("registry did not report a digest for image %s", opts.Image())
+	}
 
-	return nil
+	return digest, nil
 }
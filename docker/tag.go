@@ -0,0 +1,88 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guobinqiu/appdeployer/git"
+	"github.com/guobinqiu/appdeployer/helpers"
+)
+
+const (
+	TagStrategyExplicit  = "explicit"
+	TagStrategyGitSHA    = "gitsha"
+	TagStrategyTimestamp = "timestamp"
+	TagStrategySemver    = "semver"
+)
+
+// gitSHALength 为 gitsha 策略下镜像标签使用的提交哈希长度
+const gitSHALength = 12
+
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(-[0-9A-Za-z.-]+)?$`)
+
+// ResolveTag 根据标签策略生成镜像标签，explicit 策略直接使用 Tag
+func ResolveTag(opts DockerOptions) (string, error) {
+	switch strings.ToLower(opts.TagStrategy) {
+	case "", TagStrategyExplicit:
+		if helpers.IsBlank(opts.Tag) {
+			return "", fmt.Errorf("docker.tag is required by explicit tag strategy")
+		}
+		return opts.Tag, nil
+	case TagStrategyGitSHA:
+		commit, err := git.HeadCommit(opts.AppDir)
+		if err != nil {
+			return "", err
+		}
+		return commit[:gitSHALength], nil
+	case TagStrategyTimestamp:
+		return time.Now().UTC().Format("20060102150405"), nil
+	case TagStrategySemver:
+		tags, err := git.HeadTags(opts.AppDir)
+		if err != nil {
+			return "", err
+		}
+		version := latestSemver(tags)
+		if version == "" {
+			return "", fmt.Errorf("no semver tag such as v1.2.3 points at HEAD of '%s'", opts.AppDir)
+		}
+		return version, nil
+	default:
+		return "", fmt.Errorf("unsupported tag strategy: '%s'", opts.TagStrategy)
+	}
+}
+
+// latestSemver 返回版本号最高的语义化版本标签（去掉 v 前缀），同一版本优先取正式版
+func latestSemver(tags []string) string {
+	var latest string
+	var latestParts [4]int
+	for _, tag := range tags {
+		matches := semverPattern.FindStringSubmatch(tag)
+		if matches == nil {
+			continue
+		}
+		var parts [4]int
+		for i := 0; i < 3; i++ {
+			parts[i], _ = strconv.Atoi(matches[i+1])
+		}
+		if matches[4] == "" {
+			parts[3] = 1
+		}
+		if latest == "" || compareParts(parts, latestParts) > 0 {
+			latest = strings.TrimPrefix(tag, "v")
+			latestParts = parts
+		}
+	}
+	return latest
+}
+
+func compareParts(a, b [4]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
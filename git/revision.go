@@ -0,0 +1,54 @@
+package git
+
+import (
+	"fmt"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// HeadCommit 返回本地仓库 HEAD 指向的提交哈希
+func HeadCommit(dir string) (string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open git repository '%s': %v", dir, err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD of '%s': %v", dir, err)
+	}
+	return head.Hash().String(), nil
+}
+
+// HeadTags 返回本地仓库中指向 HEAD 的标签，包括附注标签
+func HeadTags(dir string) ([]string, error) {
+	r, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open git repository '%s': %v", dir, err)
+	}
+	head, err := r.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve HEAD of '%s': %v", dir, err)
+	}
+
+	iter, err := r.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of '%s': %v", dir, err)
+	}
+	var tags []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		hash := ref.Hash()
+		// 附注标签指向标签对象，需要取出其指向的提交
+		if tag, err := r.TagObject(hash); err == nil {
+			hash = tag.Target
+		}
+		if hash == head.Hash() {
+			tags = append(tags, ref.Name().Short())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
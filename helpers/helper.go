@@ -119,3 +119,19 @@ func FindRootDir(dir string) string {
 	}
 	return ""
 }
+
+// ParseKeyValues parses a spec in the form of key1=value1,key2=value2 into a map with lower-cased keys
+func ParseKeyValues(spec string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(spec, ",") {
+		if IsBlank(pair) {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || IsBlank(parts[0]) {
+			return nil, fmt.Errorf("invalid key value pair: '%s'", pair)
+		}
+		values[strings.ToLower(strings.TrimSpace(parts[0]))] = strings.TrimSpace(parts[1])
+	}
+	return values, nil
+}
@@ -0,0 +1,285 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// canaryRolloutTimeout 为等待金丝雀 Pod 就绪的最长时间
+const canaryRolloutTimeout = 10 * time.Minute
+
+const (
+	nginxCanaryAnnotation       = "nginx.ingress.kubernetes.io/canary"
+	nginxCanaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+// CanaryQuery 为一项金丝雀分析，Query 中的 $app、$canary、$namespace 会被替换为应用名、金丝雀名与命名空间，
+// 结果须满足 Op（< 或 >）Threshold，如错误率 < 0.01
+type CanaryQuery struct {
+	Name      string  `form:"name" json:"name"`
+	Query     string  `form:"query" json:"query"`
+	Op        string  `form:"op" json:"op"`
+	Threshold float64 `form:"threshold" json:"threshold"`
+}
+
+// Check 判断查询结果是否满足阈值
+func (q CanaryQuery) Check(value float64) bool {
+	if q.Op == ">" {
+		return value > q.Threshold
+	}
+	return value < q.Threshold
+}
+
+// CanaryOptions 用于将新版本先以金丝雀的方式按权重逐步引流，每一步暂停后执行 PromQL 分析，未通过时自动回滚
+type CanaryOptions struct {
+	Enabled bool `form:"enabled" json:"enabled"`
+	// Steps 为每一步金丝雀接收的流量百分比，如 5、25、50、100
+	Steps []int32 `form:"steps" json:"steps"`
+	// PauseSeconds 为每一步引流后等待多少秒再分析
+	PauseSeconds int32 `form:"pauseseconds" json:"pauseseconds"`
+	// Replicas 为金丝雀 Deployment 的副本数
+	Replicas      int32         `form:"replicas" json:"replicas"`
+	PrometheusURL string        `form:"prometheusurl" json:"prometheusurl"`
+	Queries       []CanaryQuery `form:"queries" json:"queries"`
+
+	Name      string
+	Namespace string
+	// Routing 为 ingress 时通过 nginx 的金丝雀 Ingress 分流，为 gateway 时通过路由后端的权重分流
+	Routing      string
+	RouteOptions RouteOptions
+	// DeploymentOptions 为新版本的 Deployment
+	DeploymentOptions DeploymentOptions
+	ServicePort       int32
+}
+
+// CanaryName 返回金丝雀 Deployment、Service 与 Ingress 的名称
+func CanaryName(name string) string {
+	return name + "-canary"
+}
+
+// RunCanary 以新版本创建金丝雀 Deployment 与 Service，按 Steps 逐步提高其流量权重，
+// 每一步暂停 PauseSeconds 后执行全部分析，任一分析未通过或出错时恢复流量并删除金丝雀，返回错误。
+// 全部通过后金丝雀保留 100% 的流量，由调用方更新正式版本后调用 DeleteCanary 收尾
+func RunCanary(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts CanaryOptions, logHandler func(msg string)) error {
+	canaryName := CanaryName(opts.Name)
+
+	deploymentOptions := opts.DeploymentOptions
+	deploymentOptions.Name = canaryName
+	deploymentOptions.Namespace = opts.Namespace
+	deploymentOptions.Replicas = opts.Replicas
+	// 金丝雀属于应用，随应用一起检查归属与清理
+	deploymentOptions.App = opts.Name
+	deploymentOptions.Component = ComponentCanary
+	if err := CreateOrUpdateDeployment(clientset, ctx, deploymentOptions, logHandler); err != nil {
+		return err
+	}
+
+	rolloutCtx, cancel := context.WithTimeout(ctx, canaryRolloutTimeout)
+	err := WaitForRollout(clientset, rolloutCtx, WorkloadDeployment, canaryName, opts.Namespace, logHandler)
+	cancel()
+	if err == nil {
+		err = CreateOrUpdateService(clientset, ctx, ServiceOptions{
+			Name:       canaryName,
+			Namespace:  opts.Namespace,
+			Port:       opts.ServicePort,
+			TargetPort: opts.DeploymentOptions.Port,
+			App:        opts.Name,
+			Component:  ComponentCanary,
+		}, logHandler)
+	}
+	if err != nil {
+		return abortCanary(clientset, dynamicClient, ctx, opts, err, logHandler)
+	}
+
+	for _, weight := range opts.Steps {
+		if err := setCanaryWeight(clientset, dynamicClient, ctx, opts, weight); err != nil {
+			return abortCanary(clientset, dynamicClient, ctx, opts, err, logHandler)
+		}
+		logHandler(fmt.Sprintf("canary %s receiving %d%% of the traffic", canaryName, weight))
+
+		select {
+		case <-ctx.Done():
+			return abortCanary(clientset, dynamicClient, ctx, opts, ctx.Err(), logHandler)
+		case <-time.After(time.Duration(opts.PauseSeconds) * time.Second):
+		}
+
+		if err := analyzeCanary(ctx, opts, logHandler); err != nil {
+			return abortCanary(clientset, dynamicClient, ctx, opts, fmt.Errorf("analysis failed at %d%% of the traffic: %v", weight, err), logHandler)
+		}
+	}
+	logHandler(fmt.Sprintf("canary %s passed all steps, promoting it", canaryName))
+	return nil
+}
+
+// analyzeCanary 依次执行全部分析，返回第一个未通过的分析
+func analyzeCanary(ctx context.Context, opts CanaryOptions, logHandler func(msg string)) error {
+	replacer := strings.NewReplacer("$canary", CanaryName(opts.Name), "$app", opts.Name, "$namespace", opts.Namespace)
+	for _, query := range opts.Queries {
+		value, err := QueryPrometheus(ctx, opts.PrometheusURL, replacer.Replace(query.Query))
+		if err != nil {
+			return fmt.Errorf("%s: %v", query.Name, err)
+		}
+		result := fmt.Sprintf("%s = %s, expected %s %s", query.Name, formatCanaryValue(value), query.Op, formatCanaryValue(query.Threshold))
+		if !query.Check(value) {
+			return fmt.Errorf("%s", result)
+		}
+		logHandler(fmt.Sprintf("canary analysis passed: %s", result))
+	}
+	return nil
+}
+
+func formatCanaryValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// abortCanary 将流量切回正式版本并删除金丝雀，返回包含失败原因的错误
+func abortCanary(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts CanaryOptions, cause error, logHandler func(msg string)) error {
+	logHandler(fmt.Sprintf("canary %s failed: %v", CanaryName(opts.Name), cause))
+	// 超时或取消后仍须恢复流量，因此不沿用已结束的 ctx
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+	if err := DeleteCanary(clientset, dynamicClient, ctx, opts, logHandler); err != nil {
+		return fmt.Errorf("canary failed: %v, rollback failed: %v", cause, err)
+	}
+	return fmt.Errorf("canary failed and was rolled back: %v", cause)
+}
+
+// DeleteCanary 将流量全部切回正式版本，再删除金丝雀的 Ingress、Service 与 Deployment
+func DeleteCanary(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts CanaryOptions, logHandler func(msg string)) error {
+	canaryName := CanaryName(opts.Name)
+	if err := setCanaryWeight(clientset, dynamicClient, ctx, opts, 0); err != nil {
+		return err
+	}
+	err := clientset.CoreV1().Services(opts.Namespace).Delete(ctx, canaryName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete service %s: %v", canaryName, err)
+	}
+	if err := DeleteDeployment(clientset, ctx, DeploymentOptions{Name: canaryName, Namespace: opts.Namespace}, logHandler); err != nil {
+		return err
+	}
+	logHandler(fmt.Sprintf("canary %s removed", canaryName))
+	return nil
+}
+
+// CanaryExists 判断是否存在应用的金丝雀 Deployment、Service 或 Ingress，如中断的发布遗留的金丝雀；
+// 同名但不属于应用金丝雀的资源不算在内
+func CanaryExists(clientset kubernetes.Interface, ctx context.Context, name, namespace string) (bool, error) {
+	for _, kind := range []string{WorkloadDeployment, KindService, KindIngress} {
+		live, err := getObjectMeta(clientset, nil, ctx, OwnedObject{Kind: kind, Name: CanaryName(name)}, namespace)
+		if err != nil {
+			return false, err
+		}
+		if live == nil {
+			continue
+		}
+		labels := live.GetLabels()
+		if owner, managed := ownerOf(live); managed && owner == name && labels[ComponentLabel] == ComponentCanary {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// setCanaryWeight 将 weight% 的流量转发到金丝雀，为 0 时全部转发到正式版本
+func setCanaryWeight(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts CanaryOptions, weight int32) error {
+	canaryName := CanaryName(opts.Name)
+	if opts.Routing == RoutingGateway {
+		routeOptions := opts.RouteOptions
+		if weight <= 0 {
+			routeOptions.Backends = nil
+		} else {
+			stableWeight := 100 - weight
+			routeOptions.Backends = []RouteBackend{
+				{Service: opts.Name, Weight: &stableWeight},
+				{Service: canaryName, Weight: &weight},
+			}
+		}
+		return CreateOrUpdateRoute(dynamicClient, ctx, routeOptions, func(string) {})
+	}
+
+	if weight <= 0 {
+		err := clientset.NetworkingV1().Ingresses(opts.Namespace).Delete(ctx, canaryName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete ingress %s: %v", canaryName, err)
+		}
+		return nil
+	}
+	return createOrUpdateCanaryIngress(clientset, ctx, opts, weight)
+}
+
+// createOrUpdateCanaryIngress 按正式版本的 Ingress 创建 nginx 的金丝雀 Ingress，后端指向金丝雀 Service
+func createOrUpdateCanaryIngress(clientset kubernetes.Interface, ctx context.Context, opts CanaryOptions, weight int32) error {
+	canaryName := CanaryName(opts.Name)
+	stable, err := clientset.NetworkingV1().Ingresses(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get ingress %s: %v", opts.Name, err)
+	}
+
+	spec := *stable.Spec.DeepCopy()
+	for i := range spec.Rules {
+		if spec.Rules[i].HTTP == nil {
+			continue
+		}
+		for j := range spec.Rules[i].HTTP.Paths {
+			if backend := spec.Rules[i].HTTP.Paths[j].Backend.Service; backend != nil && backend.Name == opts.Name {
+				backend.Name = canaryName
+			}
+		}
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      canaryName,
+			Namespace: opts.Namespace,
+			Labels:    componentLabels(opts.Name, ComponentCanary),
+			Annotations: map[string]string{
+				nginxCanaryAnnotation:       "true",
+				nginxCanaryWeightAnnotation: strconv.Itoa(int(weight)),
+			},
+		},
+		Spec: spec,
+	}
+
+	if _, err := clientset.NetworkingV1().Ingresses(opts.Namespace).Create(ctx, ingress, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create ingress %s: %v", canaryName, err)
+		}
+		if _, err := clientset.NetworkingV1().Ingresses(opts.Namespace).Update(ctx, ingress, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update ingress %s: %v", canaryName, err)
+		}
+	}
+	return nil
+}
+
+// ParseCanaryQuery 解析形如 name<threshold:query 或 name>threshold:query 的分析，
+// 如 errorrate<0.01:sum(rate(http_requests_total{app="$canary",code=~"5.."}[1m])) / sum(rate(http_requests_total{app="$canary"}[1m]))
+func ParseCanaryQuery(spec string) (CanaryQuery, error) {
+	head, query, found := strings.Cut(spec, ":")
+	if !found || helpers.IsBlank(query) {
+		return CanaryQuery{}, fmt.Errorf("invalid canary query '%s', expected name<threshold:query", spec)
+	}
+	index := strings.IndexAny(head, "<>")
+	if index <= 0 {
+		return CanaryQuery{}, fmt.Errorf("invalid canary query '%s', expected name<threshold:query", spec)
+	}
+	threshold, err := strconv.ParseFloat(strings.TrimSpace(head[index+1:]), 64)
+	if err != nil {
+		return CanaryQuery{}, fmt.Errorf("invalid threshold of canary query '%s': %v", spec, err)
+	}
+	return CanaryQuery{
+		Name:      strings.TrimSpace(head[:index]),
+		Query:     strings.TrimSpace(query),
+		Op:        head[index : index+1],
+		Threshold: threshold,
+	}, nil
+}
@@ -0,0 +1,209 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestCanaryClient 返回写入的 Deployment 立即上报全部副本就绪的 fake 客户端
+func newTestCanaryClient(objects ...runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+	setReady := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var deployment *appsv1.Deployment
+		switch action := action.(type) {
+		case k8stesting.CreateAction:
+			deployment = action.GetObject().(*appsv1.Deployment)
+		case k8stesting.UpdateAction:
+			deployment = action.GetObject().(*appsv1.Deployment)
+		}
+		replicas := *deployment.Spec.Replicas
+		deployment.Status.Replicas = replicas
+		deployment.Status.UpdatedReplicas = replicas
+		deployment.Status.AvailableReplicas = replicas
+		return false, nil, nil
+	}
+	clientset.PrependReactor("create", "deployments", setReady)
+	clientset.PrependReactor("update", "deployments", setReady)
+	return clientset
+}
+
+func newTestCanaryOptions(prometheusURL string) CanaryOptions {
+	return CanaryOptions{
+		Enabled:       true,
+		Steps:         []int32{10, 50, 100},
+		Replicas:      1,
+		PrometheusURL: prometheusURL,
+		Queries: []CanaryQuery{
+			{Name: "errorrate", Query: `errors{app="$canary",namespace="$namespace"}`, Op: "<", Threshold: 0.01},
+		},
+		Name:              "hellogo",
+		Namespace:         testNamespace,
+		Routing:           RoutingIngress,
+		DeploymentOptions: newTestDeploymentOptions(),
+		ServicePort:       80,
+	}
+}
+
+func TestRunCanary(t *testing.T) {
+	ctx := context.Background()
+	clientset := newTestCanaryClient()
+	dynamicClient := newTestPruneDynamicClient()
+	if err := CreateOrUpdateIngress(clientset, dynamicClient, ctx, IngressOptions{Name: "hellogo", Namespace: testNamespace, Host: "hellogo.com"}, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	var queries []string
+	server := newTestPrometheus(t, func(query string) string {
+		queries = append(queries, query)
+		return prometheusVector("0.001")
+	})
+	opts := newTestCanaryOptions(server.URL)
+	opts.DeploymentOptions.Image = "guobinqiu/hellogo:v2"
+
+	logs := &logRecorder{}
+	if err := RunCanary(clientset, dynamicClient, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "canary hellogo-canary receiving 10% of the traffic")
+	logs.assertContains(t, "canary analysis passed: errorrate = 0.001, expected < 0.01")
+	logs.assertContains(t, "canary hellogo-canary passed all steps")
+	if len(queries) != 3 || queries[0] != `errors{app="hellogo-canary",namespace="hello"}` {
+		t.Errorf("expected the query to run once per step with the placeholders replaced, got %v", queries)
+	}
+
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *deployment.Spec.Replicas != 1 || deployment.Spec.Template.Spec.Containers[0].Image != "guobinqiu/hellogo:v2" {
+		t.Errorf("expected one canary replica of the new image, got %d of %s", *deployment.Spec.Replicas, deployment.Spec.Template.Spec.Containers[0].Image)
+	}
+	if deployment.Labels[AppLabel] != "hellogo" || deployment.Labels[ComponentLabel] != ComponentCanary {
+		t.Errorf("expected the canary deployment to be labeled as a component of the app, got %v", deployment.Labels)
+	}
+	if exists, err := CanaryExists(clientset, ctx, "hellogo", testNamespace); err != nil || !exists {
+		t.Errorf("expected the canary to exist, got %v %v", exists, err)
+	}
+	ingress, err := clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo-canary", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ingress.Labels[AppLabel] != "hellogo" || ingress.Labels[ComponentLabel] != ComponentCanary {
+		t.Errorf("expected the canary ingress to be labeled as a component of the app, got %v", ingress.Labels)
+	}
+	if ingress.Annotations[nginxCanaryAnnotation] != "true" || ingress.Annotations[nginxCanaryWeightAnnotation] != "100" {
+		t.Errorf("expected the canary ingress to take all the traffic, got %v", ingress.Annotations)
+	}
+	if backend := ingress.Spec.Rules[0].HTTP.Paths[0].Backend.Service.Name; backend != "hellogo-canary" {
+		t.Errorf("expected the canary ingress to route to the canary service, got %s", backend)
+	}
+
+	// 正式版本更新后收尾
+	if err := DeleteCanary(clientset, dynamicClient, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo-canary", metav1.GetOptions{}); err == nil {
+		t.Error("expected the canary ingress to be deleted")
+	}
+	if _, err := clientset.CoreV1().Services(testNamespace).Get(ctx, "hellogo-canary", metav1.GetOptions{}); err == nil {
+		t.Error("expected the canary service to be deleted")
+	}
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo-canary", metav1.GetOptions{}); err == nil {
+		t.Error("expected the canary deployment to be deleted")
+	}
+	if _, err := clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the stable ingress to be kept, got %v", err)
+	}
+	if exists, err := CanaryExists(clientset, ctx, "hellogo", testNamespace); err != nil || exists {
+		t.Errorf("expected no canary left, got %v %v", exists, err)
+	}
+}
+
+func TestCanaryExistsIgnoresOtherApps(t *testing.T) {
+	// 名为 hellogo-canary 的独立应用不是 hellogo 的金丝雀
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "hellogo-canary", Namespace: testNamespace, Labels: ownerLabels("hellogo-canary")},
+	})
+	exists, err := CanaryExists(clientset, context.Background(), "hellogo", testNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("expected the deployment of another app not to be taken as the canary")
+	}
+}
+
+func TestRunCanaryRollsBackOnFailedAnalysis(t *testing.T) {
+	ctx := context.Background()
+	clientset := newTestCanaryClient()
+	dynamicClient := newTestRouteClient(metav1.ConditionTrue, "ResolvedRefs")
+
+	// 错误率在引流到 50% 时超过阈值
+	var weights []int64
+	server := newTestPrometheus(t, func(query string) string {
+		route, err := dynamicClient.Resource(httpRouteGVR).Namespace(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+		if err != nil {
+			t.Error(err)
+			return prometheusVector()
+		}
+		rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+		backendRefs, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "backendRefs")
+		weight, _, _ := unstructured.NestedInt64(backendRefs[len(backendRefs)-1].(map[string]interface{}), "weight")
+		weights = append(weights, weight)
+		if weight >= 50 {
+			return prometheusVector("0.2")
+		}
+		return prometheusVector("0")
+	})
+	opts := newTestCanaryOptions(server.URL)
+	opts.Routing = RoutingGateway
+	opts.RouteOptions = RouteOptions{Name: "hellogo", Namespace: testNamespace, Port: 80, Kind: RouteKindHTTP, Gateway: "public"}
+
+	logs := &logRecorder{}
+	err := RunCanary(clientset, dynamicClient, ctx, opts, logs.handle)
+	assertErrorContains(t, err, "canary failed and was rolled back: analysis failed at 50% of the traffic: errorrate = 0.2, expected < 0.01")
+	if len(weights) != 2 || weights[0] != 10 {
+		t.Errorf("expected the analysis to stop at the second step, got weights %v", weights)
+	}
+	logs.assertContains(t, "canary hellogo-canary removed")
+
+	route, err := dynamicClient.Resource(httpRouteGVR).Namespace(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	backendRefs, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "backendRefs")
+	if len(backendRefs) != 1 || backendRefs[0].(map[string]interface{})["name"] != "hellogo" {
+		t.Errorf("expected all the traffic to go back to the stable service, got %v", backendRefs)
+	}
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo-canary", metav1.GetOptions{}); err == nil {
+		t.Error("expected the canary deployment to be deleted")
+	}
+}
+
+func TestParseCanaryQuery(t *testing.T) {
+	query, err := ParseCanaryQuery(`successrate>0.99:sum(rate(requests_total{app="$canary",code!~"5.."}[1m])) / sum(rate(requests_total{app="$canary"}[1m]))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Name != "successrate" || query.Op != ">" || query.Threshold != 0.99 || !strings.HasPrefix(query.Query, "sum(rate(requests_total{") {
+		t.Errorf("unexpected canary query %+v", query)
+	}
+	if !query.Check(0.995) || query.Check(0.99) {
+		t.Errorf("expected only values above the threshold to pass, got %+v", query)
+	}
+
+	for _, spec := range []string{"errorrate:rate(errors[1m])", "errorrate<0.01", "<0.01:up", "errorrate<low:up"} {
+		if _, err := ParseCanaryQuery(spec); err == nil {
+			t.Errorf("expected canary query '%s' to be invalid", spec)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package kube
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// ClientOptions 描述连接 Kubernetes 集群的方式
+type ClientOptions struct {
+	// Kubeconfig 为 kubeconfig 文件路径
+	Kubeconfig string
+	// KubeconfigData 为 kubeconfig 文件内容，可以是原文或 base64 编码，优先于 Kubeconfig
+	KubeconfigData string
+	// Context 为 kubeconfig 中使用的 context，为空时使用 current-context
+	Context string
+	// Token 为覆盖 kubeconfig 中认证方式的 bearer token
+	Token string
+}
+
+// NewRestConfig 依次尝试内联的 kubeconfig、kubeconfig 文件以及 Pod 内的 ServiceAccount 构造客户端配置。
+// kubeconfig 中的 exec 插件等认证方式由 client-go 原生支持
+func NewRestConfig(opts ClientOptions) (*rest.Config, error) {
+	config, err := newRestConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !helpers.IsBlank(opts.Token) {
+		config.BearerToken = strings.TrimSpace(opts.Token)
+		config.BearerTokenFile = ""
+		config.Username = ""
+		config.Password = ""
+		config.AuthProvider = nil
+		config.ExecProvider = nil
+		config.CertData = nil
+		config.CertFile = ""
+		config.KeyData = nil
+		config.KeyFile = ""
+	}
+
+	return config, nil
+}
+
+func newRestConfig(opts ClientOptions) (*rest.Config, error) {
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+	}
+
+	if !helpers.IsBlank(opts.KubeconfigData) {
+		kubeconfig, err := clientcmd.Load(decodeKubeconfig(opts.KubeconfigData))
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig data: %v", err)
+		}
+		config, err := clientcmd.NewNonInteractiveClientConfig(*kubeconfig, opts.Context, overrides, nil).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig data: %v", err)
+		}
+		return config, nil
+	}
+
+	exist, err := helpers.IsFileExist(opts.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	if exist {
+		config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(&clientcmd.ClientConfigLoadingRules{
+			ExplicitPath: opts.Kubeconfig,
+		}, overrides).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig %s: %v", opts.Kubeconfig, err)
+		}
+		return config, nil
+	}
+
+	// 运行在集群内时使用 Pod 挂载的 ServiceAccount
+	config, err := rest.InClusterConfig()
+	if err == rest.ErrNotInCluster {
+		return nil, fmt.Errorf("kubeconfig does not exist")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load in-cluster config: %v", err)
+	}
+	if !helpers.IsBlank(opts.Context) {
+		return nil, fmt.Errorf("kube.context %s requires a kubeconfig, none is available in cluster", opts.Context)
+	}
+	return config, nil
+}
+
+// decodeKubeconfig 兼容 base64 编码的 kubeconfig
+func decodeKubeconfig(data string) []byte {
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data)); err == nil {
+		return decoded
+	}
+	return []byte(data)
+}
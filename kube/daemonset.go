@@ -0,0 +1,155 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DaemonSetOptions 用于配置 DaemonSet 创建或更新的选项
+type DaemonSetOptions struct {
+	HostNetwork       bool     `form:"hostnetwork" json:"hostnetwork"`
+	HostPaths         []string `form:"hostpaths" json:"hostpaths"`
+	DeploymentOptions DeploymentOptions
+}
+
+func CreateOrUpdateDaemonSet(clientset kubernetes.Interface, ctx context.Context, opts DaemonSetOptions, logHandler func(msg string)) error {
+	maxSurge := intstr.Parse(opts.DeploymentOptions.RollingUpdate.MaxSurge)
+	maxUnavailable := intstr.Parse(opts.DeploymentOptions.RollingUpdate.MaxUnavailable)
+
+	// 使用宿主机网络时，同一节点上新旧 Pod 会争抢端口，只能先停旧 Pod 再启动新 Pod；百分比向上取整，如 25% 也会 surge
+	surge, err := intstr.GetScaledValueFromIntOrPercent(&maxSurge, 100, true)
+	if err != nil {
+		return fmt.Errorf("invalid maxsurge '%s': %v", opts.DeploymentOptions.RollingUpdate.MaxSurge, err)
+	}
+	if opts.HostNetwork && surge != 0 {
+		logHandler("host network enabled, daemonset rolling update falls back to maxsurge=0 and maxunavailable=1")
+		maxSurge = intstr.FromInt32(0)
+		maxUnavailable = intstr.FromInt32(1)
+	}
+
+	template, err := newPodTemplateSpec(opts.DeploymentOptions)
+	if err != nil {
+		return err
+	}
+
+	if opts.HostNetwork {
+		template.Spec.HostNetwork = true
+		template.Spec.DNSPolicy = corev1.DNSClusterFirstWithHostNet
+	}
+
+	if err := setHostPathVolumes(&template, opts.HostPaths); err != nil {
+		return fmt.Errorf("failed to set host path: %v", err)
+	}
+
+	if opts.DeploymentOptions.VolumeMount.Enabled {
+		if err := setPVCVolume(clientset, ctx, &template, opts.DeploymentOptions); err != nil {
+			return err
+		}
+	}
+
+	if _, err := setVolumes(&template, opts.DeploymentOptions, false); err != nil {
+		return err
+	}
+
+	daemonSet := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.DeploymentOptions.Name,
+			Namespace: opts.DeploymentOptions.Namespace,
+			Labels:    ownerLabels(opts.DeploymentOptions.Name),
+		},
+		Spec: appsv1.DaemonSetSpec{
+			UpdateStrategy: appsv1.DaemonSetUpdateStrategy{
+				Type: appsv1.RollingUpdateDaemonSetStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDaemonSet{
+					MaxSurge:       &maxSurge,
+					MaxUnavailable: &maxUnavailable,
+				},
+			},
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": opts.DeploymentOptions.Name,
+				},
+			},
+			Template:        template,
+			MinReadySeconds: opts.DeploymentOptions.MinReadySeconds,
+		},
+	}
+	if opts.DeploymentOptions.RevisionHistoryLimit > 0 {
+		daemonSet.Spec.RevisionHistoryLimit = &opts.DeploymentOptions.RevisionHistoryLimit
+	}
+	if err := setLastApplied(&daemonSet.ObjectMeta, daemonSet.Spec); err != nil {
+		return err
+	}
+
+	if _, err := clientset.AppsV1().DaemonSets(daemonSet.Namespace).Create(ctx, daemonSet, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create daemonset resource: %v", err)
+		}
+		logHandler("daemonset resource already exists, attempting update...")
+		if _, err := clientset.AppsV1().DaemonSets(daemonSet.Namespace).Update(ctx, daemonSet, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update daemonset resource: %v", err)
+		}
+		logHandler("daemonset resource successfully updated")
+	} else {
+		logHandler("daemonset resource successfully created")
+	}
+
+	return nil
+}
+
+func DeleteDaemonSet(clientset kubernetes.Interface, ctx context.Context, opts DaemonSetOptions, logHandler func(msg string)) error {
+	name := opts.DeploymentOptions.Name
+	namespace := opts.DeploymentOptions.Namespace
+	err := clientset.AppsV1().DaemonSets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete daemonset resource: %v", err)
+	}
+	if apierrors.IsNotFound(err) {
+		logHandler(fmt.Sprintf("daemonset resource %s in namespace %s not found, no action taken\n", name, namespace))
+	} else {
+		logHandler(fmt.Sprintf("daemonset resource %s in namespace %s successfully deleted\n", name, namespace))
+	}
+	return nil
+}
+
+// setHostPathVolumes 按 hostPath:mountPath[:ro] 格式挂载宿主机目录
+func setHostPathVolumes(template *corev1.PodTemplateSpec, hostPaths []string) error {
+	for i, hostPath := range hostPaths {
+		parts := strings.Split(hostPath, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("invalid format for host path: '%s', expected 'hostPath:mountPath[:ro]'", hostPath)
+		}
+
+		readOnly := false
+		if len(parts) == 3 {
+			if strings.ToLower(parts[2]) != "ro" {
+				return fmt.Errorf("invalid mount option for host path: '%s', expected 'ro'", hostPath)
+			}
+			readOnly = true
+		}
+
+		name := fmt.Sprintf("hostpath-%d", i)
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: parts[0],
+				},
+			},
+		})
+		template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: parts[1],
+			ReadOnly:  readOnly,
+		})
+	}
+	return nil
+}
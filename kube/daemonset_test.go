@@ -0,0 +1,95 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateDaemonSet(t *testing.T) {
+	ctx := context.Background()
+	opts := DaemonSetOptions{
+		HostNetwork:       true,
+		HostPaths:         []string{"/var/log:/host/log"},
+		DeploymentOptions: newTestDeploymentOptions(),
+	}
+	opts.DeploymentOptions.RollingUpdate.MaxSurge = "1"
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateDaemonSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	daemonSet, err := clientset.AppsV1().DaemonSets(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !daemonSet.Spec.Template.Spec.HostNetwork || daemonSet.Spec.Template.Spec.DNSPolicy != corev1.DNSClusterFirstWithHostNet {
+		t.Errorf("expected host network with dns policy %s", corev1.DNSClusterFirstWithHostNet)
+	}
+	// 使用宿主机网络时不能 surge
+	if daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxSurge.IntValue() != 0 {
+		t.Errorf("expected maxsurge 0, got %s", daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxSurge.String())
+	}
+	if len(daemonSet.Spec.Template.Spec.Volumes) != 1 || daemonSet.Spec.Template.Spec.Volumes[0].HostPath.Path != "/var/log" {
+		t.Errorf("expected host path /var/log to be mounted, got %v", daemonSet.Spec.Template.Spec.Volumes)
+	}
+	logs.assertContains(t, "falls back to maxsurge=0")
+	logs.assertContains(t, "successfully created")
+
+	if err := CreateOrUpdateDaemonSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	failOn(clientset, "update", "daemonsets")
+	assertErrorContains(t, CreateOrUpdateDaemonSet(clientset, ctx, opts, logs.handle), "failed to update daemonset resource")
+}
+
+func TestCreateOrUpdateDaemonSetWithPercentageSurge(t *testing.T) {
+	ctx := context.Background()
+	opts := DaemonSetOptions{HostNetwork: true, DeploymentOptions: newTestDeploymentOptions()}
+	opts.DeploymentOptions.RollingUpdate.MaxSurge = "25%"
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateDaemonSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	daemonSet, err := clientset.AppsV1().DaemonSets(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxSurge := daemonSet.Spec.UpdateStrategy.RollingUpdate.MaxSurge; maxSurge.String() != "0" {
+		t.Errorf("expected a percentage surge to fall back to 0 with host network, got %s", maxSurge.String())
+	}
+	logs.assertContains(t, "falls back to maxsurge=0")
+
+	// 无法解析的 maxsurge 不论是否使用宿主机网络都报错
+	for _, hostNetwork := range []bool{true, false} {
+		opts.HostNetwork = hostNetwork
+		opts.DeploymentOptions.RollingUpdate.MaxSurge = "abc"
+		assertErrorContains(t, CreateOrUpdateDaemonSet(clientset, ctx, opts, logs.handle), "invalid maxsurge 'abc'")
+	}
+}
+
+func TestDeleteDaemonSet(t *testing.T) {
+	ctx := context.Background()
+	opts := DaemonSetOptions{DeploymentOptions: DeploymentOptions{Name: "hellogo", Namespace: testNamespace}}
+
+	clientset := fake.NewSimpleClientset(&appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteDaemonSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteDaemonSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+}
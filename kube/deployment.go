@@ -3,8 +3,6 @@ package kube
 import (
 	"context"
 	"fmt"
-	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/guobinqiu/appdeployer/helpers"
@@ -17,10 +15,23 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	WorkloadDeployment  = "deployment"
+	WorkloadStatefulSet = "statefulset"
+	WorkloadDaemonSet   = "daemonset"
+)
+
 const (
 	ProbeTypeHTTPGet   = "httpget"
 	ProbeTypeExec      = "exec"
 	ProbeTypeTCPSocket = "tcpsocket"
+	ProbeTypeGRPC      = "grpc"
+)
+
+const (
+	PullPolicyAlways       = "always"
+	PullPolicyIfNotPresent = "ifnotpresent"
+	PullPolicyNever        = "never"
 )
 
 // DeploymentOptions 用于配置 Deployment 创建或更新的选项
@@ -35,7 +46,34 @@ type DeploymentOptions struct {
 	EnvVars        []string       `form:"envs" json:"envs"`
 	LivenessProbe  LivenessProbe  `form:"livenessprobe" json:"livenessprobe"`
 	ReadinessProbe ReadinessProbe `form:"readinessprobe" json:"readinessprobe"`
+	StartupProbe   StartupProbe   `form:"startupprobe" json:"startupprobe"`
 	VolumeMount    VolumeMount    `form:"volumemount" json:"volumemount"`
+	Volumes        []Volume       `form:"volumes" json:"volumes"`
+
+	// Strategy 为 rollingupdate 或 recreate，仅用于 Deployment
+	Strategy        string `form:"strategy" json:"strategy"`
+	MinReadySeconds int32  `form:"minreadyseconds" json:"minreadyseconds"`
+	// ProgressDeadlineSeconds 仅用于 Deployment，为 0 时使用默认的 600 秒
+	ProgressDeadlineSeconds int32 `form:"progressdeadlineseconds" json:"progressdeadlineseconds"`
+	// RevisionHistoryLimit 为保留的历史版本数，为 0 时使用默认的 10 个
+	RevisionHistoryLimit          int32     `form:"revisionhistorylimit" json:"revisionhistorylimit"`
+	TerminationGracePeriodSeconds int64     `form:"terminationgraceperiodseconds" json:"terminationgraceperiodseconds"`
+	Lifecycle                     Lifecycle `form:"lifecycle" json:"lifecycle"`
+
+	// ImagePullPolicy 为 always、ifnotpresent 或 never，为空时使用 ifnotpresent；按摘要部署时镜像内容不会变化，无需每次拉取
+	ImagePullPolicy string `form:"imagepullpolicy" json:"imagepullpolicy"`
+
+	// Metrics 取自 kube.metrics，用于添加指标端口与 prometheus.io 注解
+	Metrics MetricsOptions
+
+	// ServiceAccountName 为 Pod 使用的 ServiceAccount，为空时使用命名空间的 default
+	ServiceAccountName string
+	// ImagePullSecrets 在不创建应用的 ServiceAccount 时直接加入 Pod
+	ImagePullSecrets []string
+
+	// App 为 Deployment 所属的应用，为空时取 Name；Component 标记应用的附属资源，如金丝雀的 Deployment
+	App       string
+	Component string
 }
 
 type RollingUpdate struct {
@@ -44,29 +82,37 @@ type RollingUpdate struct {
 }
 
 type Quota struct {
-	CPURequest string `form:"cpurequst" json:"cpurequst"`
-	CPULimit   string `form:"cpulimit" json:"cpulimit"`
-	MemRequest string `form:"memrequest" json:"memrequest"`
-	MemLimit   string `form:"memlimit" json:"memlimit"`
+	CPURequest              string   `form:"cpurequst" json:"cpurequst"`
+	CPULimit                string   `form:"cpulimit" json:"cpulimit"`
+	MemRequest              string   `form:"memrequest" json:"memrequest"`
+	MemLimit                string   `form:"memlimit" json:"memlimit"`
+	EphemeralStorageRequest string   `form:"ephemeralstoragerequest" json:"ephemeralstoragerequest"`
+	EphemeralStorageLimit   string   `form:"ephemeralstoragelimit" json:"ephemeralstoragelimit"`
+	Extended                []string `form:"extended" json:"extended"`
 }
 
 type LivenessProbe struct {
-	Enabled bool   `form:"enabled" json:"enabled"`
-	Type    string `form:"type" json:"type"`
-	Path    string `form:"path" json:"path"`
-	Port    string
-	Scheme  string `form:"scheme" json:"scheme"`
-	Command string `form:"command" json:"command"`
-	ProbeParams
+	ProbeOptions
 }
 
 type ReadinessProbe struct {
-	Enabled bool   `form:"enabled" json:"enabled"`
-	Type    string `form:"type" json:"type"`
-	Path    string `form:"path" json:"path"`
-	Port    string
-	Scheme  string `form:"scheme" json:"scheme"`
-	Command string `form:"command" json:"command"`
+	ProbeOptions
+}
+
+type StartupProbe struct {
+	ProbeOptions
+}
+
+type ProbeOptions struct {
+	Enabled bool     `form:"enabled" json:"enabled"`
+	Type    string   `form:"type" json:"type"`
+	Path    string   `form:"path" json:"path"`
+	Port    string   `form:"port" json:"port"`
+	Host    string   `form:"host" json:"host"`
+	Scheme  string   `form:"scheme" json:"scheme"`
+	Headers []string `form:"headers" json:"headers"`
+	Command string   `form:"command" json:"command"`
+	Service string   `form:"service" json:"service"`
 	ProbeParams
 }
 
@@ -76,33 +122,55 @@ type ProbeParams struct {
 	PeriodSeconds       int32 `form:"periodseconds" json:"periodseconds"`
 	SuccessThreshold    int32 `form:"successthreshold" json:"successthreshold"`
 	FailureThreshold    int32 `form:"failurethreshold" json:"failurethreshold"`
+	// 探针失败后终止 Pod 的宽限期，为 0 时使用 Pod 级别的配置
+	TerminationGracePeriodSeconds int64 `form:"terminationgraceperiodseconds" json:"terminationgraceperiodseconds"`
 }
 
 type VolumeMount struct {
 	Enabled   bool   `form:"enabled" json:"enabled"`
 	MountPath string `form:"mountpath" json:"mountpath"`
+	// 挂载的 PVC 名称，为空时使用应用名称；迁移存储后指向新的 PVC
+	ClaimName string
 }
 
-func CreateOrUpdateDeployment(clientset *kubernetes.Clientset, ctx context.Context, opts DeploymentOptions, logHandler func(msg string)) error {
-	maxSurge := intstr.Parse(opts.RollingUpdate.MaxSurge)
-	maxUnavailable := intstr.Parse(opts.RollingUpdate.MaxUnavailable)
+func CreateOrUpdateDeployment(clientset kubernetes.Interface, ctx context.Context, opts DeploymentOptions, logHandler func(msg string)) error {
+	strategy, err := newDeploymentStrategy(opts)
+	if err != nil {
+		return err
+	}
+
+	template, err := newPodTemplateSpec(opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.VolumeMount.Enabled {
+		if err := setPVCVolume(clientset, ctx, &template, opts); err != nil {
+			return err
+		}
+	}
+
+	if _, err := setVolumes(&template, opts, false); err != nil {
+		return err
+	}
+
+	app := opts.App
+	if app == "" {
+		app = opts.Name
+	}
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels:    componentLabels(app, opts.Component),
 		},
 
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &opts.Replicas,
 
-			Strategy: appsv1.DeploymentStrategy{
-				Type: appsv1.RollingUpdateDeploymentStrategyType,
-				RollingUpdate: &appsv1.RollingUpdateDeployment{
-					MaxSurge:       &maxSurge,
-					MaxUnavailable: &maxUnavailable,
-				},
-			},
+			Strategy:        strategy,
+			MinReadySeconds: opts.MinReadySeconds,
 
 			Selector: &metav1.LabelSelector{
 				MatchLabels: map[string]string{
@@ -110,72 +178,20 @@ func CreateOrUpdateDeployment(clientset *kubernetes.Clientset, ctx context.Conte
 				},
 			},
 
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"name": opts.Name,
-					},
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:            opts.Name,
-							Image:           opts.Image,
-							ImagePullPolicy: corev1.PullAlways,
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: opts.Port,
-								},
-							},
-						},
-					},
-					ServiceAccountName: opts.Name,
-				},
-			},
+			Template: template,
 		},
 	}
-
-	container := deployment.Spec.Template.Spec.Containers[0]
-	if err := setResource(&container, opts); err != nil {
-		return fmt.Errorf("failed to set resource: %v", err)
-	}
-	if err := setLivenessProbe(&container, opts); err != nil {
-		return fmt.Errorf("failed to set liveness probe: %v", err)
+	if opts.ProgressDeadlineSeconds > 0 {
+		deployment.Spec.ProgressDeadlineSeconds = &opts.ProgressDeadlineSeconds
 	}
-	if err := setReadinessProbe(&container, opts); err != nil {
-		return fmt.Errorf("failed to set readiness probe: %v", err)
+	if opts.RevisionHistoryLimit > 0 {
+		deployment.Spec.RevisionHistoryLimit = &opts.RevisionHistoryLimit
 	}
-	if err := setEnv(&container, opts); err != nil {
-		return fmt.Errorf("failed to set env: %v", err)
+	if err := setLastApplied(&deployment.ObjectMeta, deployment.Spec); err != nil {
+		return err
 	}
-	deployment.Spec.Template.Spec.Containers[0] = container
 
-	if opts.VolumeMount.Enabled {
-		pvc, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to get pvc: %v", err)
-		}
-
-		deployment.Spec.Template.Spec.Volumes = []corev1.Volume{
-			{
-				Name: "data",
-				VolumeSource: corev1.VolumeSource{
-					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
-						ClaimName: pvc.Name,
-					},
-				},
-			},
-		}
-
-		deployment.Spec.Template.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
-			{
-				Name:      "data",
-				MountPath: opts.VolumeMount.MountPath,
-			},
-		}
-	}
-
-	_, err := clientset.AppsV1().Deployments(opts.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	_, err = clientset.AppsV1().Deployments(opts.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
 	if err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create deployment resource: %v", err)
@@ -193,7 +209,78 @@ func CreateOrUpdateDeployment(clientset *kubernetes.Clientset, ctx context.Conte
 	return nil
 }
 
-func DeleteDeployment(clientset *kubernetes.Clientset, ctx context.Context, opts DeploymentOptions, logHandler func(msg string)) error {
+// newPodTemplateSpec 构造各类工作负载（Deployment、StatefulSet、DaemonSet）共用的 Pod 模板
+func newPodTemplateSpec(opts DeploymentOptions) (corev1.PodTemplateSpec, error) {
+	pullPolicy, err := newPullPolicy(opts.ImagePullPolicy)
+	if err != nil {
+		return corev1.PodTemplateSpec{}, err
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{
+				"name": opts.Name,
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:            opts.Name,
+					Image:           opts.Image,
+					ImagePullPolicy: pullPolicy,
+					Ports: []corev1.ContainerPort{
+						{
+							Name:          "app",
+							ContainerPort: opts.Port,
+						},
+					},
+				},
+			},
+			ServiceAccountName: opts.ServiceAccountName,
+			ImagePullSecrets:   localObjectReferences(opts.ImagePullSecrets),
+		},
+	}
+
+	container := template.Spec.Containers[0]
+	if err := setResource(&container, opts); err != nil {
+		return template, fmt.Errorf("failed to set resource: %v", err)
+	}
+	if err := setLivenessProbe(&container, opts); err != nil {
+		return template, fmt.Errorf("failed to set liveness probe: %v", err)
+	}
+	if err := setReadinessProbe(&container, opts); err != nil {
+		return template, fmt.Errorf("failed to set readiness probe: %v", err)
+	}
+	if err := setStartupProbe(&container, opts); err != nil {
+		return template, fmt.Errorf("failed to set startup probe: %v", err)
+	}
+	if err := setEnv(&container, opts); err != nil {
+		return template, fmt.Errorf("failed to set env: %v", err)
+	}
+	template.Spec.Containers[0] = container
+	if err := setLifecycle(&template, opts); err != nil {
+		return template, fmt.Errorf("failed to set lifecycle: %v", err)
+	}
+	setMetrics(&template, opts)
+
+	return template, nil
+}
+
+// newPullPolicy 将配置的拉取策略转换为 Kubernetes 的 PullPolicy
+func newPullPolicy(policy string) (corev1.PullPolicy, error) {
+	switch strings.ToLower(policy) {
+	case "", PullPolicyIfNotPresent:
+		return corev1.PullIfNotPresent, nil
+	case PullPolicyAlways:
+		return corev1.PullAlways, nil
+	case PullPolicyNever:
+		return corev1.PullNever, nil
+	default:
+		return "", fmt.Errorf("unsupported image pull policy: '%s'", policy)
+	}
+}
+
+func DeleteDeployment(clientset kubernetes.Interface, ctx context.Context, opts DeploymentOptions, logHandler func(msg string)) error {
 	err := clientset.AppsV1().Deployments(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete deployment resource: %v", err)
@@ -206,87 +293,126 @@ func DeleteDeployment(clientset *kubernetes.Clientset, ctx context.Context, opts
 	return nil
 }
 
-func parseCPUSize(input string) (*resource.Quantity, error) {
-	re, err := regexp.Compile(`^(\d+)m$`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compile regex: %w", err)
-	}
-
-	matches := re.FindStringSubmatch(input)
-	if matches == nil {
-		return nil, fmt.Errorf("invalid cpu format, expected 'number{m}', got '%s'", input)
+// setPVCVolume 将应用的 PVC（默认以应用命名）挂载到 Pod 模板中
+func setPVCVolume(clientset kubernetes.Interface, ctx context.Context, template *corev1.PodTemplateSpec, opts DeploymentOptions) error {
+	claimName := opts.VolumeMount.ClaimName
+	if claimName == "" {
+		claimName = opts.Name
 	}
 
-	value, err := strconv.ParseInt(matches[1], 10, 64)
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Get(ctx, claimName, metav1.GetOptions{})
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse cpu value: %w", err)
+		return fmt.Errorf("failed to get pvc: %v", err)
 	}
 
-	return resource.NewMilliQuantity(value, resource.DecimalSI), nil
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+		Name: "data",
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: pvc.Name,
+			},
+		},
+	})
+
+	template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+		Name:      "data",
+		MountPath: opts.VolumeMount.MountPath,
+	})
+
+	return nil
 }
 
-func parseMemorySize(input string) (*resource.Quantity, error) {
-	re, err := regexp.Compile(`^(\d+)([kmg]i)$`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to compile regex: %w", err)
-	}
+// binarySuffixes 二进制单位的小写写法到标准写法的映射
+var binarySuffixes = map[string]string{"ki": "Ki", "mi": "Mi", "gi": "Gi", "ti": "Ti", "pi": "Pi", "ei": "Ei"}
 
-	matches := re.FindStringSubmatch(input)
-	if matches == nil {
-		return nil, fmt.Errorf("invalid memory format, expected 'number{Ki|Mi|Gi}', got '%s'", input)
+// normalizeQuantity 兼容旧版本大小写不敏感的写法：cpu 统一转小写（500M 即 500m），二进制单位修正为 Ki/Mi/Gi 等
+func normalizeQuantity(name corev1.ResourceName, input string) string {
+	input = strings.TrimSpace(input)
+	if name == corev1.ResourceCPU {
+		return strings.ToLower(input)
 	}
+	if len(input) > 2 {
+		if suffix, ok := binarySuffixes[strings.ToLower(input[len(input)-2:])]; ok {
+			return input[:len(input)-2] + suffix
+		}
+	}
+	return input
+}
 
-	value, err := strconv.ParseInt(matches[1], 10, 64)
+// parseQuantity 按 Kubernetes 的数量语法解析资源大小，如 500m、0.5、1G、512Mi，二进制单位不区分大小写
+func parseQuantity(name corev1.ResourceName, input string) (resource.Quantity, error) {
+	quantity, err := resource.ParseQuantity(normalizeQuantity(name, input))
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse memory value: %w", err)
-	}
-
-	var bytesValue int64
-	unit := matches[2]
-	switch unit {
-	case "ki":
-		bytesValue = value << 10 //1KiB = 2^10B
-	case "mi":
-		bytesValue = value << 20 //1MiB = 2^20B
-	case "gi":
-		bytesValue = value << 30 //1GiB = 2^30B
-	default:
-		return nil, fmt.Errorf("unsupported memory unit: '%s'", unit)
+		return quantity, fmt.Errorf("invalid %s quantity '%s': %v", name, input, err)
+	}
+	if quantity.Sign() < 0 {
+		return quantity, fmt.Errorf("invalid %s quantity '%s': must not be negative", name, input)
 	}
-	return resource.NewQuantity(bytesValue, resource.BinarySI), nil
+	return quantity, nil
 }
 
-func setResource(container *corev1.Container, opts DeploymentOptions) error {
-	limits := corev1.ResourceList{}
-	if !helpers.IsBlank(opts.Quota.CPULimit) {
-		cpuLimit, err := parseCPUSize(strings.ToLower(opts.Quota.CPULimit))
-		if err != nil {
-			return err
+// newResourceList 解析 name=quantity 形式的资源列表
+func newResourceList(pairs []string) (corev1.ResourceList, error) {
+	list := corev1.ResourceList{}
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || helpers.IsBlank(parts[0]) {
+			return nil, fmt.Errorf("invalid format for resource: '%s', expected 'name=quantity'", pair)
 		}
-		limits[corev1.ResourceCPU] = *cpuLimit
-	}
-	if !helpers.IsBlank(opts.Quota.MemLimit) {
-		memLimit, err := parseMemorySize(strings.ToLower(opts.Quota.MemLimit))
+		name := corev1.ResourceName(strings.TrimSpace(parts[0]))
+		quantity, err := parseQuantity(name, parts[1])
 		if err != nil {
-			return err
+			return nil, err
 		}
-		limits[corev1.ResourceMemory] = *memLimit
+		list[name] = quantity
 	}
+	return list, nil
+}
 
+func setResource(container *corev1.Container, opts DeploymentOptions) error {
+	limits := corev1.ResourceList{}
 	requests := corev1.ResourceList{}
-	if !helpers.IsBlank(opts.Quota.CPURequest) {
-		cpuRequest, err := parseCPUSize(strings.ToLower(opts.Quota.CPURequest))
-		if err != nil {
-			return err
+	for _, r := range []struct {
+		name    corev1.ResourceName
+		limit   string
+		request string
+	}{
+		{corev1.ResourceCPU, opts.Quota.CPULimit, opts.Quota.CPURequest},
+		{corev1.ResourceMemory, opts.Quota.MemLimit, opts.Quota.MemRequest},
+		{corev1.ResourceEphemeralStorage, opts.Quota.EphemeralStorageLimit, opts.Quota.EphemeralStorageRequest},
+	} {
+		if !helpers.IsBlank(r.limit) {
+			limit, err := parseQuantity(r.name, r.limit)
+			if err != nil {
+				return err
+			}
+			limits[r.name] = limit
+		}
+		if !helpers.IsBlank(r.request) {
+			request, err := parseQuantity(r.name, r.request)
+			if err != nil {
+				return err
+			}
+			requests[r.name] = request
+		}
+		if limit, ok := limits[r.name]; ok {
+			if request, ok := requests[r.name]; ok && request.Cmp(limit) > 0 {
+				return fmt.Errorf("%s request %s exceeds its limit %s", r.name, request.String(), limit.String())
+			}
 		}
-		requests[corev1.ResourceCPU] = *cpuRequest
 	}
-	if !helpers.IsBlank(opts.Quota.MemRequest) {
-		memRequest, err := parseMemorySize(strings.ToLower(opts.Quota.MemRequest))
-		if err != nil {
-			return err
+
+	// 扩展资源（如 nvidia.com/gpu）不允许超售，request 必须等于 limit
+	extended, err := newResourceList(opts.Quota.Extended)
+	if err != nil {
+		return err
+	}
+	for name, quantity := range extended {
+		if !strings.Contains(string(name), "/") {
+			return fmt.Errorf("invalid extended resource '%s', expected a domain-prefixed name such as nvidia.com/gpu", name)
 		}
-		requests[corev1.ResourceMemory] = *memRequest
+		limits[name] = quantity
+		requests[name] = quantity
 	}
 
 	if len(limits) > 0 || len(requests) > 0 {
@@ -308,25 +434,9 @@ func setLivenessProbe(container *corev1.Container, opts DeploymentOptions) error
 		return nil
 	}
 
-	var probe Probe
-	probeType := strings.ToLower(opts.LivenessProbe.Type)
-	switch probeType {
-	case ProbeTypeHTTPGet:
-		probe = HttpGetProbe{
-			Path:   opts.LivenessProbe.Path,
-			Port:   intstr.FromInt32(opts.Port),
-			Scheme: corev1.URIScheme(strings.ToUpper(opts.LivenessProbe.Scheme)),
-		}
-	case ProbeTypeExec:
-		probe = ExecProbe{
-			Command: opts.LivenessProbe.Command,
-		}
-	case ProbeTypeTCPSocket:
-		probe = TCPSocketProbe{
-			Port: intstr.FromInt32(opts.Port),
-		}
-	default:
-		return fmt.Errorf("unsupported liveness probe type: '%s'", probeType)
+	probe, err := newProbe(opts.LivenessProbe.ProbeOptions, opts.Port)
+	if err != nil {
+		return err
 	}
 
 	container.LivenessProbe = probe.GetProbe()
@@ -338,45 +448,119 @@ func setReadinessProbe(container *corev1.Container, opts DeploymentOptions) erro
 		return nil
 	}
 
-	var probe Probe
-	probeType := strings.ToLower(opts.ReadinessProbe.Type)
+	// Kubernetes 不允许就绪探针设置 terminationGracePeriodSeconds
+	if opts.ReadinessProbe.TerminationGracePeriodSeconds > 0 {
+		return fmt.Errorf("terminationgraceperiodseconds is not supported by readiness probe")
+	}
+
+	probe, err := newProbe(opts.ReadinessProbe.ProbeOptions, opts.Port)
+	if err != nil {
+		return err
+	}
+
+	container.ReadinessProbe = probe.GetProbe()
+	return nil
+}
+
+func setStartupProbe(container *corev1.Container, opts DeploymentOptions) error {
+	if !opts.StartupProbe.Enabled {
+		return nil
+	}
+
+	probe, err := newProbe(opts.StartupProbe.ProbeOptions, opts.Port)
+	if err != nil {
+		return err
+	}
+
+	container.StartupProbe = probe.GetProbe()
+	return nil
+}
+
+// newProbe 根据探针类型构造探针，未指定端口时使用容器端口
+func newProbe(opts ProbeOptions, containerPort int32) (Probe, error) {
+	port := intstr.FromInt32(containerPort)
+	if !helpers.IsBlank(opts.Port) {
+		port = intstr.Parse(strings.TrimSpace(opts.Port))
+	}
+
+	probeType := strings.ToLower(opts.Type)
 	switch probeType {
 	case ProbeTypeHTTPGet:
-		probe = HttpGetProbe{
-			Path:   opts.ReadinessProbe.Path,
-			Port:   intstr.FromInt32(opts.Port),
-			Scheme: corev1.URIScheme(strings.ToUpper(opts.ReadinessProbe.Scheme)),
+		headers, err := newHTTPHeaders(opts.Headers)
+		if err != nil {
+			return nil, err
 		}
+		return HttpGetProbe{
+			Path:        opts.Path,
+			Port:        port,
+			Host:        opts.Host,
+			Scheme:      corev1.URIScheme(strings.ToUpper(opts.Scheme)),
+			HTTPHeaders: headers,
+			ProbeParams: opts.ProbeParams,
+		}, nil
 	case ProbeTypeExec:
-		probe = ExecProbe{
-			Command: opts.ReadinessProbe.Command,
-		}
+		return ExecProbe{
+			Command:     opts.Command,
+			ProbeParams: opts.ProbeParams,
+		}, nil
 	case ProbeTypeTCPSocket:
-		probe = TCPSocketProbe{
-			Port: intstr.FromInt32(opts.Port),
+		return TCPSocketProbe{
+			Port:        port,
+			Host:        opts.Host,
+			ProbeParams: opts.ProbeParams,
+		}, nil
+	case ProbeTypeGRPC:
+		if port.Type != intstr.Int {
+			return nil, fmt.Errorf("grpc probe requires a numeric port, got '%s'", port.String())
 		}
+		return GRPCProbe{
+			Port:        port.IntVal,
+			Service:     opts.Service,
+			ProbeParams: opts.ProbeParams,
+		}, nil
 	default:
-		return fmt.Errorf("unsupported readiness probe type: '%s'", probeType)
+		return nil, fmt.Errorf("unsupported probe type: '%s'", probeType)
 	}
+}
 
-	container.ReadinessProbe = probe.GetProbe()
-	return nil
+// newHTTPHeaders 解析 Name:Value 格式的请求头
+func newHTTPHeaders(headers []string) ([]corev1.HTTPHeader, error) {
+	var httpHeaders []corev1.HTTPHeader
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || helpers.IsBlank(parts[0]) {
+			return nil, fmt.Errorf("invalid format for http header: '%s'", header)
+		}
+		httpHeaders = append(httpHeaders, corev1.HTTPHeader{
+			Name:  strings.TrimSpace(parts[0]),
+			Value: strings.TrimSpace(parts[1]),
+		})
+	}
+	return httpHeaders, nil
 }
 
 func setEnv(container *corev1.Container, opts DeploymentOptions) error {
+	envs, err := newEnvVars(opts.EnvVars)
+	if err != nil {
+		return err
+	}
+	if len(envs) > 0 {
+		container.Env = envs
+	}
+	return nil
+}
+
+func newEnvVars(envVars []string) ([]corev1.EnvVar, error) {
 	var envs []corev1.EnvVar
-	for _, envVar := range opts.EnvVars {
+	for _, envVar := range envVars {
 		parts := strings.Split(envVar, "=")
 		if len(parts) != 2 {
-			return fmt.Errorf("invalid format for environment variable: '%s'", envVar)
+			return nil, fmt.Errorf("invalid format for environment variable: '%s'", envVar)
 		}
 		envs = append(envs, corev1.EnvVar{
 			Name:  parts[0],
 			Value: parts[1],
 		})
 	}
-	if len(envs) > 0 {
-		container.Env = envs
-	}
-	return nil
+	return envs, nil
 }
@@ -0,0 +1,186 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestDeploymentOptions() DeploymentOptions {
+	return DeploymentOptions{
+		Name:      "hellogo",
+		Namespace: testNamespace,
+		Replicas:  2,
+		Image:     "guobinqiu/hellogo:latest",
+		Port:      8080,
+		RollingUpdate: RollingUpdate{
+			MaxSurge:       "25%",
+			MaxUnavailable: "0",
+		},
+		Quota: Quota{
+			CPURequest: "100m",
+			CPULimit:   "500m",
+			MemRequest: "128Mi",
+			MemLimit:   "256Mi",
+		},
+		EnvVars: []string{"TZ=Asia/Shanghai"},
+	}
+}
+
+func TestCreateOrUpdateDeployment(t *testing.T) {
+	ctx := context.Background()
+	opts := newTestDeploymentOptions()
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateDeployment(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != opts.Image {
+		t.Errorf("expected image %s, got %s", opts.Image, container.Image)
+	}
+	if cpu := container.Resources.Limits[corev1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("expected cpu limit 500m, got %s", cpu.String())
+	}
+	if len(container.Env) != 1 || container.Env[0].Value != "Asia/Shanghai" {
+		t.Errorf("unexpected env %v", container.Env)
+	}
+	logs.assertContains(t, "successfully created")
+
+	opts.Replicas = 3
+	if err := CreateOrUpdateDeployment(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	deployment, _ = clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if *deployment.Spec.Replicas != 3 {
+		t.Errorf("expected 3 replicas, got %d", *deployment.Spec.Replicas)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	failOn(clientset, "update", "deployments")
+	assertErrorContains(t, CreateOrUpdateDeployment(clientset, ctx, opts, logs.handle), "failed to update deployment resource")
+}
+
+func TestCreateOrUpdateDeploymentWithVolumeMount(t *testing.T) {
+	ctx := context.Background()
+	opts := newTestDeploymentOptions()
+	opts.VolumeMount = VolumeMount{Enabled: true, MountPath: "/data", ClaimName: "hellogo-1700000000"}
+
+	// PVC 不存在时不应创建 Deployment
+	clientset := fake.NewSimpleClientset()
+	assertErrorContains(t, CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}), "failed to get pvc")
+
+	clientset = fake.NewSimpleClientset(&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "hellogo-1700000000", Namespace: testNamespace}})
+	if err := CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	deployment, _ := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	volumes := deployment.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].PersistentVolumeClaim.ClaimName != "hellogo-1700000000" {
+		t.Errorf("expected the pvc hellogo-1700000000 to be mounted, got %v", volumes)
+	}
+}
+
+func TestCreateOrUpdateDeploymentInvalidOptions(t *testing.T) {
+	ctx := context.Background()
+	for name, mutate := range map[string]func(*DeploymentOptions){
+		"request exceeds limit": func(opts *DeploymentOptions) { opts.Quota.CPURequest = "1" },
+		"invalid quantity":      func(opts *DeploymentOptions) { opts.Quota.MemLimit = "lots" },
+		"invalid env":           func(opts *DeploymentOptions) { opts.EnvVars = []string{"TZ"} },
+		"extended without domain": func(opts *DeploymentOptions) {
+			opts.Quota.Extended = []string{"gpu=1"}
+		},
+		"unsupported probe": func(opts *DeploymentOptions) {
+			opts.LivenessProbe = LivenessProbe{ProbeOptions{Enabled: true, Type: "udp"}}
+		},
+		"unsupported pull policy": func(opts *DeploymentOptions) { opts.ImagePullPolicy = "sometimes" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts := newTestDeploymentOptions()
+			mutate(&opts)
+			clientset := fake.NewSimpleClientset()
+			if err := CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}); err == nil {
+				t.Fatal("expected an error")
+			}
+			if actions := clientset.Actions(); len(actions) != 0 {
+				t.Errorf("expected no api call, got %v", actions)
+			}
+		})
+	}
+}
+
+func TestSetResourceLowercaseUnits(t *testing.T) {
+	opts := newTestDeploymentOptions()
+	opts.Quota = Quota{CPURequest: "100M", CPULimit: "500m", MemRequest: "512mi", MemLimit: "1gi", EphemeralStorageLimit: "2GI"}
+	container := corev1.Container{}
+	if err := setResource(&container, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		got  resource.Quantity
+		want string
+	}{
+		{container.Resources.Requests[corev1.ResourceCPU], "100m"},
+		{container.Resources.Requests[corev1.ResourceMemory], "512Mi"},
+		{container.Resources.Limits[corev1.ResourceMemory], "1Gi"},
+		{container.Resources.Limits[corev1.ResourceEphemeralStorage], "2Gi"},
+	} {
+		if c.got.String() != c.want {
+			t.Errorf("expected %s, got %s", c.want, c.got.String())
+		}
+	}
+}
+
+func TestPodTemplatePullPolicy(t *testing.T) {
+	for policy, want := range map[string]corev1.PullPolicy{
+		"":             corev1.PullIfNotPresent,
+		"IfNotPresent": corev1.PullIfNotPresent,
+		"always":       corev1.PullAlways,
+		"Never":        corev1.PullNever,
+	} {
+		opts := newTestDeploymentOptions()
+		opts.Image = "guobinqiu/hellogo@sha256:4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945"
+		opts.ImagePullPolicy = policy
+		template, err := newPodTemplateSpec(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		container := template.Spec.Containers[0]
+		if container.ImagePullPolicy != want {
+			t.Errorf("expected pull policy %s for '%s', got %s", want, policy, container.ImagePullPolicy)
+		}
+		if container.Image != opts.Image {
+			t.Errorf("expected image %s, got %s", opts.Image, container.Image)
+		}
+	}
+}
+
+func TestDeleteDeployment(t *testing.T) {
+	ctx := context.Background()
+	opts := DeploymentOptions{Name: "hellogo", Namespace: testNamespace}
+
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteDeployment(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteDeployment(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+
+	failOn(clientset, "delete", "deployments")
+	assertErrorContains(t, DeleteDeployment(clientset, ctx, opts, logs.handle), "failed to delete deployment resource")
+}
@@ -1,6 +1,7 @@
 package kube
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -15,26 +16,50 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
+// PullSecretOptions 用于配置拉取镜像使用的 Secret
+type PullSecretOptions struct {
+	// Public 为 true 时镜像可匿名拉取，不创建 docker-<app> Secret
+	Public bool `form:"public" json:"public"`
+	// Existing 为命名空间中已存在的 pull secret，一并加入 ServiceAccount
+	Existing []string `form:"existing" json:"existing"`
+	// Registries 为需要合并到 docker-<app> Secret 中的其他仓库凭证
+	Registries []RegistryCredential `form:"registries" json:"registries"`
+}
+
+// RegistryCredential 为一个镜像仓库的登录凭证
+type RegistryCredential struct {
+	Registry string `form:"registry" json:"registry"`
+	Username string `form:"username" json:"username"`
+	Password string `form:"password" json:"password"`
+}
+
 type DockerSecretOptions struct {
-	Name      string
-	Namespace string
+	Name       string
+	Namespace  string
+	Registries []RegistryCredential
 	docker.DockerOptions
 }
 
-func CreateOrUpdateDockerSecret(clientset *kubernetes.Clientset, ctx context.Context, opts DockerSecretOptions, logHandler func(msg string)) error {
-	dockerconfigjson, err := buildDockerAuthConfig(opts.DockerOptions, logHandler)
+// DockerSecretName 返回应用的 pull secret 名称
+func DockerSecretName(name string) string {
+	return "docker-" + name
+}
+
+func CreateOrUpdateDockerSecret(clientset kubernetes.Interface, ctx context.Context, opts DockerSecretOptions, logHandler func(msg string)) error {
+	dockerconfigjson, err := buildDockerAuthConfig(opts, logHandler)
 	if err != nil {
 		return err
 	}
 
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "docker-" + opts.Name,
+			Name:      DockerSecretName(opts.Name),
 			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
 		},
 		Type: corev1.SecretTypeDockerConfigJson,
 		Data: map[string][]byte{
-			".dockerconfigjson": dockerconfigjson,
+			corev1.DockerConfigJsonKey: dockerconfigjson,
 		},
 	}
 
@@ -42,7 +67,32 @@ func CreateOrUpdateDockerSecret(clientset *kubernetes.Clientset, ctx context.Con
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create docker secret resource: %v", err)
 		}
-		logHandler("docker secret resource successfully updated")
+
+		// 仓库密码轮换后同步到集群
+		live, err := clientset.CoreV1().Secrets(opts.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get docker secret resource: %v", err)
+		}
+		labeled := setOwnerLabels(&live.ObjectMeta, opts.Name)
+		if !labeled && live.Type == secret.Type && bytes.Equal(live.Data[corev1.DockerConfigJsonKey], dockerconfigjson) {
+			logHandler("docker secret resource unchanged")
+			return nil
+		}
+		if live.Type != secret.Type {
+			// Secret 的类型不可变，只能重建
+			if err := clientset.CoreV1().Secrets(opts.Namespace).Delete(ctx, secret.Name, metav1.DeleteOptions{}); err != nil {
+				return fmt.Errorf("failed to delete docker secret resource: %v", err)
+			}
+			if _, err := clientset.CoreV1().Secrets(opts.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("failed to create docker secret resource: %v", err)
+			}
+		} else {
+			live.Data = secret.Data
+			if _, err := clientset.CoreV1().Secrets(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("failed to update docker secret resource: %v", err)
+			}
+		}
+		logHandler("docker secret resource successfully updated with the new credentials")
 	} else {
 		logHandler("docker secret resource successfully created")
 	}
@@ -50,19 +100,46 @@ func CreateOrUpdateDockerSecret(clientset *kubernetes.Clientset, ctx context.Con
 	return nil
 }
 
-func buildDockerAuthConfig(opts docker.DockerOptions, logHandler func(msg string)) ([]byte, error) {
-	var dockerConfig map[string]interface{}
+func DeleteDockerSecret(clientset kubernetes.Interface, ctx context.Context, opts DockerSecretOptions, logHandler func(msg string)) error {
+	name := DockerSecretName(opts.Name)
+	err := clientset.CoreV1().Secrets(opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete docker secret resource: %v", err)
+	}
+	if apierrors.IsNotFound(err) {
+		logHandler(fmt.Sprintf("docker secret resource %s in namespace %s not found, no action taken\n", name, opts.Namespace))
+	} else {
+		logHandler(fmt.Sprintf("docker secret resource %s in namespace %s successfully deleted\n", name, opts.Namespace))
+	}
+	return nil
+}
+
+// CheckPullSecrets 确认引用的 pull secret 存在且类型正确
+func CheckPullSecrets(clientset kubernetes.Interface, ctx context.Context, names []string, namespace string) error {
+	for _, name := range names {
+		secret, err := clientset.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("pull secret %s not found in namespace %s", name, namespace)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get pull secret %s: %v", name, err)
+		}
+		if secret.Type != corev1.SecretTypeDockerConfigJson && secret.Type != corev1.SecretTypeDockercfg {
+			return fmt.Errorf("secret %s is of type %s, pull secrets must be of type %s", name, secret.Type, corev1.SecretTypeDockerConfigJson)
+		}
+	}
+	return nil
+}
+
+// buildDockerAuthConfig 合并推送镜像的仓库凭证与其他仓库凭证，生成 dockerconfigjson
+func buildDockerAuthConfig(opts DockerSecretOptions, logHandler func(msg string)) ([]byte, error) {
+	auths := make(map[string]interface{})
 
 	if !helpers.IsBlank(opts.Registry) && !helpers.IsBlank(opts.Username) && !helpers.IsBlank(opts.Password) {
 		logHandler("Using username password auth")
 
-		// 构造Docker配置信息
-		dockerConfig = map[string]interface{}{
-			"auths": map[string]interface{}{
-				opts.Registry: map[string]string{
-					"auth": getAuthString(opts.Username, opts.Password),
-				},
-			},
+		auths[opts.Registry] = map[string]string{
+			"auth": getAuthString(opts.Username, opts.Password),
 		}
 	} else if !helpers.IsBlank(opts.Dockerconfig) {
 		logHandler("Using config file auth: " + opts.Dockerconfig)
@@ -73,6 +150,7 @@ func buildDockerAuthConfig(opts docker.DockerOptions, logHandler func(msg string
 			return nil, fmt.Errorf("failed to read Docker config file: %w", err)
 		}
 
+		var dockerConfig map[string]interface{}
 		if err := json.Unmarshal(configData, &dockerConfig); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal Docker config JSON: %w", err)
 		}
@@ -82,12 +160,27 @@ func buildDockerAuthConfig(opts docker.DockerOptions, logHandler func(msg string
 		if !ok || registryData[opts.Registry] == nil {
 			return nil, fmt.Errorf("no auth data found for registry %s in the provided Docker config", opts.Registry)
 		}
-	} else {
+		for registry, auth := range registryData {
+			auths[registry] = auth
+		}
+	} else if len(opts.Registries) == 0 {
 		return nil, fmt.Errorf("neither username/password nor config file specified")
 	}
 
-	// 将Docker配置JSON对象转换为[]byte
-	dockerConfigJSON, err := json.Marshal(dockerConfig)
+	for _, credential := range opts.Registries {
+		if helpers.IsBlank(credential.Registry) || helpers.IsBlank(credential.Username) || helpers.IsBlank(credential.Password) {
+			return nil, fmt.Errorf("registry, username and password are required for every pull secret registry")
+		}
+		logHandler("Adding username password auth of registry " + credential.Registry)
+		auths[credential.Registry] = map[string]string{
+			"auth": getAuthString(credential.Username, credential.Password),
+		}
+	}
+
+	// 将Docker配置JSON对象转换为[]byte，键有序，便于比对凭证是否变化
+	dockerConfigJSON, err := json.Marshal(map[string]interface{}{
+		"auths": auths,
+	})
 	if err != nil {
 		return nil, err
 	}
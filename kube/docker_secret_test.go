@@ -0,0 +1,171 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guobinqiu/appdeployer/docker"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateDockerSecret(t *testing.T) {
+	ctx := context.Background()
+	opts := DockerSecretOptions{
+		Name:      "hellogo",
+		Namespace: testNamespace,
+		DockerOptions: docker.DockerOptions{
+			Registry: "docker.io",
+			Username: "user",
+			Password: "pass",
+		},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateDockerSecret(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "docker-hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		t.Errorf("expected secret type %s, got %s", corev1.SecretTypeDockerConfigJson, secret.Type)
+	}
+	var config map[string]map[string]map[string]string
+	if err := json.Unmarshal(secret.Data[".dockerconfigjson"], &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["auths"]["docker.io"]["auth"] != getAuthString("user", "pass") {
+		t.Errorf("unexpected docker config %v", config)
+	}
+	logs.assertContains(t, "successfully created")
+
+	if err := CreateOrUpdateDockerSecret(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "unchanged")
+
+	// 密码轮换后更新 Secret
+	opts.Password = "rotated"
+	if err := CreateOrUpdateDockerSecret(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ = clientset.CoreV1().Secrets(testNamespace).Get(ctx, "docker-hellogo", metav1.GetOptions{})
+	if err := json.Unmarshal(secret.Data[".dockerconfigjson"], &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["auths"]["docker.io"]["auth"] != getAuthString("user", "rotated") {
+		t.Errorf("expected rotated credentials, got %v", config)
+	}
+	logs.assertContains(t, "successfully updated with the new credentials")
+
+	failOn(clientset, "update", "secrets")
+	opts.Password = "rotated-again"
+	assertErrorContains(t, CreateOrUpdateDockerSecret(clientset, ctx, opts, logs.handle), "failed to update docker secret resource")
+}
+
+func TestCreateOrUpdateDockerSecretWithRegistries(t *testing.T) {
+	ctx := context.Background()
+	opts := DockerSecretOptions{
+		Name:      "hellogo",
+		Namespace: testNamespace,
+		Registries: []RegistryCredential{
+			{Registry: "ghcr.io", Username: "bot", Password: "token"},
+		},
+		DockerOptions: docker.DockerOptions{Registry: "docker.io", Username: "user", Password: "pass"},
+	}
+
+	// 同名的 Opaque Secret 会被重建为 dockerconfigjson 类型
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "docker-hellogo", Namespace: testNamespace},
+		Type:       corev1.SecretTypeOpaque,
+	})
+	if err := CreateOrUpdateDockerSecret(clientset, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "docker-hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		t.Errorf("expected secret type %s, got %s", corev1.SecretTypeDockerConfigJson, secret.Type)
+	}
+	var config map[string]map[string]map[string]string
+	if err := json.Unmarshal(secret.Data[".dockerconfigjson"], &config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config["auths"]) != 2 || config["auths"]["ghcr.io"]["auth"] != getAuthString("bot", "token") {
+		t.Errorf("expected auths of docker.io and ghcr.io, got %v", config)
+	}
+
+	// 推送凭证缺失时只使用其他仓库的凭证
+	opts.Username, opts.Password, opts.Dockerconfig = "", "", ""
+	if err := CreateOrUpdateDockerSecret(fake.NewSimpleClientset(), ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Registries[0].Password = ""
+	assertErrorContains(t, CreateOrUpdateDockerSecret(fake.NewSimpleClientset(), ctx, opts, func(string) {}), "registry, username and password are required")
+}
+
+func TestDeleteDockerSecret(t *testing.T) {
+	ctx := context.Background()
+	opts := DockerSecretOptions{Name: "hellogo", Namespace: testNamespace}
+
+	clientset := fake.NewSimpleClientset(&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "docker-hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteDockerSecret(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteDockerSecret(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+}
+
+func TestCheckPullSecrets(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "regcred", Namespace: testNamespace}, Type: corev1.SecretTypeDockerConfigJson},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "app-config", Namespace: testNamespace}, Type: corev1.SecretTypeOpaque},
+	)
+
+	if err := CheckPullSecrets(clientset, ctx, []string{"regcred"}, testNamespace); err != nil {
+		t.Fatal(err)
+	}
+	assertErrorContains(t, CheckPullSecrets(clientset, ctx, []string{"regcred", "missing"}, testNamespace), "pull secret missing not found")
+	assertErrorContains(t, CheckPullSecrets(clientset, ctx, []string{"app-config"}, testNamespace), "is of type Opaque")
+}
+
+func TestCreateOrUpdateDockerSecretFromConfigFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"auths":{"docker.io":{"auth":"dXNlcjpwYXNz"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DockerSecretOptions{
+		Name:          "hellogo",
+		Namespace:     testNamespace,
+		DockerOptions: docker.DockerOptions{Registry: "docker.io", Dockerconfig: path},
+	}
+	if err := CreateOrUpdateDockerSecret(fake.NewSimpleClientset(), ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts.Registry = "ghcr.io"
+	err := CreateOrUpdateDockerSecret(fake.NewSimpleClientset(), ctx, opts, func(string) {})
+	assertErrorContains(t, err, "no auth data found for registry ghcr.io")
+
+	opts.Dockerconfig = ""
+	err = CreateOrUpdateDockerSecret(fake.NewSimpleClientset(), ctx, opts, func(string) {})
+	assertErrorContains(t, err, "neither username/password nor config file specified")
+}
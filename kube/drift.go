@@ -0,0 +1,334 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// LastAppliedAnnotation 记录 appdeployer 最近一次发布时提交的标签、注解与 spec，用于发现发布之外的修改
+const LastAppliedAnnotation = "appdeployer.io/last-applied"
+
+// driftKinds 为发布时记录了提交内容的资源
+var driftKinds = []string{WorkloadDeployment, WorkloadStatefulSet, WorkloadDaemonSet, KindService, KindIngress, KindHPA}
+
+// DriftOptions 用于配置漂移检查的选项
+type DriftOptions struct {
+	Name      string
+	Namespace string
+	// Reapply 为 true 时将发生漂移的资源恢复为最近一次发布的内容
+	Reapply bool
+}
+
+// Drift 为一个在 appdeployer 之外被修改的字段
+type Drift struct {
+	Kind string
+	Name string
+	// Path 为字段路径，如 spec.template.spec.containers[0].image
+	Path    string
+	Applied interface{}
+	Live    interface{}
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s %s: %s applied %s, live %s", d.Kind, d.Name, d.Path, formatDriftValue(d.Applied), formatDriftValue(d.Live))
+}
+
+func formatDriftValue(value interface{}) string {
+	if value == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// setLastApplied 将资源当前的标签、注解与 spec 记录到注解中，须在资源构造完成后、提交前调用
+func setLastApplied(meta *metav1.ObjectMeta, spec interface{}) error {
+	applied := map[string]interface{}{"spec": spec}
+	metadata := map[string]interface{}{}
+	if len(meta.Labels) > 0 {
+		metadata["labels"] = meta.Labels
+	}
+	if len(meta.Annotations) > 0 {
+		metadata["annotations"] = meta.Annotations
+	}
+	if len(metadata) > 0 {
+		applied["metadata"] = metadata
+	}
+
+	data, err := json.Marshal(applied)
+	if err != nil {
+		return fmt.Errorf("failed to record the applied spec of %s: %v", meta.Name, err)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	meta.Annotations[LastAppliedAnnotation] = string(data)
+	return nil
+}
+
+// updateLastApplied 修改资源记录的发布内容，使 day-2 操作做出的修改不被当作漂移，也不会在重新应用时被还原；
+// 未记录发布内容时不做处理，返回记录是否有变化
+func updateLastApplied(meta *metav1.ObjectMeta, mutate func(applied map[string]interface{})) (bool, error) {
+	data, found := meta.Annotations[LastAppliedAnnotation]
+	if !found {
+		return false, nil
+	}
+	var applied map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &applied); err != nil {
+		return false, fmt.Errorf("failed to parse the applied spec of %s: %v", meta.Name, err)
+	}
+	mutate(applied)
+	updated, err := json.Marshal(applied)
+	if err != nil {
+		return false, fmt.Errorf("failed to record the applied spec of %s: %v", meta.Name, err)
+	}
+	if string(updated) == data {
+		return false, nil
+	}
+	meta.Annotations[LastAppliedAnnotation] = string(updated)
+	return true, nil
+}
+
+// setAppliedSpecField 设置记录的 spec 中的一个字段
+func setAppliedSpecField(applied map[string]interface{}, key string, value interface{}) {
+	spec, ok := applied["spec"].(map[string]interface{})
+	if !ok {
+		spec = map[string]interface{}{}
+		applied["spec"] = spec
+	}
+	spec[key] = value
+}
+
+// CheckDrift 比对应用各资源最近一次发布的内容与集群中的现状，返回在 appdeployer 之外被修改的字段。
+// 只比对发布时提交过的字段，由集群补全的默认值与状态不算作漂移；存在 HPA 时副本数由 HPA 管理，也不算作漂移
+func CheckDrift(clientset kubernetes.Interface, ctx context.Context, opts DriftOptions, logHandler func(msg string)) ([]Drift, error) {
+	hpa, err := getObjectMeta(clientset, nil, ctx, OwnedObject{Kind: KindHPA, Name: opts.Name}, opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, kind := range driftKinds {
+		live, err := getObjectMeta(clientset, nil, ctx, OwnedObject{Kind: kind, Name: opts.Name}, opts.Namespace)
+		if err != nil {
+			return nil, err
+		}
+		if live == nil {
+			continue
+		}
+		applied, err := lastApplied(live, hpa != nil)
+		if err != nil {
+			return nil, err
+		}
+		if applied == nil {
+			continue
+		}
+		liveObject, err := toDriftObject(live)
+		if err != nil {
+			return nil, err
+		}
+
+		var objectDrifts []Drift
+		diffDrift("", applied, liveObject, func(path string, appliedValue, liveValue interface{}) {
+			objectDrifts = append(objectDrifts, Drift{Kind: kind, Name: opts.Name, Path: path, Applied: appliedValue, Live: liveValue})
+		})
+		for _, drift := range objectDrifts {
+			logHandler(fmt.Sprintf("drift: %s", drift))
+		}
+		drifts = append(drifts, objectDrifts...)
+
+		if len(objectDrifts) == 0 || !opts.Reapply {
+			continue
+		}
+		if err := reapply(clientset, ctx, kind, opts, hpa != nil); err != nil {
+			return nil, fmt.Errorf("failed to re-apply %s %s: %v", kind, opts.Name, err)
+		}
+		logHandler(fmt.Sprintf("%s %s re-applied with the last deployed spec", kind, opts.Name))
+	}
+	return drifts, nil
+}
+
+// lastApplied 读取资源记录的发布内容，未记录时返回 nil；存在 HPA 时去掉工作负载的副本数
+func lastApplied(live metav1.Object, hpaExists bool) (map[string]interface{}, error) {
+	data, found := live.GetAnnotations()[LastAppliedAnnotation]
+	if !found {
+		return nil, nil
+	}
+	var applied map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &applied); err != nil {
+		return nil, fmt.Errorf("failed to parse the applied spec of %s: %v", live.GetName(), err)
+	}
+	if spec, ok := applied["spec"].(map[string]interface{}); ok && hpaExists {
+		delete(spec, "replicas")
+	}
+	return applied, nil
+}
+
+// toDriftObject 将资源转换为与记录相同的 JSON 表示，使数字等类型可以直接比较
+func toDriftObject(object interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// diffDrift 递归比对记录的字段，映射中集群额外的键不比对，列表中多出的元素视为漂移
+func diffDrift(path string, applied, live interface{}, report func(path string, applied, live interface{})) {
+	switch applied := applied.(type) {
+	case map[string]interface{}:
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			report(path, applied, live)
+			return
+		}
+		keys := make([]string, 0, len(applied))
+		for key := range applied {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			liveValue, found := liveMap[key]
+			if !found && applied[key] == nil {
+				continue
+			}
+			diffDrift(strings.TrimPrefix(path+"."+key, "."), applied[key], liveValue, report)
+		}
+	case []interface{}:
+		liveList, ok := live.([]interface{})
+		if !ok {
+			report(path, applied, live)
+			return
+		}
+		for i, value := range applied {
+			if i >= len(liveList) {
+				report(fmt.Sprintf("%s[%d]", path, i), value, nil)
+				continue
+			}
+			diffDrift(fmt.Sprintf("%s[%d]", path, i), value, liveList[i], report)
+		}
+		for i := len(applied); i < len(liveList); i++ {
+			report(fmt.Sprintf("%s[%d]", path, i), nil, liveList[i])
+		}
+	default:
+		if !reflect.DeepEqual(applied, live) {
+			report(path, applied, live)
+		}
+	}
+}
+
+// mergeApplied 将记录的字段合并回资源，映射逐键合并以保留集群分配的字段（如 ClusterIP），列表与值整体替换
+func mergeApplied(live, applied map[string]interface{}) {
+	for key, value := range applied {
+		appliedMap, ok := value.(map[string]interface{})
+		liveMap, liveOk := live[key].(map[string]interface{})
+		if ok && liveOk {
+			mergeApplied(liveMap, appliedMap)
+			continue
+		}
+		if value == nil {
+			delete(live, key)
+			continue
+		}
+		live[key] = value
+	}
+}
+
+// reapply 将资源恢复为记录的发布内容，发生冲突时基于最新版本重试
+func reapply(clientset kubernetes.Interface, ctx context.Context, kind string, opts DriftOptions, hpaExists bool) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		live, err := getObjectMeta(clientset, nil, ctx, OwnedObject{Kind: kind, Name: opts.Name}, opts.Namespace)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			return fmt.Errorf("%s %s not found in namespace %s", kind, opts.Name, opts.Namespace)
+		}
+		applied, err := lastApplied(live, hpaExists)
+		if err != nil {
+			return err
+		}
+		object, err := toDriftObject(live)
+		if err != nil {
+			return err
+		}
+		mergeApplied(object, applied)
+		return updateDriftObject(clientset, ctx, kind, object)
+	})
+}
+
+// updateDriftObject 将合并后的资源转换回对应类型并更新
+func updateDriftObject(clientset kubernetes.Interface, ctx context.Context, kind string, object map[string]interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	decode := func(typed interface{}) error {
+		if err := json.Unmarshal(data, typed); err != nil {
+			return fmt.Errorf("failed to decode %s: %v", kind, err)
+		}
+		return nil
+	}
+
+	switch kind {
+	case WorkloadDeployment:
+		deployment := &appsv1.Deployment{}
+		if err := decode(deployment); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().Deployments(deployment.Namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+	case WorkloadStatefulSet:
+		statefulSet := &appsv1.StatefulSet{}
+		if err := decode(statefulSet); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().StatefulSets(statefulSet.Namespace).Update(ctx, statefulSet, metav1.UpdateOptions{})
+	case WorkloadDaemonSet:
+		daemonSet := &appsv1.DaemonSet{}
+		if err := decode(daemonSet); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().DaemonSets(daemonSet.Namespace).Update(ctx, daemonSet, metav1.UpdateOptions{})
+	case KindService:
+		service := &corev1.Service{}
+		if err := decode(service); err != nil {
+			return err
+		}
+		_, err = clientset.CoreV1().Services(service.Namespace).Update(ctx, service, metav1.UpdateOptions{})
+	case KindIngress:
+		ingress := &networkingv1.Ingress{}
+		if err := decode(ingress); err != nil {
+			return err
+		}
+		_, err = clientset.NetworkingV1().Ingresses(ingress.Namespace).Update(ctx, ingress, metav1.UpdateOptions{})
+	case KindHPA:
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+		if err := decode(hpa); err != nil {
+			return err
+		}
+		_, err = clientset.AutoscalingV2().HorizontalPodAutoscalers(hpa.Namespace).Update(ctx, hpa, metav1.UpdateOptions{})
+	default:
+		return fmt.Errorf("unsupported kind of drift object: '%s'", kind)
+	}
+	// 不包装错误，以便 RetryOnConflict 识别冲突
+	return err
+}
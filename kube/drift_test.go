@@ -0,0 +1,140 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckDrift(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	opts := newTestDeploymentOptions()
+	if err := CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateOrUpdateService(clientset, ctx, ServiceOptions{Name: "hellogo", Namespace: testNamespace, Port: 80, TargetPort: 8080}, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	driftOptions := DriftOptions{Name: "hellogo", Namespace: testNamespace}
+
+	drifts, err := CheckDrift(clientset, ctx, driftOptions, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Fatalf("expected no drift right after a deploy, got %v", drifts)
+	}
+
+	// 模拟 kubectl edit：修改镜像、加一个环境变量，并写入集群分配的 ClusterIP
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container := &deployment.Spec.Template.Spec.Containers[0]
+	container.Image = "guobinqiu/hellogo:hotfix"
+	container.Env = append(container.Env, container.Env[0])
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	service, err := clientset.CoreV1().Services(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Spec.ClusterIP = "10.0.0.1"
+	if _, err := clientset.CoreV1().Services(testNamespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	drifts, err = CheckDrift(clientset, ctx, driftOptions, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := map[string]Drift{}
+	for _, drift := range drifts {
+		paths[drift.Path] = drift
+	}
+	if len(drifts) != 2 {
+		t.Fatalf("expected the image and the extra env var to drift, got %v", drifts)
+	}
+	image, found := paths["spec.template.spec.containers[0].image"]
+	if !found || image.Applied != opts.Image || image.Live != "guobinqiu/hellogo:hotfix" {
+		t.Errorf("expected the image to drift, got %v", drifts)
+	}
+	if _, found := paths["spec.template.spec.containers[0].env[1]"]; !found {
+		t.Errorf("expected the extra env var to drift, got %v", drifts)
+	}
+
+	logs := &logRecorder{}
+	driftOptions.Reapply = true
+	if _, err := CheckDrift(clientset, ctx, driftOptions, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "deployment hellogo re-applied")
+	deployment, err = clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container = &deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != opts.Image || len(container.Env) != 1 {
+		t.Errorf("expected the deployed container to be restored, got %s with env %v", container.Image, container.Env)
+	}
+
+	driftOptions.Reapply = false
+	drifts, err = CheckDrift(clientset, ctx, driftOptions, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("expected no drift after re-applying, got %v", drifts)
+	}
+}
+
+func TestCheckDriftIgnoresReplicasManagedByHPA(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	opts := newTestDeploymentOptions()
+	if err := CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas := int32(5)
+	deployment.Spec.Replicas = &replicas
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	driftOptions := DriftOptions{Name: "hellogo", Namespace: testNamespace}
+	drifts, err := CheckDrift(clientset, ctx, driftOptions, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || drifts[0].Path != "spec.replicas" {
+		t.Fatalf("expected the replicas to drift without an hpa, got %v", drifts)
+	}
+
+	hpaOptions := HPAOptions{Name: "hellogo", Namespace: testNamespace, MinReplicas: 1, MaxReplicas: 10, CPURate: 50}
+	if err := CreateOrUpdateHPA(clientset, ctx, hpaOptions, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	drifts, err = CheckDrift(clientset, ctx, driftOptions, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("expected replicas managed by the hpa not to drift, got %v", drifts)
+	}
+}
+
+func TestDriftString(t *testing.T) {
+	drift := Drift{Kind: "deployment", Name: "hellogo", Path: "spec.replicas", Applied: float64(2)}
+	if drift.String() != "deployment hellogo: spec.replicas applied 2, live <none>" {
+		t.Errorf("unexpected drift %s", drift)
+	}
+}
@@ -0,0 +1,29 @@
+package kube
+
+import (
+	"context"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// createOrUpdateUnstructured 创建自定义资源，已存在时带上 resourceVersion 整体更新，返回是否为新建
+func createOrUpdateUnstructured(dynamicClient dynamic.Interface, ctx context.Context, gvr schema.GroupVersionResource, object *unstructured.Unstructured) (bool, error) {
+	resources := dynamicClient.Resource(gvr).Namespace(object.GetNamespace())
+
+	existing, err := resources.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err := resources.Create(ctx, object, metav1.CreateOptions{})
+		return true, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	object.SetResourceVersion(existing.GetResourceVersion())
+	_, err = resources.Update(ctx, object, metav1.UpdateOptions{})
+	return false, err
+}
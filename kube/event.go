@@ -0,0 +1,252 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// eventDedupWindow 内相同对象的相同事件只输出一次
+	eventDedupWindow = 5 * time.Minute
+	// 每个 eventRateInterval 内最多输出 eventRateBurst 条事件，其余的汇总为一条
+	eventRateInterval = 10 * time.Second
+	eventRateBurst    = 5
+)
+
+// WatchEvents 在后台监听命名空间内属于应用的 Warning 事件（如 FailedScheduling、FailedMount、Unhealthy、BackOff），
+// 去重并限速后通过 logHandler 输出。返回的函数用于停止监听，会等待监听结束
+func WatchEvents(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	filter := newEventFilter(name, namespace, logHandler)
+	filter.lookup = func(kind, name string) (metav1.Object, error) {
+		return getEventObject(clientset, ctx, kind, name, namespace)
+	}
+
+	go func() {
+		defer close(done)
+		watchEvents(clientset, ctx, namespace, filter)
+		filter.flush()
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func watchEvents(clientset kubernetes.Interface, ctx context.Context, namespace string, filter *eventFilter) {
+	selector := fields.OneTermEqualSelector("type", corev1.EventTypeWarning).String()
+
+	// 从当前版本开始监听，忽略发布前就已存在的事件
+	resourceVersion := ""
+	for {
+		if resourceVersion == "" {
+			events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+				FieldSelector: selector,
+				Limit:         1,
+			})
+			if err != nil {
+				if ctx.Err() == nil {
+					filter.logHandler(fmt.Sprintf("failed to list events, events are not shown: %v", err))
+				}
+				return
+			}
+			resourceVersion = events.ResourceVersion
+		}
+
+		watcher, err := clientset.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{
+			FieldSelector:   selector,
+			ResourceVersion: resourceVersion,
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				filter.logHandler(fmt.Sprintf("failed to watch events, events are not shown: %v", err))
+			}
+			return
+		}
+
+		resourceVersion = receiveEvents(ctx, watcher, resourceVersion, filter)
+		watcher.Stop()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// receiveEvents 处理监听到的事件直到监听中断，返回重新监听的起始版本，版本过期时返回空字符串
+func receiveEvents(ctx context.Context, watcher watch.Interface, resourceVersion string, filter *eventFilter) string {
+	for {
+		select {
+		case <-ctx.Done():
+			return resourceVersion
+		case result, ok := <-watcher.ResultChan():
+			if !ok {
+				return resourceVersion
+			}
+			switch result.Type {
+			case watch.Added, watch.Modified:
+				if event, ok := result.Object.(*corev1.Event); ok {
+					resourceVersion = event.ResourceVersion
+					filter.handle(event)
+				}
+			case watch.Error:
+				if status, ok := result.Object.(*metav1.Status); ok && status.Code == http.StatusGone {
+					return ""
+				}
+				return resourceVersion
+			}
+		}
+	}
+}
+
+// eventFilter 筛选属于应用的 Warning 事件并去重、限速
+type eventFilter struct {
+	app        string
+	namespace  string
+	logHandler func(msg string)
+	now        func() time.Time
+	// lookup 读取事件涉及的对象，对象不存在时返回 nil
+	lookup      func(kind, name string) (metav1.Object, error)
+	owners      map[string]bool
+	seen        map[string]time.Time
+	windowStart time.Time
+	sent        int
+	suppressed  int
+}
+
+func newEventFilter(app, namespace string, logHandler func(msg string)) *eventFilter {
+	return &eventFilter{
+		app:        app,
+		namespace:  namespace,
+		logHandler: logHandler,
+		now:        time.Now,
+		seen:       make(map[string]time.Time),
+		owners:     make(map[string]bool),
+	}
+}
+
+func (filter *eventFilter) handle(event *corev1.Event) {
+	if event.Type != corev1.EventTypeWarning || !filter.belongsToApp(event.InvolvedObject.Kind, event.InvolvedObject.Name) {
+		return
+	}
+
+	now := filter.now()
+	key := strings.Join([]string{event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Reason, event.Message}, "/")
+	if last, ok := filter.seen[key]; ok && now.Sub(last) < eventDedupWindow {
+		return
+	}
+	filter.seen[key] = now
+
+	if now.Sub(filter.windowStart) >= eventRateInterval {
+		filter.flush()
+		filter.windowStart = now
+		filter.sent = 0
+	}
+	if filter.sent >= eventRateBurst {
+		filter.suppressed++
+		return
+	}
+	filter.sent++
+
+	msg := fmt.Sprintf("warning event: %s/%s %s: %s", event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Reason, event.Message)
+	if event.Count > 1 {
+		msg += fmt.Sprintf(" (x%d)", event.Count)
+	}
+	filter.logHandler(msg)
+}
+
+// flush 输出因限速被略过的事件数量
+func (filter *eventFilter) flush() {
+	if filter.suppressed > 0 {
+		filter.logHandler(fmt.Sprintf("warning event: %d more events suppressed, see kubectl get events -n %s --field-selector type=Warning", filter.suppressed, filter.namespace))
+		filter.suppressed = 0
+	}
+}
+
+// belongsToApp 判断对象是否属于应用：对象带有应用的标签，或沿 ownerReferences 向上（如 Pod、ReplicaSet 到 Deployment）
+// 找到带有应用标签的对象。名称前缀不可靠，web-admin 的 Pod 同样以 web- 开头
+func (filter *eventFilter) belongsToApp(kind, name string) bool {
+	key := kind + "/" + name
+	if owned, ok := filter.owners[key]; ok {
+		return owned
+	}
+	owned := filter.ownedByApp(kind, name, maxOwnerDepth)
+	filter.owners[key] = owned
+	return owned
+}
+
+// maxOwnerDepth 为沿 ownerReferences 查找的最大层数
+const maxOwnerDepth = 3
+
+func (filter *eventFilter) ownedByApp(kind, name string, depth int) bool {
+	if filter.lookup == nil {
+		return false
+	}
+	object, err := filter.lookup(kind, name)
+	if err != nil || object == nil {
+		return false
+	}
+	if object.GetLabels()[AppLabel] == filter.app {
+		return true
+	}
+	if depth == 0 {
+		return false
+	}
+	for _, owner := range object.GetOwnerReferences() {
+		if filter.ownedByApp(owner.Kind, owner.Name, depth-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// getEventObject 读取事件涉及的对象，不支持的类型以及不存在的对象返回 nil
+func getEventObject(clientset kubernetes.Interface, ctx context.Context, kind, name, namespace string) (metav1.Object, error) {
+	var object metav1.Object
+	var err error
+	switch kind {
+	case "Pod":
+		object, err = clientset.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "ReplicaSet":
+		object, err = clientset.AppsV1().ReplicaSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Deployment":
+		object, err = clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "StatefulSet":
+		object, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "DaemonSet":
+		object, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Job":
+		object, err = clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "PersistentVolumeClaim":
+		object, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Service":
+		object, err = clientset.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "Ingress":
+		object, err = clientset.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "HorizontalPodAutoscaler":
+		object, err = clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(ctx, name, metav1.GetOptions{})
+	default:
+		return nil, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
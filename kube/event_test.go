@@ -0,0 +1,165 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestEvent(kind, name, eventType, reason, message string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%d", name, time.Now().UnixNano()),
+			Namespace: testNamespace,
+		},
+		InvolvedObject: corev1.ObjectReference{Kind: kind, Name: name, Namespace: testNamespace},
+		Type:           eventType,
+		Reason:         reason,
+		Message:        message,
+		Count:          1,
+	}
+}
+
+// newTestEventClient 返回包含应用 hellogo 与 hellogo-admin 各自 Deployment、ReplicaSet 与 Pod 的 fake 客户端
+func newTestEventClient() *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	ctx := context.Background()
+	for _, app := range []string{"hellogo", "hellogo-admin"} {
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: app, Namespace: testNamespace, Labels: ownerLabels(app)}}
+		replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+			Name:            app + "-5d8f7c",
+			Namespace:       testNamespace,
+			OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: app}},
+		}}
+		clientset.AppsV1().Deployments(testNamespace).Create(ctx, deployment, metav1.CreateOptions{})
+		clientset.AppsV1().ReplicaSets(testNamespace).Create(ctx, replicaSet, metav1.CreateOptions{})
+		for _, suffix := range []string{"abcde", "0", "1", "2", "3", "4", "5", "6", "7"} {
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+				Name:            replicaSet.Name + "-" + suffix,
+				Namespace:       testNamespace,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: replicaSet.Name}},
+			}}
+			clientset.CoreV1().Pods(testNamespace).Create(ctx, pod, metav1.CreateOptions{})
+		}
+	}
+	return clientset
+}
+
+func TestEventFilter(t *testing.T) {
+	ctx := context.Background()
+	clientset := newTestEventClient()
+	logs := &logRecorder{}
+	now := time.Unix(1700000000, 0)
+	filter := newEventFilter("hellogo", testNamespace, logs.handle)
+	filter.now = func() time.Time { return now }
+	filter.lookup = func(kind, name string) (metav1.Object, error) {
+		return getEventObject(clientset, ctx, kind, name, testNamespace)
+	}
+
+	filter.handle(newTestEvent("Pod", "hellogo-5d8f7c-abcde", corev1.EventTypeWarning, "FailedScheduling", "0/3 nodes are available"))
+	filter.handle(newTestEvent("Pod", "hellogo-5d8f7c-abcde", corev1.EventTypeWarning, "FailedScheduling", "0/3 nodes are available"))
+	filter.handle(newTestEvent("Pod", "hellogo-5d8f7c-abcde", corev1.EventTypeNormal, "Scheduled", "assigned to node-1"))
+	filter.handle(newTestEvent("Pod", "hellonode-7b9c-xyz", corev1.EventTypeWarning, "BackOff", "back-off restarting"))
+	filter.handle(newTestEvent("Pod", "hellogo-admin-5d8f7c-abcde", corev1.EventTypeWarning, "BackOff", "back-off restarting"))
+	filter.handle(newTestEvent("Deployment", "hellogo-admin", corev1.EventTypeWarning, "FailedCreate", "quota exceeded"))
+	if len(logs.msgs) != 1 {
+		t.Fatalf("expected only the first warning of the app, got %q", logs.msgs)
+	}
+	logs.assertContains(t, "Pod/hellogo-5d8f7c-abcde FailedScheduling: 0/3 nodes are available")
+
+	filter.handle(newTestEvent("Deployment", "hellogo", corev1.EventTypeWarning, "FailedCreate", "quota exceeded"))
+	if len(logs.msgs) != 2 {
+		t.Fatalf("expected the warning of the app deployment, got %q", logs.msgs)
+	}
+
+	// 去重窗口过后再次输出
+	now = now.Add(eventDedupWindow)
+	filter.handle(newTestEvent("Pod", "hellogo-5d8f7c-abcde", corev1.EventTypeWarning, "FailedScheduling", "0/3 nodes are available"))
+	if len(logs.msgs) != 3 {
+		t.Fatalf("expected the warning to be shown again after the dedup window, got %q", logs.msgs)
+	}
+
+	// 超出限速的事件被汇总
+	now = now.Add(eventRateInterval)
+	for i := 0; i < eventRateBurst+3; i++ {
+		filter.handle(newTestEvent("Pod", fmt.Sprintf("hellogo-5d8f7c-%d", i), corev1.EventTypeWarning, "Unhealthy", "readiness probe failed"))
+	}
+	if len(logs.msgs) != 3+eventRateBurst {
+		t.Fatalf("expected %d events shown, got %q", eventRateBurst, logs.msgs[3:])
+	}
+	filter.flush()
+	logs.assertContains(t, "3 more events suppressed")
+}
+
+// syncRecorder 为并发安全的 logRecorder
+type syncRecorder struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (r *syncRecorder) handle(msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+}
+
+func (r *syncRecorder) waitFor(t *testing.T, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		for _, msg := range r.msgs {
+			if strings.Contains(msg, substr) {
+				r.mu.Unlock()
+				return
+			}
+		}
+		r.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected a log containing %q, got %q", substr, r.msgs)
+}
+
+func TestWatchEvents(t *testing.T) {
+	ctx := context.Background()
+	clientset := newTestEventClient()
+	logs := &syncRecorder{}
+
+	stop := WatchEvents(clientset, ctx, "hellogo", testNamespace, logs.handle)
+
+	// 监听建立前后创建的事件都可能被收到，持续创建直到被输出
+	done := make(chan struct{})
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+			event := newTestEvent("Pod", "hellogo-5d8f7c-abcde", corev1.EventTypeWarning, "FailedMount", "pvc hellogo not found")
+			event.Name = fmt.Sprintf("hellogo.%d", i)
+			clientset.CoreV1().Events(testNamespace).Create(ctx, event, metav1.CreateOptions{})
+		}
+	}()
+	logs.waitFor(t, "Pod/hellogo-5d8f7c-abcde FailedMount: pvc hellogo not found")
+	close(done)
+
+	stopped := make(chan struct{})
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the watch to stop")
+	}
+}
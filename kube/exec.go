@@ -0,0 +1,106 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// ExecOptions 用于在应用的一个就绪 Pod 中执行命令
+type ExecOptions struct {
+	Name      string
+	Namespace string
+	// Container 为执行命令的容器，为空时使用应用容器
+	Container string
+	// Command 为执行的命令，为空时启动 sh
+	Command []string
+	// TTY 为 true 时分配终端，Stdin 为终端的输入
+	TTY bool
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+	// TerminalSizeQueue 为终端尺寸变化的来源，仅在 TTY 时使用
+	TerminalSizeQueue remotecommand.TerminalSizeQueue
+}
+
+// Exec 通过 pods/exec 接口在应用的一个就绪 Pod 中执行命令，优先使用 websocket，apiserver 不支持时回退到 SPDY
+func Exec(config *rest.Config, clientset kubernetes.Interface, ctx context.Context, opts ExecOptions, logHandler func(msg string)) error {
+	pod, err := SelectReadyPod(clientset, ctx, map[string]string{"name": opts.Name}, opts.Namespace)
+	if err != nil {
+		return err
+	}
+
+	container := opts.Container
+	if container == "" {
+		container = appContainer(pod, opts.Name)
+	}
+	command := opts.Command
+	if len(command) == 0 {
+		command = []string{"sh"}
+	}
+	logHandler(fmt.Sprintf("executing %v in container %s of pod %s", command, container, pod.Name))
+
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(opts.Namespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			// 终端模式下 stderr 合并到 stdout
+			Stderr: opts.Stderr != nil && !opts.TTY,
+			TTY:    opts.TTY,
+		}, scheme.ParameterCodec)
+
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(config, "GET", req.URL().String())
+	if err != nil {
+		return fmt.Errorf("failed to create websocket executor: %v", err)
+	}
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create spdy executor: %v", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, httpstream.IsUpgradeFailure)
+	if err != nil {
+		return err
+	}
+
+	streamOptions := remotecommand.StreamOptions{
+		Stdin:  opts.Stdin,
+		Stdout: opts.Stdout,
+		Stderr: opts.Stderr,
+		Tty:    opts.TTY,
+	}
+	if opts.TTY {
+		streamOptions.Stderr = nil
+		streamOptions.TerminalSizeQueue = opts.TerminalSizeQueue
+	}
+	if err := executor.StreamWithContext(ctx, streamOptions); err != nil {
+		return fmt.Errorf("failed to execute in pod %s: %v", pod.Name, err)
+	}
+	return nil
+}
+
+// appContainer 返回与应用同名的容器，不存在时返回第一个容器
+func appContainer(pod *corev1.Pod, name string) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name == name {
+			return name
+		}
+	}
+	if len(pod.Spec.Containers) > 0 {
+		return pod.Spec.Containers[0].Name
+	}
+	return name
+}
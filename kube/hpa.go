@@ -13,22 +13,29 @@ import (
 type HPAOptions struct {
 	Name        string
 	Namespace   string
+	Kind        string
 	Enabled     bool  `form:"enabled" json:"enabled"`
 	MinReplicas int32 `form:"minreplicas" json:"minreplicas"`
 	MaxReplicas int32 `form:"maxreplicas" json:"maxreplicas"`
 	CPURate     int32 `form:"cpurate" json:"cpurate"`
 }
 
-func CreateOrUpdateHPA(clientset *kubernetes.Clientset, ctx context.Context, opts HPAOptions, logHandler func(msg string)) error {
+func CreateOrUpdateHPA(clientset kubernetes.Interface, ctx context.Context, opts HPAOptions, logHandler func(msg string)) error {
+	kind := opts.Kind
+	if kind == "" {
+		kind = "Deployment"
+	}
+
 	hpa := &autoscalingv2.HorizontalPodAutoscaler{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
 		},
 		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
 			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
-				APIVersion: "app/v1",
-				Kind:       "Deployment",
+				APIVersion: "apps/v1",
+				Kind:       kind,
 				Name:       opts.Name,
 			},
 			MinReplicas: &opts.MinReplicas,
@@ -47,11 +54,17 @@ func CreateOrUpdateHPA(clientset *kubernetes.Clientset, ctx context.Context, opt
 			},
 		},
 	}
+	if err := setLastApplied(&hpa.ObjectMeta, hpa.Spec); err != nil {
+		return err
+	}
 
 	if _, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(opts.Namespace).Create(ctx, hpa, metav1.CreateOptions{}); err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create hpa resource: %v", err)
 		}
+		if _, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(opts.Namespace).Update(ctx, hpa, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update hpa resource: %v", err)
+		}
 		logHandler("hpa resource successfully updated")
 	} else {
 		logHandler("hpa resource successfully created")
@@ -60,7 +73,7 @@ func CreateOrUpdateHPA(clientset *kubernetes.Clientset, ctx context.Context, opt
 	return nil
 }
 
-func DeleteHPA(clientset *kubernetes.Clientset, ctx context.Context, opts HPAOptions, logHandler func(msg string)) error {
+func DeleteHPA(clientset kubernetes.Interface, ctx context.Context, opts HPAOptions, logHandler func(msg string)) error {
 	err := clientset.AutoscalingV2().HorizontalPodAutoscalers(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete hpa resource: %v", err)
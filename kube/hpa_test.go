@@ -0,0 +1,63 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateHPA(t *testing.T) {
+	ctx := context.Background()
+	opts := HPAOptions{Name: "hellogo", Namespace: testNamespace, MinReplicas: 1, MaxReplicas: 5, CPURate: 75}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateHPA(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	hpa, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hpa.Spec.ScaleTargetRef.Kind != "Deployment" {
+		t.Errorf("expected scale target kind Deployment, got %s", hpa.Spec.ScaleTargetRef.Kind)
+	}
+	logs.assertContains(t, "successfully created")
+
+	opts.MaxReplicas = 10
+	opts.Kind = "StatefulSet"
+	if err := CreateOrUpdateHPA(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	hpa, _ = clientset.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if hpa.Spec.MaxReplicas != 10 || hpa.Spec.ScaleTargetRef.Kind != "StatefulSet" {
+		t.Errorf("expected hpa to be updated, got %+v", hpa.Spec)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	failOn(clientset, "update", "horizontalpodautoscalers")
+	assertErrorContains(t, CreateOrUpdateHPA(clientset, ctx, opts, func(string) {}), "failed to update hpa resource")
+}
+
+func TestDeleteHPA(t *testing.T) {
+	ctx := context.Background()
+	opts := HPAOptions{Name: "hellogo", Namespace: testNamespace}
+
+	clientset := fake.NewSimpleClientset(&autoscalingv2.HorizontalPodAutoscaler{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteHPA(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteHPA(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+
+	failOn(clientset, "delete", "horizontalpodautoscalers")
+	assertErrorContains(t, DeleteHPA(clientset, ctx, opts, func(string) {}), "failed to delete hpa resource")
+}
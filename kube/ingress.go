@@ -17,11 +17,16 @@ import (
 	"github.com/guobinqiu/appdeployer/helpers"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
+// IngressClassName 为 nginx 控制器使用的 IngressClass，需要集群中安装 ingress-nginx
+const IngressClassName = "nginx"
+
 type IngressOptions struct {
 	Name            string `form:"name" json:"name"`
 	Namespace       string
@@ -31,21 +36,48 @@ type IngressOptions struct {
 	SelfSignedYears int    `form:"selfsignedyears" json:"selfsignedyears"`
 	CrtPath         string `form:"crtpath" json:"crtpath"`
 	KeyPath         string `form:"keypath" json:"keypath"`
+
+	// Enabled 为 false 时不创建 Ingress，应用不对集群外暴露
+	Enabled bool `form:"enabled" json:"enabled"`
+
+	// Controller 为 Ingress 控制器，nginx 或 traefik，决定 IngressClass 以及访问控制的实现方式
+	Controller string `form:"controller" json:"controller"`
+	// AuthUsers 为 basic auth 的用户，形如 user:password，为空时不启用 basic auth
+	AuthUsers []string `form:"authusers" json:"authusers"`
+	AuthRealm string   `form:"authrealm" json:"authrealm"`
+	// AllowSourceRanges 为允许访问的 CIDR，为空时不限制
+	AllowSourceRanges []string `form:"allowsourceranges" json:"allowsourceranges"`
+	// RateLimit 为每个客户端 IP 每秒允许的请求数，为 0 时不限制
+	RateLimit int32 `form:"ratelimit" json:"ratelimit"`
+	// RateLimitBurst 为允许超出 RateLimit 的突发请求数，为 0 时使用控制器的默认值
+	RateLimitBurst int32 `form:"ratelimitburst" json:"ratelimitburst"`
+	// MaxBodySize 为请求体大小的上限，如 10Mi，为空时使用控制器的默认值
+	MaxBodySize string `form:"maxbodysize" json:"maxbodysize"`
+	// CORSAllowOrigins 为允许跨域访问的来源，为空时不启用 CORS
+	CORSAllowOrigins     []string `form:"corsalloworigins" json:"corsalloworigins"`
+	CORSAllowMethods     []string `form:"corsallowmethods" json:"corsallowmethods"`
+	CORSAllowHeaders     []string `form:"corsallowheaders" json:"corsallowheaders"`
+	CORSAllowCredentials bool     `form:"corsallowcredentials" json:"corsallowcredentials"`
+	// CORSMaxAge 为预检请求结果的缓存秒数，为 0 时使用控制器的默认值
+	CORSMaxAge int32 `form:"corsmaxage" json:"corsmaxage"`
 }
 
-func CreateOrUpdateIngress(clientset *kubernetes.Clientset, ctx context.Context, opts IngressOptions, logHandler func(msg string)) error {
-	ingressClass := "nginx"
+// CreateOrUpdateIngress 创建或更新 Ingress，访问控制按 Ingress 控制器转换为 nginx 的注解或 Traefik 的 Middleware
+func CreateOrUpdateIngress(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts IngressOptions, logHandler func(msg string)) error {
+	annotations, err := ingressAnnotations(opts)
+	if err != nil {
+		return err
+	}
+
+	ingressClass := IngressClass(opts.Controller)
 	pathType := networkingv1.PathTypePrefix
 
 	ingress := &networkingv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      opts.Name,
-			Namespace: opts.Namespace,
-			Annotations: map[string]string{
-				"nginx.ingress.kubernetes.io/force-ssl-redirect": "true",
-				"nginx.ingress.kubernetes.io/ssl-passthrough":    "false",
-				"nginx.ingress.kubernetes.io/backend-protocol":   "HTTP",
-			},
+			Name:        opts.Name,
+			Namespace:   opts.Namespace,
+			Labels:      ownerLabels(opts.Name),
+			Annotations: annotations,
 		},
 		Spec: networkingv1.IngressSpec{
 			IngressClassName: &ingressClass,
@@ -76,7 +108,7 @@ func CreateOrUpdateIngress(clientset *kubernetes.Clientset, ctx context.Context,
 	}
 
 	if opts.TLS {
-		if err := CreateOrUpdateTlsSecret(clientset, ctx, opts); err != nil {
+		if err := CreateOrUpdateTlsSecret(clientset, ctx, opts, logHandler); err != nil {
 			return err
 		}
 
@@ -85,15 +117,31 @@ func CreateOrUpdateIngress(clientset *kubernetes.Clientset, ctx context.Context,
 				Hosts: []string{
 					opts.Host,
 				},
-				SecretName: "tls-" + opts.Name,
+				SecretName: TLSSecretName(opts.Name),
 			},
 		}
 	}
 
+	if err := syncBasicAuthSecret(clientset, ctx, opts, logHandler); err != nil {
+		return err
+	}
+	if opts.Controller == IngressControllerTraefik {
+		if err := syncTraefikMiddlewares(dynamicClient, ctx, opts, logHandler); err != nil {
+			return err
+		}
+	}
+
+	if err := setLastApplied(&ingress.ObjectMeta, ingress.Spec); err != nil {
+		return err
+	}
+
 	if _, err := clientset.NetworkingV1().Ingresses(opts.Namespace).Create(ctx, ingress, metav1.CreateOptions{}); err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create ingress resource: %v", err)
 		}
+		if _, err := clientset.NetworkingV1().Ingresses(opts.Namespace).Update(ctx, ingress, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update ingress resource: %v", err)
+		}
 		logHandler("ingress resource successfully updated")
 	} else {
 		logHandler("ingress resource successfully created")
@@ -102,7 +150,12 @@ func CreateOrUpdateIngress(clientset *kubernetes.Clientset, ctx context.Context,
 	return nil
 }
 
-func CreateOrUpdateTlsSecret(clientset *kubernetes.Clientset, ctx context.Context, opts IngressOptions) error {
+// TLSSecretName 返回保存 Ingress 证书的 Secret 名称
+func TLSSecretName(name string) string {
+	return "tls-" + name
+}
+
+func CreateOrUpdateTlsSecret(clientset kubernetes.Interface, ctx context.Context, opts IngressOptions, logHandler func(msg string)) error {
 	var tlsKeyBytes, tlsCertBytes []byte
 
 	if opts.SelfSigned {
@@ -140,7 +193,9 @@ func CreateOrUpdateTlsSecret(clientset *kubernetes.Clientset, ctx context.Contex
 
 	tlsSecret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "tls-" + opts.Name,
+			Name:      TLSSecretName(opts.Name),
+			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
 		},
 		Type: corev1.SecretTypeTLS,
 		Data: map[string][]byte{
@@ -153,9 +208,34 @@ func CreateOrUpdateTlsSecret(clientset *kubernetes.Clientset, ctx context.Contex
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create tls secret resource: %v", err)
 		}
-		fmt.Println("tls secret resource successfully updated")
+
+		// 写入新的证书，并为之前版本创建或接管的 Secret 加上属于应用的标签
+		live, err := clientset.CoreV1().Secrets(opts.Namespace).Get(ctx, tlsSecret.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get tls secret resource: %v", err)
+		}
+		labeled := setOwnerLabels(&live.ObjectMeta, opts.Name)
+		if !labeled && live.Type == tlsSecret.Type && equality.Semantic.DeepEqual(live.Data, tlsSecret.Data) {
+			logHandler("tls secret resource unchanged")
+			return nil
+		}
+		if live.Type != tlsSecret.Type {
+			// Secret 的类型不可变，只能重建
+			if err := clientset.CoreV1().Secrets(opts.Namespace).Delete(ctx, tlsSecret.Name, metav1.DeleteOptions{}); err != nil {
+				return fmt.Errorf("failed to delete tls secret resource: %v", err)
+			}
+			if _, err := clientset.CoreV1().Secrets(opts.Namespace).Create(ctx, tlsSecret, metav1.CreateOptions{}); err != nil {
+				return fmt.Errorf("failed to create tls secret resource: %v", err)
+			}
+		} else {
+			live.Data = tlsSecret.Data
+			if _, err := clientset.CoreV1().Secrets(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("failed to update tls secret resource: %v", err)
+			}
+		}
+		logHandler("tls secret resource successfully updated")
 	} else {
-		fmt.Println("tls secret resource successfully created")
+		logHandler("tls secret resource successfully created")
 	}
 
 	return nil
@@ -0,0 +1,405 @@
+package kube
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	IngressControllerNginx   = "nginx"
+	IngressControllerTraefik = "traefik"
+)
+
+const defaultAuthRealm = "Authentication Required"
+
+var middlewareGVR = schema.GroupVersionResource{
+	Group:    "traefik.io",
+	Version:  "v1alpha1",
+	Resource: "middlewares",
+}
+
+// traefikMiddlewareSuffixes 为 Traefik 各访问控制 Middleware 名称的后缀，按生效顺序排列
+var traefikMiddlewareSuffixes = []string{"allowlist", "cors", "ratelimit", "auth", "bodysize"}
+
+// IngressClass 返回 Ingress 控制器对应的 IngressClass
+func IngressClass(controller string) string {
+	if controller == IngressControllerTraefik {
+		return "traefik"
+	}
+	return IngressClassName
+}
+
+// BasicAuthSecretName 返回保存 basic auth 用户的 Secret 名称
+func BasicAuthSecretName(name string) string {
+	return "basic-auth-" + name
+}
+
+// TraefikMiddlewareNames 返回启用的访问控制对应的 Traefik Middleware 名称
+func TraefikMiddlewareNames(opts IngressOptions) []string {
+	var names []string
+	for _, suffix := range traefikMiddlewareSuffixes {
+		if protectionEnabled(opts, suffix) {
+			names = append(names, opts.Name+"-"+suffix)
+		}
+	}
+	return names
+}
+
+func protectionEnabled(opts IngressOptions, protection string) bool {
+	switch protection {
+	case "allowlist":
+		return len(opts.AllowSourceRanges) > 0
+	case "cors":
+		return len(opts.CORSAllowOrigins) > 0
+	case "ratelimit":
+		return opts.RateLimit > 0
+	case "auth":
+		return len(opts.AuthUsers) > 0
+	case "bodysize":
+		return !helpers.IsBlank(opts.MaxBodySize)
+	}
+	return false
+}
+
+// ValidateIngressProtection 检查 Ingress 的访问控制选项
+func ValidateIngressProtection(opts IngressOptions) error {
+	if !helpers.Contains([]string{"", IngressControllerNginx, IngressControllerTraefik}, opts.Controller) {
+		return fmt.Errorf("unsupported ingress controller: %s", opts.Controller)
+	}
+	for _, user := range opts.AuthUsers {
+		name, password, found := strings.Cut(user, ":")
+		if !found || helpers.IsBlank(name) || password == "" {
+			return fmt.Errorf("invalid format for auth user: '%s', expected 'user:password'", name)
+		}
+	}
+	for _, cidr := range opts.AllowSourceRanges {
+		if _, _, err := net.ParseCIDR(strings.TrimSpace(cidr)); err != nil {
+			return fmt.Errorf("invalid source range '%s': %v", cidr, err)
+		}
+	}
+	if opts.RateLimit < 0 || opts.RateLimitBurst < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+	if _, err := parseBodySize(opts.MaxBodySize); err != nil {
+		return err
+	}
+	if opts.CORSMaxAge < 0 {
+		return fmt.Errorf("cors max age must not be negative")
+	}
+	return nil
+}
+
+// parseBodySize 将 10Mi 形式的大小转换为字节数，为空时返回 0
+func parseBodySize(size string) (int64, error) {
+	if helpers.IsBlank(size) {
+		return 0, nil
+	}
+	quantity, err := resource.ParseQuantity(strings.TrimSpace(size))
+	if err != nil || quantity.Sign() <= 0 {
+		return 0, fmt.Errorf("invalid max body size '%s', expected a positive size such as 10Mi", size)
+	}
+	return quantity.Value(), nil
+}
+
+// ingressAnnotations 将访问控制选项转换为 Ingress 控制器的注解
+func ingressAnnotations(opts IngressOptions) (map[string]string, error) {
+	if err := ValidateIngressProtection(opts); err != nil {
+		return nil, err
+	}
+	if opts.Controller == IngressControllerTraefik {
+		return traefikAnnotations(opts), nil
+	}
+	return nginxAnnotations(opts)
+}
+
+func nginxAnnotations(opts IngressOptions) (map[string]string, error) {
+	annotations := map[string]string{
+		"nginx.ingress.kubernetes.io/force-ssl-redirect": "true",
+		"nginx.ingress.kubernetes.io/ssl-passthrough":    "false",
+		"nginx.ingress.kubernetes.io/backend-protocol":   "HTTP",
+	}
+
+	if len(opts.AuthUsers) > 0 {
+		annotations["nginx.ingress.kubernetes.io/auth-type"] = "basic"
+		annotations["nginx.ingress.kubernetes.io/auth-secret"] = BasicAuthSecretName(opts.Name)
+		annotations["nginx.ingress.kubernetes.io/auth-realm"] = authRealm(opts)
+	}
+	if len(opts.AllowSourceRanges) > 0 {
+		annotations["nginx.ingress.kubernetes.io/whitelist-source-range"] = joinTrimmed(opts.AllowSourceRanges, ",")
+	}
+	if opts.RateLimit > 0 {
+		annotations["nginx.ingress.kubernetes.io/limit-rps"] = strconv.Itoa(int(opts.RateLimit))
+		// ingress-nginx 的突发请求数为每秒请求数的倍数
+		if opts.RateLimitBurst > 0 {
+			multiplier := (opts.RateLimitBurst + opts.RateLimit - 1) / opts.RateLimit
+			annotations["nginx.ingress.kubernetes.io/limit-burst-multiplier"] = strconv.Itoa(int(multiplier))
+		}
+	}
+	if !helpers.IsBlank(opts.MaxBodySize) {
+		size, err := parseBodySize(opts.MaxBodySize)
+		if err != nil {
+			return nil, err
+		}
+		annotations["nginx.ingress.kubernetes.io/proxy-body-size"] = strconv.FormatInt(size, 10)
+	}
+	if len(opts.CORSAllowOrigins) > 0 {
+		annotations["nginx.ingress.kubernetes.io/enable-cors"] = "true"
+		annotations["nginx.ingress.kubernetes.io/cors-allow-origin"] = joinTrimmed(opts.CORSAllowOrigins, ", ")
+		if len(opts.CORSAllowMethods) > 0 {
+			annotations["nginx.ingress.kubernetes.io/cors-allow-methods"] = joinTrimmed(opts.CORSAllowMethods, ", ")
+		}
+		if len(opts.CORSAllowHeaders) > 0 {
+			annotations["nginx.ingress.kubernetes.io/cors-allow-headers"] = joinTrimmed(opts.CORSAllowHeaders, ", ")
+		}
+		annotations["nginx.ingress.kubernetes.io/cors-allow-credentials"] = strconv.FormatBool(opts.CORSAllowCredentials)
+		if opts.CORSMaxAge > 0 {
+			annotations["nginx.ingress.kubernetes.io/cors-max-age"] = strconv.Itoa(int(opts.CORSMaxAge))
+		}
+	}
+	return annotations, nil
+}
+
+// traefikAnnotations 引用访问控制对应的 Middleware，Traefik 按引用的顺序依次执行
+func traefikAnnotations(opts IngressOptions) map[string]string {
+	annotations := map[string]string{}
+	var refs []string
+	for _, name := range TraefikMiddlewareNames(opts) {
+		refs = append(refs, fmt.Sprintf("%s-%s@kubernetescrd", opts.Namespace, name))
+	}
+	if len(refs) > 0 {
+		annotations["traefik.ingress.kubernetes.io/router.middlewares"] = strings.Join(refs, ",")
+	}
+	return annotations
+}
+
+// newTraefikMiddleware 构造一项访问控制对应的 Middleware
+func newTraefikMiddleware(opts IngressOptions, protection string) (*unstructured.Unstructured, error) {
+	var spec map[string]interface{}
+	switch protection {
+	case "allowlist":
+		spec = map[string]interface{}{
+			"ipAllowList": map[string]interface{}{
+				"sourceRange": toInterfaces(opts.AllowSourceRanges),
+			},
+		}
+	case "cors":
+		headers := map[string]interface{}{
+			"accessControlAllowOriginList":  toInterfaces(opts.CORSAllowOrigins),
+			"accessControlAllowCredentials": opts.CORSAllowCredentials,
+			"addVaryHeader":                 true,
+		}
+		if len(opts.CORSAllowMethods) > 0 {
+			headers["accessControlAllowMethods"] = toInterfaces(opts.CORSAllowMethods)
+		}
+		if len(opts.CORSAllowHeaders) > 0 {
+			headers["accessControlAllowHeaders"] = toInterfaces(opts.CORSAllowHeaders)
+		}
+		if opts.CORSMaxAge > 0 {
+			headers["accessControlMaxAge"] = int64(opts.CORSMaxAge)
+		}
+		spec = map[string]interface{}{"headers": headers}
+	case "ratelimit":
+		rateLimit := map[string]interface{}{
+			"average": int64(opts.RateLimit),
+			"period":  "1s",
+		}
+		if opts.RateLimitBurst > 0 {
+			rateLimit["burst"] = int64(opts.RateLimitBurst)
+		}
+		spec = map[string]interface{}{"rateLimit": rateLimit}
+	case "auth":
+		spec = map[string]interface{}{
+			"basicAuth": map[string]interface{}{
+				"secret": BasicAuthSecretName(opts.Name),
+				"realm":  authRealm(opts),
+			},
+		}
+	case "bodysize":
+		size, err := parseBodySize(opts.MaxBodySize)
+		if err != nil {
+			return nil, err
+		}
+		spec = map[string]interface{}{
+			"buffering": map[string]interface{}{
+				"maxRequestBodyBytes": size,
+			},
+		}
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": middlewareGVR.GroupVersion().String(),
+			"kind":       "Middleware",
+			"metadata": map[string]interface{}{
+				"name":      opts.Name + "-" + protection,
+				"namespace": opts.Namespace,
+				"labels": map[string]interface{}{
+					ManagedByLabel: managedBy,
+					AppLabel:       opts.Name,
+				},
+			},
+			"spec": spec,
+		},
+	}, nil
+}
+
+// syncTraefikMiddlewares 创建或更新启用的访问控制对应的 Middleware，删除不再启用的
+func syncTraefikMiddlewares(dynamicClient dynamic.Interface, ctx context.Context, opts IngressOptions, logHandler func(msg string)) error {
+	for _, protection := range traefikMiddlewareSuffixes {
+		name := opts.Name + "-" + protection
+		if !protectionEnabled(opts, protection) {
+			err := dynamicClient.Resource(middlewareGVR).Namespace(opts.Namespace).Delete(ctx, name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete middleware resource %s: %v", name, err)
+			}
+			if err == nil {
+				logHandler(fmt.Sprintf("middleware resource %s successfully deleted", name))
+			}
+			continue
+		}
+
+		middleware, err := newTraefikMiddleware(opts, protection)
+		if err != nil {
+			return err
+		}
+		created, err := createOrUpdateUnstructured(dynamicClient, ctx, middlewareGVR, middleware)
+		if err != nil {
+			return fmt.Errorf("failed to create or update middleware resource %s: %v", name, err)
+		}
+		if created {
+			logHandler(fmt.Sprintf("middleware resource %s successfully created", name))
+		} else {
+			logHandler(fmt.Sprintf("middleware resource %s successfully updated", name))
+		}
+	}
+	return nil
+}
+
+// syncBasicAuthSecret 生成 htpasswd 格式（bcrypt）的用户 Secret，没有用户时删除
+func syncBasicAuthSecret(clientset kubernetes.Interface, ctx context.Context, opts IngressOptions, logHandler func(msg string)) error {
+	name := BasicAuthSecretName(opts.Name)
+	secrets := clientset.CoreV1().Secrets(opts.Namespace)
+
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get basic auth secret %s: %v", name, err)
+	}
+	found := err == nil
+
+	if len(opts.AuthUsers) == 0 {
+		if !found {
+			return nil
+		}
+		if err := secrets.Delete(ctx, name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete basic auth secret resource: %v", err)
+		}
+		logHandler("basic auth secret resource successfully deleted")
+		return nil
+	}
+
+	var previous []byte
+	if found {
+		previous = existing.Data[basicAuthSecretKey(opts.Controller)]
+	}
+	htpasswd, err := newHtpasswd(opts.AuthUsers, previous)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			basicAuthSecretKey(opts.Controller): htpasswd,
+		},
+	}
+	if !found {
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create basic auth secret resource: %v", err)
+		}
+		logHandler("basic auth secret resource successfully created")
+		return nil
+	}
+	secret.ResourceVersion = existing.ResourceVersion
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update basic auth secret resource: %v", err)
+	}
+	logHandler("basic auth secret resource successfully updated")
+	return nil
+}
+
+// basicAuthSecretKey 返回 Ingress 控制器读取 htpasswd 的键
+func basicAuthSecretKey(controller string) string {
+	if controller == IngressControllerTraefik {
+		return "users"
+	}
+	return "auth"
+}
+
+// newHtpasswd 生成 htpasswd 内容。密码未变的用户沿用之前的哈希，避免每次发布都改变 Secret 而触发控制器重新加载
+func newHtpasswd(users []string, previous []byte) ([]byte, error) {
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(string(previous), "\n") {
+		if name, hash, found := strings.Cut(strings.TrimSpace(line), ":"); found {
+			hashes[name] = hash
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, user := range users {
+		name, password, _ := strings.Cut(user, ":")
+		name = strings.TrimSpace(name)
+		hash := hashes[name]
+		if hash == "" || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash password of user %s: %v", name, err)
+			}
+			hash = string(hashed)
+		}
+		buf.WriteString(name + ":" + hash + "\n")
+	}
+	return buf.Bytes(), nil
+}
+
+func authRealm(opts IngressOptions) string {
+	if helpers.IsBlank(opts.AuthRealm) {
+		return defaultAuthRealm
+	}
+	return opts.AuthRealm
+}
+
+func joinTrimmed(values []string, sep string) string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		trimmed = append(trimmed, strings.TrimSpace(value))
+	}
+	return strings.Join(trimmed, sep)
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, strings.TrimSpace(value))
+	}
+	return result
+}
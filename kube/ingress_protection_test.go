@@ -0,0 +1,178 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestProtectedIngressOptions(controller string) IngressOptions {
+	return IngressOptions{
+		Name:              "hellogo",
+		Namespace:         testNamespace,
+		Host:              "hellogo.com",
+		Controller:        controller,
+		AuthUsers:         []string{"admin:secret"},
+		AllowSourceRanges: []string{"10.0.0.0/8", " 192.168.0.0/16"},
+		RateLimit:         10,
+		RateLimitBurst:    25,
+		MaxBodySize:       "10Mi",
+		CORSAllowOrigins:  []string{"https://app.com"},
+		CORSAllowMethods:  []string{"GET", "POST"},
+		CORSMaxAge:        600,
+	}
+}
+
+func TestNginxIngressProtection(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	opts := newTestProtectedIngressOptions(IngressControllerNginx)
+	if err := CreateOrUpdateIngress(clientset, nil, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	ingress, err := clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"nginx.ingress.kubernetes.io/auth-type":              "basic",
+		"nginx.ingress.kubernetes.io/auth-secret":            "basic-auth-hellogo",
+		"nginx.ingress.kubernetes.io/whitelist-source-range": "10.0.0.0/8,192.168.0.0/16",
+		"nginx.ingress.kubernetes.io/limit-rps":              "10",
+		"nginx.ingress.kubernetes.io/limit-burst-multiplier": "3",
+		"nginx.ingress.kubernetes.io/proxy-body-size":        "10485760",
+		"nginx.ingress.kubernetes.io/enable-cors":            "true",
+		"nginx.ingress.kubernetes.io/cors-allow-methods":     "GET, POST",
+		"nginx.ingress.kubernetes.io/cors-max-age":           "600",
+	}
+	for key, value := range expected {
+		if ingress.Annotations[key] != value {
+			t.Errorf("expected annotation %s=%s, got %q", key, value, ingress.Annotations[key])
+		}
+	}
+	if *ingress.Spec.IngressClassName != "nginx" {
+		t.Errorf("expected ingress class nginx, got %s", *ingress.Spec.IngressClassName)
+	}
+
+	secret, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "basic-auth-hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(secret.Data["auth"]), "admin:$2a$") {
+		t.Errorf("expected a bcrypt htpasswd line for admin, got %q", secret.Data["auth"])
+	}
+
+	// 更新时移除的访问控制同时移除注解与 Secret
+	opts.AuthUsers = nil
+	opts.RateLimit = 0
+	if err := CreateOrUpdateIngress(clientset, nil, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	ingress, err = clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := ingress.Annotations["nginx.ingress.kubernetes.io/auth-type"]; found {
+		t.Errorf("expected basic auth to be removed, got %v", ingress.Annotations)
+	}
+	if _, found := ingress.Annotations["nginx.ingress.kubernetes.io/limit-rps"]; found {
+		t.Errorf("expected rate limit to be removed, got %v", ingress.Annotations)
+	}
+	if _, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "basic-auth-hellogo", metav1.GetOptions{}); err == nil {
+		t.Error("expected the basic auth secret to be deleted")
+	}
+}
+
+func TestTraefikIngressProtection(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		middlewareGVR: "MiddlewareList",
+	})
+	opts := newTestProtectedIngressOptions(IngressControllerTraefik)
+	if err := CreateOrUpdateIngress(clientset, dynamicClient, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	ingress, err := clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "hello-hellogo-allowlist@kubernetescrd,hello-hellogo-cors@kubernetescrd,hello-hellogo-ratelimit@kubernetescrd,hello-hellogo-auth@kubernetescrd,hello-hellogo-bodysize@kubernetescrd"
+	if ingress.Annotations["traefik.ingress.kubernetes.io/router.middlewares"] != expected {
+		t.Errorf("expected middlewares %s, got %v", expected, ingress.Annotations)
+	}
+	if *ingress.Spec.IngressClassName != "traefik" {
+		t.Errorf("expected ingress class traefik, got %s", *ingress.Spec.IngressClassName)
+	}
+
+	rateLimit, err := dynamicClient.Resource(middlewareGVR).Namespace(testNamespace).Get(ctx, "hellogo-ratelimit", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if average, _, _ := unstructured.NestedInt64(rateLimit.Object, "spec", "rateLimit", "average"); average != 10 {
+		t.Errorf("expected an average rate of 10, got %d", average)
+	}
+	secret, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "basic-auth-hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret.Data["users"]) == 0 {
+		t.Errorf("expected the htpasswd under the users key, got %v", secret.Data)
+	}
+
+	// 不再启用的访问控制删除其 Middleware
+	opts.MaxBodySize = ""
+	if err := CreateOrUpdateIngress(clientset, dynamicClient, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dynamicClient.Resource(middlewareGVR).Namespace(testNamespace).Get(ctx, "hellogo-bodysize", metav1.GetOptions{}); err == nil {
+		t.Error("expected the bodysize middleware to be deleted")
+	}
+}
+
+func TestNewHtpasswdKeepsHashes(t *testing.T) {
+	first, err := newHtpasswd([]string{"admin:secret", "dev:dev"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := newHtpasswd([]string{"admin:secret", "dev:changed"}, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	firstLines := strings.Split(string(first), "\n")
+	secondLines := strings.Split(string(second), "\n")
+	if firstLines[0] != secondLines[0] {
+		t.Errorf("expected the hash of an unchanged password to be kept, got %q and %q", firstLines[0], secondLines[0])
+	}
+	if firstLines[1] == secondLines[1] {
+		t.Errorf("expected the hash of a changed password to be regenerated, got %q", secondLines[1])
+	}
+}
+
+func TestValidateIngressProtection(t *testing.T) {
+	for _, opts := range []IngressOptions{
+		{Controller: "haproxy"},
+		{AuthUsers: []string{"admin"}},
+		{AllowSourceRanges: []string{"10.0.0.1"}},
+		{RateLimit: -1},
+		{MaxBodySize: "big"},
+		{CORSMaxAge: -1},
+	} {
+		if err := ValidateIngressProtection(opts); err == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+	if err := ValidateIngressProtection(newTestProtectedIngressOptions(IngressControllerNginx)); err != nil {
+		t.Error(err)
+	}
+}
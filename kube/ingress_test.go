@@ -0,0 +1,76 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateIngress(t *testing.T) {
+	ctx := context.Background()
+	opts := IngressOptions{Name: "hellogo", Namespace: testNamespace, Host: "hellogo.com"}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateIngress(clientset, nil, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	ingress, err := clientset.NetworkingV1().Ingresses(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ingress.Spec.Rules[0].Host != "hellogo.com" || len(ingress.Spec.TLS) != 0 {
+		t.Errorf("unexpected ingress spec %+v", ingress.Spec)
+	}
+	logs.assertContains(t, "successfully created")
+
+	if err := CreateOrUpdateIngress(clientset, nil, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	failOn(clientset, "create", "ingresses")
+	assertErrorContains(t, CreateOrUpdateIngress(clientset, nil, ctx, opts, logs.handle), "failed to create ingress resource")
+}
+
+func TestCreateOrUpdateIngressWithSelfSignedTLS(t *testing.T) {
+	ctx := context.Background()
+	opts := IngressOptions{Name: "hellogo", Namespace: testNamespace, Host: "hellogo.com", TLS: true, SelfSigned: true, SelfSignedYears: 1}
+
+	clientset := fake.NewSimpleClientset(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	if err := CreateOrUpdateIngress(clientset, nil, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "tls-hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Type != corev1.SecretTypeTLS || len(secret.Data[corev1.TLSCertKey]) == 0 {
+		t.Errorf("expected a tls secret with a certificate, got %+v", secret)
+	}
+
+	// 之前版本创建的无标签 Secret 被写入新证书并加上标签
+	clientset = fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls-hellogo", Namespace: testNamespace},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte("old"), corev1.TLSPrivateKeyKey: []byte("old")},
+	})
+	logs := &logRecorder{}
+	if err := CreateOrUpdateIngress(clientset, nil, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "tls secret resource successfully updated")
+	secret, _ = clientset.CoreV1().Secrets(testNamespace).Get(ctx, "tls-hellogo", metav1.GetOptions{})
+	if secret.Labels[AppLabel] != "hellogo" || string(secret.Data[corev1.TLSCertKey]) == "old" {
+		t.Errorf("expected the existing tls secret to be labeled and updated, got %+v", secret)
+	}
+
+	// 证书文件不存在时不创建 Ingress
+	opts.SelfSigned = false
+	opts.CrtPath = "/nonexistent/tls.crt"
+	assertErrorContains(t, CreateOrUpdateIngress(fake.NewSimpleClientset(), nil, ctx, opts, func(string) {}), "failed to read certificate file")
+}
@@ -0,0 +1,177 @@
+package kube
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	HookPreDeploy  = "predeploy"
+	HookPostDeploy = "postdeploy"
+)
+
+// HookOptions 用于配置发布前后运行的 Job
+type HookOptions struct {
+	PreDeploy  Hook `form:"predeploy" json:"predeploy"`
+	PostDeploy Hook `form:"postdeploy" json:"postdeploy"`
+	Rollback   bool `form:"rollback" json:"rollback"`
+}
+
+type Hook struct {
+	Enabled                 bool   `form:"enabled" json:"enabled"`
+	Image                   string `form:"image" json:"image"`
+	Command                 string `form:"command" json:"command"`
+	BackoffLimit            int32  `form:"backofflimit" json:"backofflimit"`
+	ActiveDeadlineSeconds   int64  `form:"activedeadlineseconds" json:"activedeadlineseconds"`
+	TTLSecondsAfterFinished int32  `form:"ttlsecondsafterfinished" json:"ttlsecondsafterfinished"`
+}
+
+type JobOptions struct {
+	Name               string
+	Namespace          string
+	ServiceAccountName string
+	ImagePullSecrets   []string
+	EnvVars            []string
+	Labels             map[string]string
+	Volumes            []corev1.Volume
+	VolumeMounts       []corev1.VolumeMount
+	Hook
+}
+
+// RunHook 以 Job 的形式运行发布钩子，等待其结束并输出日志
+func RunHook(clientset kubernetes.Interface, ctx context.Context, hookType string, hook Hook, opts DeploymentOptions, logHandler func(msg string)) error {
+	if hook.Image == "" {
+		hook.Image = opts.Image
+	}
+	return RunJob(clientset, ctx, JobOptions{
+		Name:               fmt.Sprintf("%s-%s-%d", opts.Name, hookType, time.Now().Unix()),
+		Namespace:          opts.Namespace,
+		ServiceAccountName: opts.ServiceAccountName,
+		ImagePullSecrets:   opts.ImagePullSecrets,
+		EnvVars:            opts.EnvVars,
+		Labels: map[string]string{
+			"app":    opts.Name,
+			"hook":   hookType,
+			AppLabel: opts.Name,
+		},
+		Hook: hook,
+	}, logHandler)
+}
+
+func RunJob(clientset kubernetes.Interface, ctx context.Context, opts JobOptions, logHandler func(msg string)) error {
+	envs, err := newEnvVars(opts.EnvVars)
+	if err != nil {
+		return err
+	}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    opts.Labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &opts.BackoffLimit,
+			TTLSecondsAfterFinished: &opts.TTLSecondsAfterFinished,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: opts.Labels,
+				},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{
+						{
+							Name:         "job",
+							Image:        opts.Image,
+							Command:      []string{"/bin/sh", "-c", opts.Command},
+							Env:          envs,
+							VolumeMounts: opts.VolumeMounts,
+						},
+					},
+					Volumes:            opts.Volumes,
+					ServiceAccountName: opts.ServiceAccountName,
+					ImagePullSecrets:   localObjectReferences(opts.ImagePullSecrets),
+				},
+			},
+		},
+	}
+	if opts.ActiveDeadlineSeconds > 0 {
+		job.Spec.ActiveDeadlineSeconds = &opts.ActiveDeadlineSeconds
+	}
+
+	if _, err := clientset.BatchV1().Jobs(opts.Namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return fmt.Errorf("failed to create job resource: %v", err)
+	}
+	logHandler(fmt.Sprintf("job resource %s successfully created", opts.Name))
+
+	return waitForJob(clientset, ctx, opts.Name, opts.Namespace, logHandler)
+}
+
+// waitForJob 轮询 Job 状态直至成功或失败，期间依次输出每个已启动 Pod 的日志
+func waitForJob(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	streamed := make(map[string]bool)
+	for {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "job-name=" + name,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list pods of job %s: %v", name, err)
+		}
+		sort.Slice(pods.Items, func(i, j int) bool {
+			return pods.Items[i].CreationTimestamp.Before(&pods.Items[j].CreationTimestamp)
+		})
+		for _, pod := range pods.Items {
+			if streamed[pod.Name] || pod.Status.Phase == corev1.PodPending {
+				continue
+			}
+			streamed[pod.Name] = true
+			if err := streamPodLogs(clientset, ctx, pod.Name, namespace, logHandler); err != nil {
+				logHandler(fmt.Sprintf("failed to stream logs of pod %s: %v", pod.Name, err))
+			}
+		}
+
+		job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get job %s: %v", name, err)
+		}
+		if job.Status.Succeeded > 0 {
+			logHandler(fmt.Sprintf("job %s successfully completed", name))
+			return nil
+		}
+		for _, cond := range job.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && cond.Status == corev1.ConditionTrue {
+				return fmt.Errorf("job %s failed: %s", name, cond.Message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for job %s: %v", name, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func streamPodLogs(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(name, &corev1.PodLogOptions{
+		Follow: true,
+	}).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		logHandler(fmt.Sprintf("[%s] %s", name, scanner.Text()))
+	}
+	return scanner.Err()
+}
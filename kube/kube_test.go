@@ -0,0 +1,50 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testNamespace = "hello"
+
+// logRecorder 收集日志，用于断言函数走了哪个分支
+type logRecorder struct {
+	msgs []string
+}
+
+func (r *logRecorder) handle(msg string) {
+	r.msgs = append(r.msgs, msg)
+}
+
+func (r *logRecorder) assertContains(t *testing.T, substr string) {
+	t.Helper()
+	for _, msg := range r.msgs {
+		if strings.Contains(msg, substr) {
+			return
+		}
+	}
+	t.Errorf("expected a log containing %q, got %q", substr, r.msgs)
+}
+
+// failOn 使 fake 客户端对某类资源的某个操作返回服务端错误
+func failOn(clientset *fake.Clientset, verb, resource string) {
+	clientset.PrependReactor(verb, resource, func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewInternalError(fmt.Errorf("%s %s failed", verb, resource))
+	})
+}
+
+func assertErrorContains(t *testing.T, err error, substr string) {
+	t.Helper()
+	if err == nil {
+		t.Fatalf("expected an error containing %q, got nil", substr)
+	}
+	if !strings.Contains(err.Error(), substr) {
+		t.Fatalf("expected an error containing %q, got %v", substr, err)
+	}
+}
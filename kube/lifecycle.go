@@ -0,0 +1,139 @@
+package kube
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const (
+	UpdateStrategyRollingUpdate = "rollingupdate"
+	UpdateStrategyRecreate      = "recreate"
+)
+
+const (
+	LifecycleTypeExec    = "exec"
+	LifecycleTypeHTTPGet = "httpget"
+	LifecycleTypeSleep   = "sleep"
+)
+
+// defaultTerminationGracePeriodSeconds 为未设置宽限期时 Kubernetes 使用的默认值
+const defaultTerminationGracePeriodSeconds = 30
+
+// Lifecycle 为容器的生命周期钩子
+type Lifecycle struct {
+	PreStop   LifecycleHandler `form:"prestop" json:"prestop"`
+	PostStart LifecycleHandler `form:"poststart" json:"poststart"`
+}
+
+// LifecycleHandler 为一个生命周期钩子，Type 为空时不设置
+type LifecycleHandler struct {
+	Type    string `form:"type" json:"type"`
+	Command string `form:"command" json:"command"`
+	Path    string `form:"path" json:"path"`
+	Port    string `form:"port" json:"port"`
+	Scheme  string `form:"scheme" json:"scheme"`
+	Seconds int64  `form:"seconds" json:"seconds"`
+}
+
+// newDeploymentStrategy 构造 Deployment 的更新策略，Recreate 会先停掉所有旧 Pod 再启动新 Pod
+func newDeploymentStrategy(opts DeploymentOptions) (appsv1.DeploymentStrategy, error) {
+	switch strings.ToLower(opts.Strategy) {
+	case "", UpdateStrategyRollingUpdate:
+		maxSurge := intstr.Parse(opts.RollingUpdate.MaxSurge)
+		maxUnavailable := intstr.Parse(opts.RollingUpdate.MaxUnavailable)
+		return appsv1.DeploymentStrategy{
+			Type: appsv1.RollingUpdateDeploymentStrategyType,
+			RollingUpdate: &appsv1.RollingUpdateDeployment{
+				MaxSurge:       &maxSurge,
+				MaxUnavailable: &maxUnavailable,
+			},
+		}, nil
+	case UpdateStrategyRecreate:
+		return appsv1.DeploymentStrategy{
+			Type: appsv1.RecreateDeploymentStrategyType,
+		}, nil
+	default:
+		return appsv1.DeploymentStrategy{}, fmt.Errorf("unsupported deployment strategy: '%s'", opts.Strategy)
+	}
+}
+
+// setLifecycle 设置容器的 preStop、postStart 钩子以及 Pod 的终止宽限期
+func setLifecycle(template *corev1.PodTemplateSpec, opts DeploymentOptions) error {
+	gracePeriod := int64(defaultTerminationGracePeriodSeconds)
+	if opts.TerminationGracePeriodSeconds > 0 {
+		gracePeriod = opts.TerminationGracePeriodSeconds
+		template.Spec.TerminationGracePeriodSeconds = &opts.TerminationGracePeriodSeconds
+	}
+
+	preStop, err := newLifecycleHandler(opts.Lifecycle.PreStop, opts.Port)
+	if err != nil {
+		return fmt.Errorf("invalid prestop hook: %v", err)
+	}
+	postStart, err := newLifecycleHandler(opts.Lifecycle.PostStart, opts.Port)
+	if err != nil {
+		return fmt.Errorf("invalid poststart hook: %v", err)
+	}
+	if preStop == nil && postStart == nil {
+		return nil
+	}
+
+	// 宽限期从 preStop 开始计时，preStop 用完宽限期后容器会被直接杀掉
+	if preStop != nil && preStop.Sleep != nil && preStop.Sleep.Seconds >= gracePeriod {
+		return fmt.Errorf("prestop sleep of %d seconds must be shorter than the termination grace period of %d seconds", preStop.Sleep.Seconds, gracePeriod)
+	}
+
+	template.Spec.Containers[0].Lifecycle = &corev1.Lifecycle{
+		PreStop:   preStop,
+		PostStart: postStart,
+	}
+	return nil
+}
+
+// newLifecycleHandler 根据钩子类型构造生命周期钩子，未指定端口时使用容器端口
+func newLifecycleHandler(opts LifecycleHandler, containerPort int32) (*corev1.LifecycleHandler, error) {
+	switch strings.ToLower(opts.Type) {
+	case "":
+		return nil, nil
+	case LifecycleTypeExec:
+		if helpers.IsBlank(opts.Command) {
+			return nil, fmt.Errorf("command is required by exec type")
+		}
+		return &corev1.LifecycleHandler{
+			Exec: &corev1.ExecAction{
+				Command: []string{"/bin/sh", "-c", opts.Command},
+			},
+		}, nil
+	case LifecycleTypeHTTPGet:
+		port := intstr.FromInt32(containerPort)
+		if !helpers.IsBlank(opts.Port) {
+			port = intstr.Parse(strings.TrimSpace(opts.Port))
+		}
+		scheme := corev1.URISchemeHTTP
+		if !helpers.IsBlank(opts.Scheme) {
+			scheme = corev1.URIScheme(strings.ToUpper(opts.Scheme))
+		}
+		return &corev1.LifecycleHandler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   opts.Path,
+				Port:   port,
+				Scheme: scheme,
+			},
+		}, nil
+	case LifecycleTypeSleep:
+		if opts.Seconds <= 0 {
+			return nil, fmt.Errorf("seconds must be greater than 0 by sleep type")
+		}
+		return &corev1.LifecycleHandler{
+			Sleep: &corev1.SleepAction{
+				Seconds: opts.Seconds,
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported lifecycle hook type: '%s'", opts.Type)
+	}
+}
@@ -0,0 +1,99 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPodTemplateLifecycle(t *testing.T) {
+	opts := newTestDeploymentOptions()
+	opts.TerminationGracePeriodSeconds = 45
+	opts.Lifecycle = Lifecycle{
+		PreStop:   LifecycleHandler{Type: "Sleep", Seconds: 10},
+		PostStart: LifecycleHandler{Type: "HTTPGet", Path: "/warmup"},
+	}
+
+	template, err := newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *template.Spec.TerminationGracePeriodSeconds != 45 {
+		t.Errorf("expected termination grace period 45, got %d", *template.Spec.TerminationGracePeriodSeconds)
+	}
+	lifecycle := template.Spec.Containers[0].Lifecycle
+	if lifecycle.PreStop.Sleep.Seconds != 10 {
+		t.Errorf("expected prestop sleep of 10 seconds, got %+v", lifecycle.PreStop)
+	}
+	if lifecycle.PostStart.HTTPGet.Path != "/warmup" || lifecycle.PostStart.HTTPGet.Port.IntValue() != 8080 {
+		t.Errorf("expected poststart http get on container port, got %+v", lifecycle.PostStart.HTTPGet)
+	}
+
+	opts.Lifecycle.PreStop = LifecycleHandler{Type: "exec", Command: "nginx -s quit"}
+	template, err = newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command := template.Spec.Containers[0].Lifecycle.PreStop.Exec.Command; command[2] != "nginx -s quit" {
+		t.Errorf("expected prestop command to run in a shell, got %v", command)
+	}
+
+	opts = newTestDeploymentOptions()
+	template, err = newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Spec.Containers[0].Lifecycle != nil || template.Spec.TerminationGracePeriodSeconds != nil {
+		t.Errorf("expected no lifecycle by default, got %+v", template.Spec.Containers[0].Lifecycle)
+	}
+}
+
+func TestPodTemplateLifecycleInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		lifecycle Lifecycle
+		want      string
+	}{
+		{"sleep exceeds grace period", Lifecycle{PreStop: LifecycleHandler{Type: "sleep", Seconds: 30}}, "must be shorter than the termination grace period of 30 seconds"},
+		{"sleep without seconds", Lifecycle{PreStop: LifecycleHandler{Type: "sleep"}}, "invalid prestop hook"},
+		{"exec without command", Lifecycle{PostStart: LifecycleHandler{Type: "exec"}}, "invalid poststart hook"},
+		{"unknown type", Lifecycle{PreStop: LifecycleHandler{Type: "tcpsocket"}}, "unsupported lifecycle hook type"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := newTestDeploymentOptions()
+			opts.Lifecycle = tc.lifecycle
+			_, err := newPodTemplateSpec(opts)
+			assertErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestCreateOrUpdateDeploymentRecreate(t *testing.T) {
+	ctx := context.Background()
+	opts := newTestDeploymentOptions()
+	opts.Strategy = UpdateStrategyRecreate
+	opts.MinReadySeconds = 5
+	opts.ProgressDeadlineSeconds = 120
+	opts.RevisionHistoryLimit = 3
+
+	clientset := fake.NewSimpleClientset()
+	if err := CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Strategy.Type != appsv1.RecreateDeploymentStrategyType || deployment.Spec.Strategy.RollingUpdate != nil {
+		t.Errorf("expected recreate strategy, got %+v", deployment.Spec.Strategy)
+	}
+	if deployment.Spec.MinReadySeconds != 5 || *deployment.Spec.ProgressDeadlineSeconds != 120 || *deployment.Spec.RevisionHistoryLimit != 3 {
+		t.Errorf("unexpected deployment spec %+v", deployment.Spec)
+	}
+
+	opts.Strategy = "bluegreen"
+	assertErrorContains(t, CreateOrUpdateDeployment(clientset, ctx, opts, func(string) {}), "unsupported deployment strategy")
+}
@@ -0,0 +1,156 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	MonitorServiceMonitor = "servicemonitor"
+	MonitorPodMonitor     = "podmonitor"
+)
+
+const monitoringGroupVersion = "monitoring.coreos.com/v1"
+
+var serviceMonitorGVR = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1",
+	Resource: "servicemonitors",
+}
+
+var podMonitorGVR = schema.GroupVersionResource{
+	Group:    "monitoring.coreos.com",
+	Version:  "v1",
+	Resource: "podmonitors",
+}
+
+// MetricsOptions 用于暴露 Prometheus 指标端口，并可选地创建 prometheus-operator 的 ServiceMonitor 或 PodMonitor
+type MetricsOptions struct {
+	Name      string
+	Namespace string
+	Enabled   bool `form:"enabled" json:"enabled"`
+	// Port 为指标端口，为 0 或与应用端口相同时复用应用端口
+	Port     int32  `form:"port" json:"port"`
+	Path     string `form:"path" json:"path"`
+	Scheme   string `form:"scheme" json:"scheme"`
+	Interval string `form:"interval" json:"interval"`
+	// Monitor 为 servicemonitor 或 podmonitor，为空时只添加 prometheus.io 注解
+	Monitor string `form:"monitor" json:"monitor"`
+	// Labels 为 Monitor 的标签，用于匹配 Prometheus 的 serviceMonitorSelector 或 podMonitorSelector
+	Labels []string `form:"labels" json:"labels"`
+}
+
+// MetricsPortName 返回指标端口的名称，复用应用端口时为 app
+func MetricsPortName(opts MetricsOptions, appPort int32) string {
+	if opts.Port == 0 || opts.Port == appPort {
+		return "app"
+	}
+	return "metrics"
+}
+
+// MonitorGVR 返回 Monitor 类型对应的资源
+func MonitorGVR(monitor string) schema.GroupVersionResource {
+	if monitor == MonitorPodMonitor {
+		return podMonitorGVR
+	}
+	return serviceMonitorGVR
+}
+
+// setMetrics 为 Pod 模板添加 prometheus.io 注解，指标端口独立时为容器添加 metrics 端口
+func setMetrics(template *corev1.PodTemplateSpec, opts DeploymentOptions) {
+	if !opts.Metrics.Enabled {
+		return
+	}
+
+	port := opts.Metrics.Port
+	if port == 0 {
+		port = opts.Port
+	}
+	if template.Annotations == nil {
+		template.Annotations = make(map[string]string)
+	}
+	template.Annotations["prometheus.io/scrape"] = "true"
+	template.Annotations["prometheus.io/port"] = strconv.Itoa(int(port))
+	template.Annotations["prometheus.io/path"] = opts.Metrics.Path
+	template.Annotations["prometheus.io/scheme"] = opts.Metrics.Scheme
+
+	if MetricsPortName(opts.Metrics, opts.Port) == "metrics" {
+		template.Spec.Containers[0].Ports = append(template.Spec.Containers[0].Ports, corev1.ContainerPort{
+			Name:          "metrics",
+			ContainerPort: port,
+		})
+	}
+}
+
+// CreateOrUpdateMonitor 创建或更新指向应用 Service 或 Pod 指标端口的 ServiceMonitor 或 PodMonitor
+func CreateOrUpdateMonitor(dynamicClient dynamic.Interface, ctx context.Context, opts MetricsOptions, appPort int32, logHandler func(msg string)) error {
+	labels := map[string]interface{}{
+		"app":          opts.Name,
+		ManagedByLabel: managedBy,
+		AppLabel:       opts.Name,
+	}
+	for _, label := range opts.Labels {
+		key, value, found := strings.Cut(label, "=")
+		if !found || helpers.IsBlank(key) {
+			return fmt.Errorf("invalid format for monitor label: '%s', expected 'key=value'", label)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	endpoint := map[string]interface{}{
+		"port":   MetricsPortName(opts, appPort),
+		"path":   opts.Path,
+		"scheme": opts.Scheme,
+	}
+	if !helpers.IsBlank(opts.Interval) {
+		endpoint["interval"] = opts.Interval
+	}
+
+	spec := map[string]interface{}{
+		"selector": map[string]interface{}{
+			"matchLabels": map[string]interface{}{
+				"name": opts.Name,
+			},
+		},
+	}
+	kind := "ServiceMonitor"
+	if opts.Monitor == MonitorPodMonitor {
+		kind = "PodMonitor"
+		spec["podMetricsEndpoints"] = []interface{}{endpoint}
+	} else {
+		spec["endpoints"] = []interface{}{endpoint}
+	}
+
+	monitor := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": monitoringGroupVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      opts.Name,
+				"namespace": opts.Namespace,
+				"labels":    labels,
+			},
+			"spec": spec,
+		},
+	}
+
+	resourceName := strings.ToLower(kind)
+	created, err := createOrUpdateUnstructured(dynamicClient, ctx, MonitorGVR(opts.Monitor), monitor)
+	if err != nil {
+		return fmt.Errorf("failed to create or update %s resource: %v", resourceName, err)
+	}
+	if created {
+		logHandler(fmt.Sprintf("%s resource successfully created", resourceName))
+	} else {
+		logHandler(fmt.Sprintf("%s resource successfully updated", resourceName))
+	}
+	return nil
+}
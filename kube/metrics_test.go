@@ -0,0 +1,103 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func newTestMetricsOptions() MetricsOptions {
+	return MetricsOptions{Name: "hellogo", Namespace: testNamespace, Enabled: true, Port: 9090, Path: "/metrics", Scheme: "http", Interval: "30s"}
+}
+
+func TestPodTemplateMetrics(t *testing.T) {
+	opts := newTestDeploymentOptions()
+	opts.Metrics = newTestMetricsOptions()
+
+	template, err := newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Annotations["prometheus.io/scrape"] != "true" || template.Annotations["prometheus.io/port"] != "9090" || template.Annotations["prometheus.io/path"] != "/metrics" {
+		t.Errorf("unexpected prometheus annotations %v", template.Annotations)
+	}
+	ports := template.Spec.Containers[0].Ports
+	if len(ports) != 2 || ports[1].Name != "metrics" || ports[1].ContainerPort != 9090 {
+		t.Errorf("expected a metrics container port 9090, got %v", ports)
+	}
+
+	// 指标端口与应用端口相同时不新增端口
+	opts.Metrics.Port = opts.Port
+	template, err = newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(template.Spec.Containers[0].Ports) != 1 {
+		t.Errorf("expected only the app port, got %v", template.Spec.Containers[0].Ports)
+	}
+
+	opts.Metrics.Enabled = false
+	template, err = newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(template.Annotations) != 0 {
+		t.Errorf("expected no annotation, got %v", template.Annotations)
+	}
+}
+
+func TestCreateOrUpdateMonitor(t *testing.T) {
+	ctx := context.Background()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		serviceMonitorGVR: "ServiceMonitorList",
+		podMonitorGVR:     "PodMonitorList",
+	})
+
+	opts := newTestMetricsOptions()
+	opts.Monitor = MonitorServiceMonitor
+	opts.Labels = []string{"release=kube-prometheus-stack"}
+	logs := &logRecorder{}
+	if err := CreateOrUpdateMonitor(dynamicClient, ctx, opts, 8000, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "servicemonitor resource successfully created")
+
+	monitor, err := dynamicClient.Resource(serviceMonitorGVR).Namespace(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if monitor.GetLabels()["release"] != "kube-prometheus-stack" {
+		t.Errorf("expected label release=kube-prometheus-stack, got %v", monitor.GetLabels())
+	}
+	endpoints, _, _ := unstructured.NestedSlice(monitor.Object, "spec", "endpoints")
+	endpoint := endpoints[0].(map[string]interface{})
+	if endpoint["port"] != "metrics" || endpoint["interval"] != "30s" {
+		t.Errorf("unexpected endpoint %v", endpoint)
+	}
+
+	if err := CreateOrUpdateMonitor(dynamicClient, ctx, opts, 8000, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "servicemonitor resource successfully updated")
+
+	opts.Monitor = MonitorPodMonitor
+	opts.Port = 0
+	if err := CreateOrUpdateMonitor(dynamicClient, ctx, opts, 8000, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	monitor, err = dynamicClient.Resource(podMonitorGVR).Namespace(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if endpoints, _, _ := unstructured.NestedSlice(monitor.Object, "spec", "podMetricsEndpoints"); endpoints[0].(map[string]interface{})["port"] != "app" {
+		t.Errorf("expected the pod monitor to scrape the app port, got %v", endpoints)
+	}
+
+	opts.Labels = []string{"release"}
+	assertErrorContains(t, CreateOrUpdateMonitor(dynamicClient, ctx, opts, 8000, logs.handle), "invalid format for monitor label")
+}
@@ -10,10 +10,13 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-func CreateOrUpdateNamespace(clientset *kubernetes.Clientset, ctx context.Context, namespace string, logHandler func(msg string)) error {
+// CreateOrUpdateNamespace 创建属于应用的命名空间；已存在但不由 appdeployer 管理的命名空间（已确认接管）会被标记为属于该应用，
+// 属于其他应用的命名空间保持不变
+func CreateOrUpdateNamespace(clientset kubernetes.Interface, ctx context.Context, namespace, app string, logHandler func(msg string)) error {
 	ns := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: namespace,
+			Name:   namespace,
+			Labels: ownerLabels(app),
 		},
 	}
 
@@ -21,6 +24,17 @@ func CreateOrUpdateNamespace(clientset *kubernetes.Clientset, ctx context.Contex
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create namespace resource: %v", err)
 		}
+
+		live, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get namespace resource: %v", err)
+		}
+		if _, managed := ownerOf(live); !managed {
+			setOwnerLabels(&live.ObjectMeta, app)
+			if _, err := clientset.CoreV1().Namespaces().Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("failed to update namespace resource: %v", err)
+			}
+		}
 		logHandler("namespace resource successfully updated")
 	} else {
 		logHandler("namespace resource successfully created")
@@ -0,0 +1,42 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateNamespace(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("create", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		logs := &logRecorder{}
+		if err := CreateOrUpdateNamespace(clientset, ctx, testNamespace, "hellogo", logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientset.CoreV1().Namespaces().Get(ctx, testNamespace, metav1.GetOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "successfully created")
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}})
+		logs := &logRecorder{}
+		if err := CreateOrUpdateNamespace(clientset, ctx, testNamespace, "hellogo", logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "successfully updated")
+	})
+
+	t.Run("create fails", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		failOn(clientset, "create", "namespaces")
+		err := CreateOrUpdateNamespace(clientset, ctx, testNamespace, "hellogo", func(string) {})
+		assertErrorContains(t, err, "failed to create namespace resource")
+	})
+}
@@ -0,0 +1,172 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// restartedAtAnnotation 与 kubectl rollout restart 使用的注解相同
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// ScaleOptions 用于手动调整应用 Deployment 的副本数
+type ScaleOptions struct {
+	Name      string
+	Namespace string
+	Replicas  int32
+	// AdjustHPA 为 true 时，副本数超出 HPA 的范围则临时放宽 HPA 的 min/max，下次发布时恢复配置的值
+	AdjustHPA bool
+}
+
+// ScaleDeployment 调整 Deployment 的副本数。存在 HPA 时副本数仍由 HPA 管理，超出范围的副本数会被 HPA 拉回，
+// 因此给出警告，或在 AdjustHPA 时临时放宽 HPA 的范围
+func ScaleDeployment(clientset kubernetes.Interface, ctx context.Context, opts ScaleOptions, logHandler func(msg string)) error {
+	if opts.Replicas < 0 {
+		return fmt.Errorf("replicas must not be negative")
+	}
+
+	hpa, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get hpa %s: %v", opts.Name, err)
+	}
+	if err == nil && hpa.Spec.ScaleTargetRef.Kind == "Deployment" && hpa.Spec.ScaleTargetRef.Name == opts.Name {
+		if err := fitHPA(clientset, ctx, hpa, opts, logHandler); err != nil {
+			return err
+		}
+	}
+
+	previous, err := scaleDeployment(clientset, ctx, opts.Name, opts.Namespace, opts.Replicas)
+	if err != nil {
+		return err
+	}
+	// 记录新的副本数，否则漂移检查会报告它，重新应用时还会还原
+	if err := updateDeployment(clientset, ctx, opts.Name, opts.Namespace, func(deployment *appsv1.Deployment) error {
+		_, err := updateLastApplied(&deployment.ObjectMeta, func(applied map[string]interface{}) {
+			setAppliedSpecField(applied, "replicas", opts.Replicas)
+		})
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to record the replicas of deployment %s: %v", opts.Name, err)
+	}
+	logHandler(fmt.Sprintf("deployment %s scaled from %d to %d replicas", opts.Name, previous, opts.Replicas))
+	return nil
+}
+
+// fitHPA 检查副本数是否在 HPA 的范围内
+func fitHPA(clientset kubernetes.Interface, ctx context.Context, hpa *autoscalingv2.HorizontalPodAutoscaler, opts ScaleOptions, logHandler func(msg string)) error {
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+	maxReplicas := hpa.Spec.MaxReplicas
+
+	if opts.Replicas == 0 {
+		logHandler(fmt.Sprintf("WARNING: hpa %s stops autoscaling while deployment %s has 0 replicas", hpa.Name, opts.Name))
+		return nil
+	}
+	if opts.Replicas >= minReplicas && opts.Replicas <= maxReplicas {
+		logHandler(fmt.Sprintf("WARNING: hpa %s keeps managing replicas between %d and %d, it may change the replicas again", hpa.Name, minReplicas, maxReplicas))
+		return nil
+	}
+	if !opts.AdjustHPA {
+		logHandler(fmt.Sprintf("WARNING: %d replicas is out of the range %d-%d of hpa %s, it will scale the deployment back", opts.Replicas, minReplicas, maxReplicas, hpa.Name))
+		return nil
+	}
+
+	if opts.Replicas < minReplicas {
+		minReplicas = opts.Replicas
+	}
+	if opts.Replicas > maxReplicas {
+		maxReplicas = opts.Replicas
+	}
+	hpa.Spec.MinReplicas = &minReplicas
+	hpa.Spec.MaxReplicas = maxReplicas
+	if _, err := updateLastApplied(&hpa.ObjectMeta, func(applied map[string]interface{}) {
+		setAppliedSpecField(applied, "minReplicas", minReplicas)
+		setAppliedSpecField(applied, "maxReplicas", maxReplicas)
+	}); err != nil {
+		return err
+	}
+	if _, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(opts.Namespace).Update(ctx, hpa, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update hpa %s: %v", hpa.Name, err)
+	}
+	logHandler(fmt.Sprintf("hpa %s temporarily adjusted to %d-%d replicas, the next deploy restores the configured range", hpa.Name, minReplicas, maxReplicas))
+	return nil
+}
+
+// RestartDeployment 通过更新 Pod 模板的注解滚动重启 Deployment，与 kubectl rollout restart 相同
+func RestartDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	err := updateDeployment(clientset, ctx, name, namespace, func(deployment *appsv1.Deployment) error {
+		if deployment.Spec.Paused {
+			return fmt.Errorf("deployment %s is paused, resume it before restarting", name)
+		}
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = make(map[string]string)
+		}
+		deployment.Spec.Template.Annotations[restartedAtAnnotation] = time.Now().Format(time.RFC3339)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logHandler(fmt.Sprintf("deployment %s restarted", name))
+	return nil
+}
+
+// PauseDeployment 暂停 Deployment 的发布，暂停期间对 Pod 模板的修改不会触发滚动更新
+func PauseDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	return setDeploymentPaused(clientset, ctx, name, namespace, true, logHandler)
+}
+
+// ResumeDeployment 恢复 Deployment 的发布，暂停期间积累的修改会一次性滚动更新
+func ResumeDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	return setDeploymentPaused(clientset, ctx, name, namespace, false, logHandler)
+}
+
+func setDeploymentPaused(clientset kubernetes.Interface, ctx context.Context, name, namespace string, paused bool, logHandler func(msg string)) error {
+	state := "resumed"
+	if paused {
+		state = "paused"
+	}
+
+	changed := false
+	err := updateDeployment(clientset, ctx, name, namespace, func(deployment *appsv1.Deployment) error {
+		changed = deployment.Spec.Paused != paused
+		deployment.Spec.Paused = paused
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !changed {
+		logHandler(fmt.Sprintf("deployment %s is already %s, no action taken", name, state))
+		return nil
+	}
+	logHandler(fmt.Sprintf("deployment %s %s", name, state))
+	return nil
+}
+
+// updateDeployment 读取 Deployment 并在冲突时重试更新
+func updateDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, mutate func(deployment *appsv1.Deployment) error) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("deployment %s not found in namespace %s", name, namespace)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get deployment %s: %v", name, err)
+		}
+		if err := mutate(deployment); err != nil {
+			return err
+		}
+		_, err = clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+}
@@ -0,0 +1,182 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestScaleClient 返回支持 Deployment scale 子资源的 fake 客户端，scale 的读写落到 Deployment 的副本数上
+func newTestScaleClient(objects ...runtime.Object) *fake.Clientset {
+	clientset := fake.NewSimpleClientset(objects...)
+	clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		name := action.(k8stesting.GetAction).GetName()
+		deployment, err := clientset.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), action.GetNamespace(), name)
+		if err != nil {
+			return true, nil, err
+		}
+		return true, &autoscalingv1.Scale{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: action.GetNamespace()},
+			Spec:       autoscalingv1.ScaleSpec{Replicas: *deployment.(*appsv1.Deployment).Spec.Replicas},
+		}, nil
+	})
+	clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "scale" {
+			return false, nil, nil
+		}
+		scale := action.(k8stesting.UpdateAction).GetObject().(*autoscalingv1.Scale)
+		obj, err := clientset.Tracker().Get(appsv1.SchemeGroupVersion.WithResource("deployments"), action.GetNamespace(), scale.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		deployment := obj.(*appsv1.Deployment)
+		deployment.Spec.Replicas = &scale.Spec.Replicas
+		return true, scale, clientset.Tracker().Update(appsv1.SchemeGroupVersion.WithResource("deployments"), deployment, action.GetNamespace())
+	})
+	return clientset
+}
+
+func newTestOperationDeployment() *appsv1.Deployment {
+	replicas := int32(2)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
+
+func newTestOperationHPA(minReplicas, maxReplicas int32) *autoscalingv2.HorizontalPodAutoscaler {
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{Kind: "Deployment", Name: "hellogo"},
+			MinReplicas:    &minReplicas,
+			MaxReplicas:    maxReplicas,
+		},
+	}
+}
+
+func TestScaleDeployment(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without hpa", func(t *testing.T) {
+		clientset := newTestScaleClient(newTestOperationDeployment())
+		logs := &logRecorder{}
+		if err := ScaleDeployment(clientset, ctx, ScaleOptions{Name: "hellogo", Namespace: testNamespace, Replicas: 5}, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "scaled from 2 to 5 replicas")
+		deployment, _ := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+		if *deployment.Spec.Replicas != 5 {
+			t.Errorf("expected 5 replicas, got %d", *deployment.Spec.Replicas)
+		}
+	})
+
+	t.Run("records the replicas as applied", func(t *testing.T) {
+		deployment := newTestOperationDeployment()
+		if err := setLastApplied(&deployment.ObjectMeta, deployment.Spec); err != nil {
+			t.Fatal(err)
+		}
+		clientset := newTestScaleClient(deployment)
+		if err := ScaleDeployment(clientset, ctx, ScaleOptions{Name: "hellogo", Namespace: testNamespace, Replicas: 5}, func(string) {}); err != nil {
+			t.Fatal(err)
+		}
+		drifts, err := CheckDrift(clientset, ctx, DriftOptions{Name: "hellogo", Namespace: testNamespace}, func(string) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(drifts) != 0 {
+			t.Errorf("expected no drift after scaling, got %v", drifts)
+		}
+	})
+
+	t.Run("out of hpa range", func(t *testing.T) {
+		clientset := newTestScaleClient(newTestOperationDeployment(), newTestOperationHPA(1, 4))
+		logs := &logRecorder{}
+		if err := ScaleDeployment(clientset, ctx, ScaleOptions{Name: "hellogo", Namespace: testNamespace, Replicas: 8}, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "out of the range 1-4 of hpa hellogo")
+	})
+
+	t.Run("adjust hpa", func(t *testing.T) {
+		hpa := newTestOperationHPA(3, 4)
+		if err := setLastApplied(&hpa.ObjectMeta, hpa.Spec); err != nil {
+			t.Fatal(err)
+		}
+		clientset := newTestScaleClient(newTestOperationDeployment(), hpa)
+		logs := &logRecorder{}
+		if err := ScaleDeployment(clientset, ctx, ScaleOptions{Name: "hellogo", Namespace: testNamespace, Replicas: 8, AdjustHPA: true}, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "temporarily adjusted to 3-8 replicas")
+		hpa, _ = clientset.AutoscalingV2().HorizontalPodAutoscalers(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+		if *hpa.Spec.MinReplicas != 3 || hpa.Spec.MaxReplicas != 8 {
+			t.Errorf("expected hpa range 3-8, got %d-%d", *hpa.Spec.MinReplicas, hpa.Spec.MaxReplicas)
+		}
+		drifts, err := CheckDrift(clientset, ctx, DriftOptions{Name: "hellogo", Namespace: testNamespace}, func(string) {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(drifts) != 0 {
+			t.Errorf("expected no drift after adjusting the hpa, got %v", drifts)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		clientset := newTestScaleClient()
+		assertErrorContains(t, ScaleDeployment(clientset, ctx, ScaleOptions{Name: "hellogo", Namespace: testNamespace, Replicas: 1}, func(string) {}), "failed to get scale of deployment hellogo")
+	})
+}
+
+func TestRestartDeployment(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newTestOperationDeployment())
+	logs := &logRecorder{}
+	if err := RestartDeployment(clientset, ctx, "hellogo", testNamespace, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	deployment, _ := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if deployment.Spec.Template.Annotations[restartedAtAnnotation] == "" {
+		t.Errorf("expected the restartedAt annotation on the pod template, got %v", deployment.Spec.Template.Annotations)
+	}
+
+	if err := PauseDeployment(clientset, ctx, "hellogo", testNamespace, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	assertErrorContains(t, RestartDeployment(clientset, ctx, "hellogo", testNamespace, logs.handle), "resume it before restarting")
+	assertErrorContains(t, RestartDeployment(clientset, ctx, "hellojava", testNamespace, logs.handle), "deployment hellojava not found")
+}
+
+func TestPauseResumeDeployment(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(newTestOperationDeployment())
+	logs := &logRecorder{}
+
+	if err := PauseDeployment(clientset, ctx, "hellogo", testNamespace, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "deployment hellogo paused")
+	if err := PauseDeployment(clientset, ctx, "hellogo", testNamespace, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "already paused, no action taken")
+
+	if err := ResumeDeployment(clientset, ctx, "hellogo", testNamespace, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "deployment hellogo resumed")
+	deployment, _ := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if deployment.Spec.Paused {
+		t.Error("expected the deployment to be resumed")
+	}
+}
@@ -0,0 +1,193 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// ManagedByLabel 标记资源由 appdeployer 管理
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// AppLabel 标记资源所属的应用
+	AppLabel = "appdeployer.io/app"
+	// ComponentLabel 标记应用的附属资源，如金丝雀
+	ComponentLabel = "appdeployer.io/component"
+)
+
+// ComponentCanary 为金丝雀的 Deployment、Service 与 Ingress
+const ComponentCanary = "canary"
+
+const managedBy = "appdeployer"
+
+const (
+	KindService        = "service"
+	KindIngress        = "ingress"
+	KindHPA            = "hpa"
+	KindServiceAccount = "serviceaccount"
+	KindSecret         = "secret"
+	KindMiddleware     = "middleware"
+	KindResourceQuota  = "resourcequota"
+	KindLimitRange     = "limitrange"
+)
+
+// ownedGVRs 为通过动态客户端管理的资源，键为资源的单数名称
+var ownedGVRs = map[string]schema.GroupVersionResource{
+	"httproute":      httpRouteGVR,
+	"grpcroute":      grpcRouteGVR,
+	"servicemonitor": serviceMonitorGVR,
+	"podmonitor":     podMonitorGVR,
+	"middleware":     middlewareGVR,
+}
+
+// OwnershipOptions 列出一次发布将要修改的资源，用于检查它们是否属于该应用
+type OwnershipOptions struct {
+	App       string
+	Namespace string
+	// Adopt 为 true 时接管不属于该应用的资源，否则拒绝修改
+	Adopt   bool
+	Objects []OwnedObject
+}
+
+// OwnedObject 为命名空间下的一个资源，Kind 为工作负载类型、Kind 常量或路由、Monitor 的单数资源名
+type OwnedObject struct {
+	Kind string
+	Name string
+}
+
+// ownerLabels 返回标记资源属于应用的标签
+func ownerLabels(app string) map[string]string {
+	return map[string]string{
+		ManagedByLabel: managedBy,
+		AppLabel:       app,
+	}
+}
+
+// componentLabels 返回标记资源为应用附属资源的标签，component 为空时与 ownerLabels 相同
+func componentLabels(app, component string) map[string]string {
+	labels := ownerLabels(app)
+	if component != "" {
+		labels[ComponentLabel] = component
+	}
+	return labels
+}
+
+// setOwnerLabels 为资源加上属于应用的标签，返回标签是否有变化
+func setOwnerLabels(meta *metav1.ObjectMeta, app string) bool {
+	changed := false
+	for key, value := range ownerLabels(app) {
+		if meta.Labels[key] == value {
+			continue
+		}
+		if meta.Labels == nil {
+			meta.Labels = make(map[string]string)
+		}
+		meta.Labels[key] = value
+		changed = true
+	}
+	return changed
+}
+
+// CheckOwnership 在修改任何资源前检查命名空间与资源的归属。
+// 不是由 appdeployer 创建的资源以及属于其他应用的资源只有在 Adopt 时才会被接管；
+// 命名空间可以由多个应用共享，属于其他应用时只给出警告
+func CheckOwnership(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts OwnershipOptions, logHandler func(msg string)) error {
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, opts.Namespace, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to get namespace %s: %v", opts.Namespace, err)
+	}
+	if err == nil {
+		owner, managed := ownerOf(ns)
+		switch {
+		case !managed:
+			if err := refuseOrAdopt("namespace", opts.Namespace, "it is not managed by appdeployer", opts, logHandler); err != nil {
+				return err
+			}
+		case owner != opts.App:
+			logHandler(fmt.Sprintf("WARNING: namespace %s belongs to app %s, app %s shares it", opts.Namespace, owner, opts.App))
+		}
+	}
+
+	for _, object := range opts.Objects {
+		live, err := getObjectMeta(clientset, dynamicClient, ctx, object, opts.Namespace)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			continue
+		}
+		owner, managed := ownerOf(live)
+		switch {
+		case !managed:
+			err = refuseOrAdopt(object.Kind, object.Name, "it is not managed by appdeployer", opts, logHandler)
+		case owner != opts.App:
+			logHandler(fmt.Sprintf("WARNING: app name %s collides with app %s in namespace %s", opts.App, owner, opts.Namespace))
+			err = refuseOrAdopt(object.Kind, object.Name, fmt.Sprintf("it belongs to app %s", owner), opts, logHandler)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ownerOf(object metav1.Object) (string, bool) {
+	labels := object.GetLabels()
+	return labels[AppLabel], labels[ManagedByLabel] == managedBy
+}
+
+func refuseOrAdopt(kind, name, reason string, opts OwnershipOptions, logHandler func(msg string)) error {
+	if !opts.Adopt {
+		return fmt.Errorf("refusing to modify %s %s in namespace %s as %s, rerun with --adopt to take it over", kind, name, opts.Namespace, reason)
+	}
+	logHandler(fmt.Sprintf("%s %s in namespace %s will be adopted by app %s as %s", kind, name, opts.Namespace, opts.App, reason))
+	return nil
+}
+
+// getObjectMeta 返回资源的元数据，资源或其 CRD 不存在时返回 nil
+func getObjectMeta(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, object OwnedObject, namespace string) (metav1.Object, error) {
+	var live metav1.Object
+	var err error
+	switch object.Kind {
+	case WorkloadDeployment:
+		live, err = clientset.AppsV1().Deployments(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case WorkloadStatefulSet:
+		live, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case WorkloadDaemonSet:
+		live, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindService:
+		live, err = clientset.CoreV1().Services(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindIngress:
+		live, err = clientset.NetworkingV1().Ingresses(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindHPA:
+		live, err = clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindServiceAccount:
+		live, err = clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindSecret:
+		live, err = clientset.CoreV1().Secrets(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindPVC:
+		live, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindResourceQuota:
+		live, err = clientset.CoreV1().ResourceQuotas(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	case KindLimitRange:
+		live, err = clientset.CoreV1().LimitRanges(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	default:
+		gvr, found := ownedGVRs[object.Kind]
+		if !found {
+			return nil, fmt.Errorf("unsupported kind of owned object: '%s'", object.Kind)
+		}
+		live, err = dynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, object.Name, metav1.GetOptions{})
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %v", object.Kind, object.Name, err)
+	}
+	return live, nil
+}
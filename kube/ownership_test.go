@@ -0,0 +1,163 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestOwnershipOptions() OwnershipOptions {
+	return OwnershipOptions{
+		App:       "hellogo",
+		Namespace: testNamespace,
+		Objects: []OwnedObject{
+			{Kind: WorkloadDeployment, Name: "hellogo"},
+			{Kind: KindService, Name: "hellogo"},
+			{Kind: "httproute", Name: "hellogo"},
+		},
+	}
+}
+
+func TestCheckOwnership(t *testing.T) {
+	ctx := context.Background()
+	ownedNamespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace, Labels: ownerLabels("hellogo")}}
+
+	t.Run("nothing exists", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		if err := CheckOwnership(clientset, dynamicClient, ctx, newTestOwnershipOptions(), func(string) {}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("owned", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(ownedNamespace, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace, Labels: ownerLabels("hellogo")},
+		})
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		if err := CheckOwnership(clientset, dynamicClient, ctx, newTestOwnershipOptions(), func(string) {}); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unmanaged namespace", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace}})
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		opts := newTestOwnershipOptions()
+		assertErrorContains(t, CheckOwnership(clientset, dynamicClient, ctx, opts, func(string) {}), "refusing to modify namespace hello")
+
+		opts.Adopt = true
+		logs := &logRecorder{}
+		if err := CheckOwnership(clientset, dynamicClient, ctx, opts, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "namespace hello in namespace hello will be adopted by app hellogo")
+	})
+
+	t.Run("namespace shared with another app", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace, Labels: ownerLabels("hellojava")}})
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		logs := &logRecorder{}
+		if err := CheckOwnership(clientset, dynamicClient, ctx, newTestOwnershipOptions(), logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "WARNING: namespace hello belongs to app hellojava")
+	})
+
+	t.Run("unmanaged service", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(ownedNamespace, &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+		})
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		assertErrorContains(t, CheckOwnership(clientset, dynamicClient, ctx, newTestOwnershipOptions(), func(string) {}), "refusing to modify service hellogo")
+	})
+
+	t.Run("collides with another app", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(ownedNamespace, &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace, Labels: ownerLabels("hellojava")},
+		})
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		opts := newTestOwnershipOptions()
+		logs := &logRecorder{}
+		assertErrorContains(t, CheckOwnership(clientset, dynamicClient, ctx, opts, logs.handle), "it belongs to app hellojava")
+		logs.assertContains(t, "WARNING: app name hellogo collides with app hellojava")
+
+		opts.Adopt = true
+		if err := CheckOwnership(clientset, dynamicClient, ctx, opts, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("unmanaged resourcequota", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(ownedNamespace, &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+		})
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		opts := newTestOwnershipOptions()
+		opts.Objects = append(opts.Objects, OwnedObject{Kind: KindResourceQuota, Name: "hellogo"}, OwnedObject{Kind: KindLimitRange, Name: "hellogo"})
+		assertErrorContains(t, CheckOwnership(clientset, dynamicClient, ctx, opts, func(string) {}), "refusing to modify resourcequota hellogo")
+	})
+
+	t.Run("unmanaged route", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(ownedNamespace)
+		dynamicClient := newTestRouteClient(metav1.ConditionTrue, "")
+		route, err := newRoute(RouteOptions{Name: "hellogo", Namespace: testNamespace, Gateway: "public"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		route.SetLabels(nil)
+		if _, err := dynamicClient.Resource(httpRouteGVR).Namespace(testNamespace).Create(ctx, route, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		assertErrorContains(t, CheckOwnership(clientset, dynamicClient, ctx, newTestOwnershipOptions(), func(string) {}), "refusing to modify httproute hellogo")
+	})
+}
+
+func TestCreateOrUpdateNamespaceOwnership(t *testing.T) {
+	ctx := context.Background()
+
+	clientset := fake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: testNamespace, Labels: map[string]string{"team": "web"}}})
+	if err := CreateOrUpdateNamespace(clientset, ctx, testNamespace, "hellogo", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, testNamespace, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.Labels[AppLabel] != "hellogo" || ns.Labels[ManagedByLabel] != "appdeployer" || ns.Labels["team"] != "web" {
+		t.Errorf("expected the adopted namespace to be labeled, got %v", ns.Labels)
+	}
+
+	// 与其他应用共享的命名空间保持原来的归属
+	if err := CreateOrUpdateNamespace(clientset, ctx, testNamespace, "hellojava", func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	ns, err = clientset.CoreV1().Namespaces().Get(ctx, testNamespace, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns.Labels[AppLabel] != "hellogo" {
+		t.Errorf("expected the namespace to stay with app hellogo, got %v", ns.Labels)
+	}
+}
+
+func TestCreateOrUpdateDeploymentAdopts(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+	})
+	if err := CreateOrUpdateDeployment(clientset, ctx, newTestDeploymentOptions(), func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Labels[AppLabel] != "hellogo" {
+		t.Errorf("expected the deployment to be owned by hellogo, got %v", deployment.Labels)
+	}
+}
@@ -0,0 +1,388 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	ActionCreate   = "create"
+	ActionInPlace  = "in-place"
+	ActionRecreate = "recreate"
+	ActionDelete   = "delete"
+	ActionBlocked  = "blocked"
+)
+
+const (
+	// StrategyOrphan 删除工作负载但保留 Pod，由新建的同名工作负载接管，服务不中断
+	StrategyOrphan = "orphan"
+	// StrategySurge 先用临时 Deployment 顶替旧的 Deployment，新的 Deployment 就绪后再删除临时 Deployment
+	StrategySurge = "surge"
+	// StrategyReplace 新的工作负载就绪后再删除旧的工作负载
+	StrategyReplace = "replace"
+	// StrategyMigrate 通过复制 Job 将数据迁移到新的 PVC
+	StrategyMigrate = "migrate"
+)
+
+const KindPVC = "pvc"
+
+// Change 描述一个资源在本次发布中的变更方式
+type Change struct {
+	Kind     string
+	Name     string
+	Action   string
+	Strategy string
+	Reason   string
+}
+
+func (change Change) String() string {
+	s := fmt.Sprintf("%s/%s: %s", change.Kind, change.Name, change.Action)
+	if change.Strategy != "" {
+		s += fmt.Sprintf(" (%s)", change.Strategy)
+	}
+	if change.Reason != "" {
+		s += ", " + change.Reason
+	}
+	return s
+}
+
+// Plan 为发布前比对集群现状得出的变更计划
+type Plan struct {
+	Changes []Change
+	// ClaimName 为工作负载当前挂载的 PVC 名称
+	ClaimName string
+}
+
+type PlanOptions struct {
+	Workload           string
+	DeploymentOptions  DeploymentOptions
+	StatefulSetOptions StatefulSetOptions
+	PVCOptions         PVCOptions
+	ConfirmDataLoss    bool
+}
+
+type liveWorkload struct {
+	selector    *metav1.LabelSelector
+	template    corev1.PodTemplateSpec
+	statefulSet *appsv1.StatefulSet
+}
+
+// BuildPlan 比对期望的配置与集群中的现状，找出无法原地更新的变更
+func BuildPlan(clientset kubernetes.Interface, ctx context.Context, opts PlanOptions) (*Plan, error) {
+	plan := &Plan{
+		ClaimName: opts.DeploymentOptions.Name,
+	}
+
+	templates, err := plan.addWorkloads(clientset, ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// StatefulSet 的每个副本通过 volumeClaimTemplates 获得 PVC，已在工作负载中比对
+	if opts.Workload != WorkloadStatefulSet {
+		for _, template := range templates {
+			if claimName := claimNameOf(template); claimName != "" {
+				plan.ClaimName = claimName
+				break
+			}
+		}
+		if err := plan.addPVCs(clientset, ctx, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+func (plan *Plan) Print(logHandler func(msg string)) {
+	logHandler("deploy plan:")
+	for _, change := range plan.Changes {
+		logHandler("  " + change.String())
+	}
+}
+
+// Blocked 返回计划中无法自动完成的变更
+func (plan *Plan) Blocked() error {
+	var reasons []string
+	for _, change := range plan.Changes {
+		if change.Action == ActionBlocked {
+			reasons = append(reasons, change.String())
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return fmt.Errorf("deploy blocked: %s", strings.Join(reasons, "; "))
+}
+
+// Find 返回指定资源的变更
+func (plan *Plan) Find(kind, name string) (Change, bool) {
+	for _, change := range plan.Changes {
+		if change.Kind == kind && change.Name == name {
+			return change, true
+		}
+	}
+	return Change{}, false
+}
+
+func (plan *Plan) add(kind, name, action, strategy, reason string) {
+	plan.Changes = append(plan.Changes, Change{
+		Kind:     kind,
+		Name:     name,
+		Action:   action,
+		Strategy: strategy,
+		Reason:   reason,
+	})
+}
+
+// addWorkloads 比对各类工作负载，返回现存工作负载的 Pod 模板，期望类型的排在最前
+func (plan *Plan) addWorkloads(clientset kubernetes.Interface, ctx context.Context, opts PlanOptions) ([]corev1.PodTemplateSpec, error) {
+	name := opts.DeploymentOptions.Name
+	namespace := opts.DeploymentOptions.Namespace
+
+	var templates []corev1.PodTemplateSpec
+	for _, workload := range []string{WorkloadDeployment, WorkloadStatefulSet, WorkloadDaemonSet} {
+		live, err := getWorkload(clientset, ctx, workload, name, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		if live == nil {
+			if workload == opts.Workload {
+				plan.add(workload, name, ActionCreate, "", "")
+			}
+			continue
+		}
+
+		if workload != opts.Workload {
+			templates = append(templates, live.template)
+			plan.add(workload, name, ActionRecreate, StrategyReplace, fmt.Sprintf("deleted once %s %s is rolled out", opts.Workload, name))
+			continue
+		}
+
+		templates = append([]corev1.PodTemplateSpec{live.template}, templates...)
+		if err := plan.addWorkload(workload, live, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return templates, nil
+}
+
+func (plan *Plan) addWorkload(workload string, live *liveWorkload, opts PlanOptions) error {
+	name := opts.DeploymentOptions.Name
+	selector := &metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"name": name,
+		},
+	}
+
+	if !equality.Semantic.DeepEqual(live.selector, selector) {
+		switch {
+		case labels.SelectorFromSet(selector.MatchLabels).Matches(labels.Set(live.template.Labels)):
+			plan.add(workload, name, ActionRecreate, StrategyOrphan, "selector changed, running pods are adopted by the new one")
+		case workload == WorkloadDeployment:
+			plan.add(workload, name, ActionRecreate, StrategySurge, "selector changed, a temporary deployment serves traffic meanwhile")
+		default:
+			plan.add(workload, name, ActionBlocked, "", fmt.Sprintf("selector changed and running pods lack label name=%s, delete %s %s manually", name, workload, name))
+		}
+		return nil
+	}
+
+	if workload == WorkloadStatefulSet {
+		desired, err := newStatefulSet(opts.StatefulSetOptions)
+		if err != nil {
+			return err
+		}
+		if reasons := statefulSetChanges(live.statefulSet, desired); len(reasons) > 0 {
+			plan.add(workload, name, ActionRecreate, StrategyOrphan, strings.Join(reasons, ", ")+", claims of existing replicas are kept")
+			return nil
+		}
+	}
+
+	plan.add(workload, name, ActionInPlace, "", "")
+	return nil
+}
+
+func (plan *Plan) addPVCs(clientset kubernetes.Interface, ctx context.Context, opts PlanOptions) error {
+	namespace := opts.DeploymentOptions.Namespace
+
+	live, err := getPVC(clientset, ctx, plan.ClaimName, namespace)
+	if err != nil {
+		return err
+	}
+
+	if opts.DeploymentOptions.VolumeMount.Enabled {
+		spec, err := newPVCSpec(opts.PVCOptions.AccessMode, opts.PVCOptions.StorageClassName, opts.PVCOptions.StorageSize)
+		if err != nil {
+			return fmt.Errorf("invalid pvc %s: %v", plan.ClaimName, err)
+		}
+
+		if live == nil {
+			plan.add(KindPVC, plan.ClaimName, ActionCreate, "", "")
+		} else if action, reason := comparePVC(live, spec); action != ActionRecreate {
+			plan.add(KindPVC, plan.ClaimName, action, "", reason)
+		} else if opts.Workload == WorkloadDeployment {
+			plan.add(KindPVC, plan.ClaimName, ActionRecreate, StrategyMigrate, reason+", data is copied to a new pvc while the deployment is scaled down")
+		} else {
+			plan.add(KindPVC, plan.ClaimName, ActionBlocked, "", reason+", migrate the data manually")
+		}
+	} else if live != nil {
+		switch {
+		case strings.ToLower(opts.PVCOptions.RetentionPolicy) != RetentionPolicyDelete:
+			plan.add(KindPVC, plan.ClaimName, ActionInPlace, "", "no longer mounted, retained by retention policy")
+		case !opts.ConfirmDataLoss:
+			plan.add(KindPVC, plan.ClaimName, ActionBlocked, "", "no longer mounted and retention policy is delete, rerun with --confirm-data-loss")
+		default:
+			plan.add(KindPVC, plan.ClaimName, ActionDelete, "", "no longer mounted, snapshotted before deletion")
+		}
+	}
+
+	for _, volume := range opts.DeploymentOptions.Volumes {
+		if strings.ToLower(volume.Type) != VolumeTypePVC {
+			continue
+		}
+
+		name := VolumePVCName(opts.DeploymentOptions.Name, volume)
+		live, err := getPVC(clientset, ctx, name, namespace)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			plan.add(KindPVC, name, ActionCreate, "", "")
+			continue
+		}
+
+		spec, err := newPVCSpec(volume.AccessMode, volume.StorageClassName, volume.StorageSize)
+		if err != nil {
+			return fmt.Errorf("invalid volume '%s': %v", volume.Name, err)
+		}
+		if action, reason := comparePVC(live, spec); action == ActionRecreate {
+			plan.add(KindPVC, name, ActionBlocked, "", reason+fmt.Sprintf(", rename volume %s to provision a new pvc", volume.Name))
+		} else {
+			plan.add(KindPVC, name, action, "", reason)
+		}
+	}
+
+	return nil
+}
+
+func getWorkload(clientset kubernetes.Interface, ctx context.Context, workload, name, namespace string) (*liveWorkload, error) {
+	var live *liveWorkload
+	var err error
+	switch workload {
+	case WorkloadStatefulSet:
+		var sts *appsv1.StatefulSet
+		if sts, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			live = &liveWorkload{selector: sts.Spec.Selector, template: sts.Spec.Template, statefulSet: sts}
+		}
+	case WorkloadDaemonSet:
+		var ds *appsv1.DaemonSet
+		if ds, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			live = &liveWorkload{selector: ds.Spec.Selector, template: ds.Spec.Template}
+		}
+	default:
+		var deployment *appsv1.Deployment
+		if deployment, err = clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			live = &liveWorkload{selector: deployment.Spec.Selector, template: deployment.Spec.Template}
+		}
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %v", workload, name, err)
+	}
+	return live, nil
+}
+
+func getPVC(clientset kubernetes.Interface, ctx context.Context, name, namespace string) (*corev1.PersistentVolumeClaim, error) {
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pvc %s: %v", name, err)
+	}
+	return pvc, nil
+}
+
+// claimNameOf 返回 Pod 模板中 data 卷引用的 PVC 名称
+func claimNameOf(template corev1.PodTemplateSpec) string {
+	for _, volume := range template.Spec.Volumes {
+		if volume.Name == "data" && volume.PersistentVolumeClaim != nil {
+			return volume.PersistentVolumeClaim.ClaimName
+		}
+	}
+	return ""
+}
+
+// comparePVC 比对 PVC 的规格，存储类与访问模式不可变，容量只能扩大
+func comparePVC(live *corev1.PersistentVolumeClaim, desired corev1.PersistentVolumeClaimSpec) (string, string) {
+	var changes []string
+	if desired.StorageClassName != nil && storageClassOf(live.Spec) != *desired.StorageClassName {
+		changes = append(changes, fmt.Sprintf("storage class changed from '%s' to '%s'", storageClassOf(live.Spec), *desired.StorageClassName))
+	}
+	if !equality.Semantic.DeepEqual(live.Spec.AccessModes, desired.AccessModes) {
+		changes = append(changes, fmt.Sprintf("access mode changed from %v to %v", live.Spec.AccessModes, desired.AccessModes))
+	}
+	if len(changes) > 0 {
+		return ActionRecreate, strings.Join(changes, ", ")
+	}
+
+	liveSize := live.Spec.Resources.Requests.Storage()
+	desiredSize := desired.Resources.Requests.Storage()
+	switch liveSize.Cmp(*desiredSize) {
+	case -1:
+		return ActionInPlace, fmt.Sprintf("storage expanded from %s to %s", liveSize, desiredSize)
+	case 1:
+		return ActionBlocked, fmt.Sprintf("storage size cannot shrink from %s to %s", liveSize, desiredSize)
+	}
+	return ActionInPlace, ""
+}
+
+// statefulSetChanges 列出 StatefulSet 中发生变化的不可变字段
+func statefulSetChanges(live, desired *appsv1.StatefulSet) []string {
+	var reasons []string
+	if live.Spec.ServiceName != desired.Spec.ServiceName {
+		reasons = append(reasons, "service name changed")
+	}
+	if live.Spec.PodManagementPolicy != desired.Spec.PodManagementPolicy {
+		reasons = append(reasons, "pod management policy changed")
+	}
+	if claimTemplatesChanged(live.Spec.VolumeClaimTemplates, desired.Spec.VolumeClaimTemplates) {
+		reasons = append(reasons, "volume claim templates changed")
+	}
+	return reasons
+}
+
+func claimTemplatesChanged(live, desired []corev1.PersistentVolumeClaim) bool {
+	if len(live) != len(desired) {
+		return true
+	}
+	for i := range desired {
+		if live[i].Name != desired[i].Name ||
+			storageClassOf(live[i].Spec) != storageClassOf(desired[i].Spec) ||
+			!equality.Semantic.DeepEqual(live[i].Spec.AccessModes, desired[i].Spec.AccessModes) ||
+			live[i].Spec.Resources.Requests.Storage().Cmp(*desired[i].Spec.Resources.Requests.Storage()) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func storageClassOf(spec corev1.PersistentVolumeClaimSpec) string {
+	if spec.StorageClassName == nil {
+		return ""
+	}
+	return *spec.StorageClassName
+}
@@ -0,0 +1,163 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLiveDeployment(selector, podLabels map[string]string, claimName string) *appsv1.Deployment {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+			},
+		},
+	}
+	if claimName != "" {
+		deployment.Spec.Template.Spec.Volumes = []corev1.Volume{{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claimName},
+			},
+		}}
+	}
+	return deployment
+}
+
+func newTestPlanOptions() PlanOptions {
+	return PlanOptions{
+		Workload:          WorkloadDeployment,
+		DeploymentOptions: newTestDeploymentOptions(),
+		PVCOptions:        PVCOptions{StorageSize: "1Gi"},
+	}
+}
+
+func assertChange(t *testing.T, plan *Plan, kind, name, action, strategy string) {
+	t.Helper()
+	change, ok := plan.Find(kind, name)
+	if !ok {
+		t.Fatalf("expected a change of %s/%s, got %v", kind, name, plan.Changes)
+	}
+	if change.Action != action || change.Strategy != strategy {
+		t.Errorf("expected %s/%s: %s (%s), got %s", kind, name, action, strategy, change.String())
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	ctx := context.Background()
+	name := map[string]string{"name": "hellogo"}
+
+	t.Run("create", func(t *testing.T) {
+		opts := newTestPlanOptions()
+		opts.DeploymentOptions.VolumeMount.Enabled = true
+		plan, err := BuildPlan(fake.NewSimpleClientset(), ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, WorkloadDeployment, "hellogo", ActionCreate, "")
+		assertChange(t, plan, KindPVC, "hellogo", ActionCreate, "")
+		if plan.Blocked() != nil {
+			t.Errorf("expected plan not to be blocked: %v", plan.Blocked())
+		}
+	})
+
+	t.Run("in place", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestLiveDeployment(name, name, ""))
+		plan, err := BuildPlan(clientset, ctx, newTestPlanOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, WorkloadDeployment, "hellogo", ActionInPlace, "")
+	})
+
+	t.Run("selector changed", func(t *testing.T) {
+		legacy := map[string]string{"app": "hellogo"}
+		clientset := fake.NewSimpleClientset(newTestLiveDeployment(legacy, legacy, ""))
+		plan, err := BuildPlan(clientset, ctx, newTestPlanOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, WorkloadDeployment, "hellogo", ActionRecreate, StrategySurge)
+
+		clientset = fake.NewSimpleClientset(newTestLiveDeployment(legacy, map[string]string{"app": "hellogo", "name": "hellogo"}, ""))
+		plan, err = BuildPlan(clientset, ctx, newTestPlanOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, WorkloadDeployment, "hellogo", ActionRecreate, StrategyOrphan)
+	})
+
+	t.Run("workload kind changed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestLiveDeployment(name, name, ""))
+		opts := newTestPlanOptions()
+		opts.Workload = WorkloadDaemonSet
+		plan, err := BuildPlan(clientset, ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, WorkloadDaemonSet, "hellogo", ActionCreate, "")
+		assertChange(t, plan, WorkloadDeployment, "hellogo", ActionRecreate, StrategyReplace)
+	})
+
+	t.Run("storage class changed", func(t *testing.T) {
+		pvc := newTestPVC("hellogo-1700000000", "1Gi")
+		clientset := fake.NewSimpleClientset(newTestLiveDeployment(name, name, pvc.Name), pvc)
+		opts := newTestPlanOptions()
+		opts.DeploymentOptions.VolumeMount.Enabled = true
+		opts.PVCOptions.StorageClassName = "ssd"
+		plan, err := BuildPlan(clientset, ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plan.ClaimName != pvc.Name {
+			t.Errorf("expected claim name %s, got %s", pvc.Name, plan.ClaimName)
+		}
+		assertChange(t, plan, KindPVC, pvc.Name, ActionRecreate, StrategyMigrate)
+
+		opts.Workload = WorkloadDaemonSet
+		plan, err = BuildPlan(clientset, ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, KindPVC, pvc.Name, ActionBlocked, "")
+		if plan.Blocked() == nil {
+			t.Error("expected plan to be blocked")
+		}
+	})
+
+	t.Run("storage shrunk", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("hellogo", "2Gi"))
+		opts := newTestPlanOptions()
+		opts.DeploymentOptions.VolumeMount.Enabled = true
+		plan, err := BuildPlan(clientset, ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, KindPVC, "hellogo", ActionBlocked, "")
+	})
+
+	t.Run("pvc no longer mounted", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("hellogo", "1Gi"))
+		opts := newTestPlanOptions()
+		plan, err := BuildPlan(clientset, ctx, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertChange(t, plan, KindPVC, "hellogo", ActionInPlace, "")
+
+		opts.PVCOptions.RetentionPolicy = RetentionPolicyDelete
+		plan, _ = BuildPlan(clientset, ctx, opts)
+		assertChange(t, plan, KindPVC, "hellogo", ActionBlocked, "")
+
+		opts.ConfirmDataLoss = true
+		plan, _ = BuildPlan(clientset, ctx, opts)
+		assertChange(t, plan, KindPVC, "hellogo", ActionDelete, "")
+	})
+}
@@ -0,0 +1,58 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPod(name string, created time.Time, ready bool) *corev1.Pod {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         testNamespace,
+			Labels:            map[string]string{"name": "hellogo"},
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{Name: "hellogo", Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}}},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase:      corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestSelectReadyPod(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	selector := map[string]string{"name": "hellogo"}
+
+	clientset := fake.NewSimpleClientset(
+		newTestPod("hellogo-old", now.Add(-time.Hour), true),
+		newTestPod("hellogo-new", now, true),
+		newTestPod("hellogo-starting", now.Add(time.Minute), false),
+	)
+	pod, err := SelectReadyPod(clientset, ctx, selector, testNamespace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.Name != "hellogo-new" {
+		t.Errorf("expected the newest ready pod hellogo-new, got %s", pod.Name)
+	}
+
+	clientset = fake.NewSimpleClientset(newTestPod("hellogo-starting", now, false))
+	_, err = SelectReadyPod(clientset, ctx, selector, testNamespace)
+	assertErrorContains(t, err, "no ready pod matches name=hellogo")
+}
@@ -0,0 +1,227 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForwardOptions 用于将本地端口转发到应用
+type PortForwardOptions struct {
+	Name      string
+	Namespace string
+	// Ports 为 LOCAL:REMOTE 形式的端口映射，只写一个端口时本地端口与远端端口相同
+	Ports []string
+	// Pod 为 true 时 REMOTE 为 Pod 的容器端口，否则为应用 Service 的端口
+	Pod bool
+}
+
+type portMapping struct {
+	Local  int32
+	Remote int32
+}
+
+// PortForward 将本地端口转发到应用的一个就绪 Pod，转发到 Service 时与 kubectl 相同，按 Service 的 targetPort 转发到其选中的 Pod。
+// 转发中的 Pod 被删除或不再就绪时重新选择 Pod，直至 ctx 结束
+func PortForward(config *rest.Config, clientset kubernetes.Interface, ctx context.Context, opts PortForwardOptions, logHandler func(msg string)) error {
+	mappings, err := parsePortMappings(opts.Ports)
+	if err != nil {
+		return err
+	}
+
+	selector := map[string]string{"name": opts.Name}
+	var service *corev1.Service
+	if !opts.Pod {
+		service, err = clientset.CoreV1().Services(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("service %s not found in namespace %s, forward to a pod port instead", opts.Name, opts.Namespace)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get service %s: %v", opts.Name, err)
+		}
+		if len(service.Spec.Selector) == 0 {
+			return fmt.Errorf("service %s has no selector to forward to", opts.Name)
+		}
+		selector = service.Spec.Selector
+	}
+
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return fmt.Errorf("failed to create spdy round tripper: %v", err)
+	}
+
+	for first := true; ; first = false {
+		pod, err := SelectReadyPod(clientset, ctx, selector, opts.Namespace)
+		if err != nil {
+			if first {
+				return err
+			}
+			logHandler(fmt.Sprintf("waiting for a ready pod: %v", err))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(2 * time.Second):
+			}
+			continue
+		}
+
+		ports, err := podPorts(service, pod, mappings)
+		if err != nil {
+			return err
+		}
+		logHandler(fmt.Sprintf("forwarding to pod %s", pod.Name))
+
+		err = forwardToPod(clientset, ctx, transport, upgrader, pod, ports, logHandler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && !errors.Is(err, portforward.ErrLostConnectionToPod) {
+			return fmt.Errorf("failed to forward to pod %s: %v", pod.Name, err)
+		}
+		logHandler(fmt.Sprintf("lost pod %s, selecting another pod", pod.Name))
+	}
+}
+
+// forwardToPod 转发端口直至 Pod 消失、连接断开或 ctx 结束
+func forwardToPod(clientset kubernetes.Interface, ctx context.Context, transport http.RoundTripper, upgrader spdy.Upgrader, pod *corev1.Pod, ports []string, logHandler func(msg string)) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(pod.Namespace).
+		SubResource("portforward")
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	stopChan := make(chan struct{})
+	var once sync.Once
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		waitForPodLost(clientset, watchCtx, pod)
+		once.Do(func() { close(stopChan) })
+	}()
+
+	out := logWriter(logHandler)
+	forwarder, err := portforward.New(dialer, ports, stopChan, nil, out, out)
+	if err != nil {
+		return err
+	}
+	return forwarder.ForwardPorts()
+}
+
+// waitForPodLost 轮询 Pod 直至其被删除、被替换或不再就绪，或 ctx 结束
+func waitForPodLost(clientset kubernetes.Interface, ctx context.Context, pod *corev1.Pod) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+
+		live, err := clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return
+		}
+		// 其他错误可能是暂时的，继续转发
+		if err == nil && (live.UID != pod.UID || !isPodReady(live)) {
+			return
+		}
+	}
+}
+
+// parsePortMappings 解析 LOCAL:REMOTE 形式的端口映射
+func parsePortMappings(ports []string) ([]portMapping, error) {
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("at least one port is required")
+	}
+
+	var mappings []portMapping
+	for _, port := range ports {
+		parts := strings.Split(port, ":")
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("invalid port mapping '%s', expected LOCAL:REMOTE", port)
+		}
+		local, err := parsePort(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid port mapping '%s': %v", port, err)
+		}
+		remote := local
+		if len(parts) == 2 {
+			if remote, err = parsePort(parts[1]); err != nil {
+				return nil, fmt.Errorf("invalid port mapping '%s': %v", port, err)
+			}
+		}
+		mappings = append(mappings, portMapping{Local: local, Remote: remote})
+	}
+	return mappings, nil
+}
+
+func parsePort(port string) (int32, error) {
+	value, err := strconv.ParseInt(port, 10, 32)
+	if err != nil || value < 1 || value > 65535 {
+		return 0, fmt.Errorf("port must be between 1 and 65535, got '%s'", port)
+	}
+	return int32(value), nil
+}
+
+// podPorts 将端口映射转换为 Pod 的端口，转发到 Service 时远端端口按 Service 的 targetPort 转换
+func podPorts(service *corev1.Service, pod *corev1.Pod, mappings []portMapping) ([]string, error) {
+	var ports []string
+	for _, mapping := range mappings {
+		remote := mapping.Remote
+		if service != nil {
+			var err error
+			if remote, err = serviceTargetPort(service, pod, remote); err != nil {
+				return nil, err
+			}
+		}
+		ports = append(ports, fmt.Sprintf("%d:%d", mapping.Local, remote))
+	}
+	return ports, nil
+}
+
+// serviceTargetPort 返回 Service 端口在 Pod 上对应的容器端口，具名的 targetPort 按 Pod 的容器端口名查找
+func serviceTargetPort(service *corev1.Service, pod *corev1.Pod, port int32) (int32, error) {
+	for _, servicePort := range service.Spec.Ports {
+		if servicePort.Port != port {
+			continue
+		}
+		targetPort := servicePort.TargetPort
+		if targetPort.Type == intstr.Int {
+			if targetPort.IntVal == 0 {
+				return port, nil
+			}
+			return targetPort.IntVal, nil
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if containerPort.Name == targetPort.StrVal {
+					return containerPort.ContainerPort, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("pod %s has no port named %s targeted by service %s", pod.Name, targetPort.StrVal, service.Name)
+	}
+	return 0, fmt.Errorf("service %s has no port %d", service.Name, port)
+}
+
+// logWriter 将端口转发的输出转给 logHandler
+type logWriter func(msg string)
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,76 @@
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+)
+
+func TestParsePortMappings(t *testing.T) {
+	mappings, err := parsePortMappings([]string{"8080:80", "9090"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []portMapping{{Local: 8080, Remote: 80}, {Local: 9090, Remote: 9090}}
+	if !reflect.DeepEqual(mappings, expected) {
+		t.Errorf("expected %v, got %v", expected, mappings)
+	}
+
+	for _, ports := range [][]string{nil, {"8080:80:70"}, {"http:80"}, {"8080:0"}, {"70000"}} {
+		if _, err := parsePortMappings(ports); err == nil {
+			t.Errorf("expected an error for ports %v", ports)
+		}
+	}
+}
+
+func TestPodPorts(t *testing.T) {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{
+				{Name: "app", Port: 80, TargetPort: intstr.FromInt32(8000)},
+				{Name: "metrics", Port: 9090, TargetPort: intstr.FromString("metrics")},
+				{Name: "admin", Port: 7000, TargetPort: intstr.FromString("admin")},
+			},
+		},
+	}
+	pod := newTestPod("hellogo-1", time.Now(), true)
+
+	ports, err := podPorts(service, pod, []portMapping{{Local: 8080, Remote: 80}, {Local: 9091, Remote: 9090}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ports, []string{"8080:8000", "9091:9090"}) {
+		t.Errorf("expected ports mapped to the target ports, got %v", ports)
+	}
+
+	ports, err = podPorts(nil, pod, []portMapping{{Local: 8080, Remote: 80}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ports, []string{"8080:80"}) {
+		t.Errorf("expected pod ports unchanged, got %v", ports)
+	}
+
+	_, err = podPorts(service, pod, []portMapping{{Local: 7000, Remote: 7000}})
+	assertErrorContains(t, err, "pod hellogo-1 has no port named admin")
+	_, err = podPorts(service, pod, []portMapping{{Local: 443, Remote: 443}})
+	assertErrorContains(t, err, "service hellogo has no port 443")
+}
+
+func TestPortForwardWithoutService(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	err := PortForward(&rest.Config{}, clientset, context.Background(), PortForwardOptions{
+		Name:      "hellogo",
+		Namespace: testNamespace,
+		Ports:     []string{"8080:80"},
+	}, func(string) {})
+	assertErrorContains(t, err, "service hellogo not found in namespace hello")
+}
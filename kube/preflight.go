@@ -0,0 +1,491 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+const defaultStorageClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+
+const metricsGroupVersion = "metrics.k8s.io/v1beta1"
+
+// Finding 为预检发现的一个问题及其修复方法
+type Finding struct {
+	Check    string
+	Severity string
+	Message  string
+	Fix      string
+}
+
+func (finding Finding) String() string {
+	return fmt.Sprintf("[%s] %s: %s\n    fix: %s", finding.Severity, finding.Check, finding.Message, finding.Fix)
+}
+
+// PreflightOptions 描述发布需要的集群依赖
+type PreflightOptions struct {
+	Name      string
+	Namespace string
+	Workload  string
+	Ingress   bool
+	HPA       bool
+	// StorageClassNames 为需要创建的 PVC 所用的存储类，空字符串表示集群默认的存储类
+	StorageClassNames []string
+	Jobs              bool
+	ResourceQuota     bool
+	LimitRange        bool
+	Snapshot          bool
+	// Route 为 Gateway 路由类型(http 或 grpc)，为空时使用 Ingress
+	Route string
+	// Monitor 为需要创建的 servicemonitor 或 podmonitor，为空时不检查 prometheus-operator
+	Monitor string
+
+	// IngressController 为 Ingress 控制器，决定检查的 IngressClass
+	IngressController string
+	// Prune 为 true 时发布后清理不再发布的资源，需要列出并删除应用的各类资源
+	Prune bool
+	// Canary 为 true 时以金丝雀发布，推广或回滚后删除金丝雀的资源
+	Canary bool
+	// Migrate 为 true 时应用 PVC 可能需要迁移，迁移期间缩放 Deployment
+	Migrate bool
+}
+
+// permission 为发布需要的一项 RBAC 权限，namespaced 为 false 时为集群级资源
+type permission struct {
+	verbs      []string
+	group      string
+	resource   string
+	namespaced bool
+}
+
+// Preflight 在发布前检查集群依赖、RBAC 权限以及名称是否合法
+func Preflight(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	findings := checkNames(opts)
+
+	checks := []func(kubernetes.Interface, context.Context, PreflightOptions) ([]Finding, error){
+		checkIngressClass,
+		checkGatewayAPI,
+		checkStorageClasses,
+		checkMetricsServer,
+		checkPrometheusOperator,
+		checkPermissions,
+	}
+	for _, check := range checks {
+		results, err := check(clientset, ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, results...)
+	}
+
+	return findings, nil
+}
+
+// PrintFindings 输出预检结果
+func PrintFindings(findings []Finding, logHandler func(msg string)) {
+	if len(findings) == 0 {
+		logHandler("preflight: all checks passed")
+		return
+	}
+	logHandler("preflight:")
+	for _, finding := range findings {
+		logHandler("  " + finding.String())
+	}
+}
+
+// PreflightFailed 存在 error 级别的问题时返回错误
+func PreflightFailed(findings []Finding) error {
+	var checks []string
+	for _, finding := range findings {
+		if finding.Severity == SeverityError {
+			checks = append(checks, finding.Check)
+		}
+	}
+	if len(checks) == 0 {
+		return nil
+	}
+	return fmt.Errorf("preflight failed: %s", strings.Join(checks, ", "))
+}
+
+func checkNames(opts PreflightOptions) []Finding {
+	var findings []Finding
+	for _, name := range []struct {
+		field string
+		value string
+		fix   string
+	}{
+		{"appname", opts.Name, "set --default.appname to a lowercase name such as my-app"},
+		{"namespace", opts.Namespace, "set --kube.namespace to a lowercase name such as my-app"},
+	} {
+		if errs := validation.IsDNS1123Label(name.value); len(errs) > 0 {
+			findings = append(findings, Finding{
+				Check:    name.field,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("'%s' is not a valid DNS-1123 label: %s", name.value, strings.Join(errs, ", ")),
+				Fix:      name.fix + ", at most 63 characters of a-z, 0-9 and '-', starting and ending with an alphanumeric character",
+			})
+		}
+	}
+	return findings
+}
+
+func checkIngressClass(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	if !opts.Ingress {
+		return nil, nil
+	}
+
+	ingressClass := IngressClass(opts.IngressController)
+	controller, install := "ingress-nginx", "helm upgrade --install ingress-nginx ingress-nginx --repo https://kubernetes.github.io/ingress-nginx --namespace ingress-nginx --create-namespace"
+	if opts.IngressController == IngressControllerTraefik {
+		controller, install = "traefik", "helm upgrade --install traefik traefik --repo https://traefik.github.io/charts --namespace traefik --create-namespace"
+	}
+
+	_, err := clientset.NetworkingV1().IngressClasses().Get(ctx, ingressClass, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return []Finding{{
+			Check:    "ingressclass",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("ingressclass %s not found, the ingress would never get an address", ingressClass),
+			Fix:      fmt.Sprintf("install %s: %s", controller, install),
+		}}, nil
+	}
+	if apierrors.IsForbidden(err) {
+		return []Finding{{
+			Check:    "ingressclass",
+			Severity: SeverityWarning,
+			Message:  fmt.Sprintf("not allowed to get ingressclass %s, skipped", ingressClass),
+			Fix:      fmt.Sprintf("grant get on ingressclasses.networking.k8s.io, or make sure %s is installed", controller),
+		}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ingressclass %s: %v", ingressClass, err)
+	}
+	return nil, nil
+}
+
+func checkGatewayAPI(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	if opts.Route == "" {
+		return nil, nil
+	}
+
+	resource := RouteGVR(opts.Route).Resource
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(gatewayGroupVersion)
+	if err == nil {
+		for _, apiResource := range resources.APIResources {
+			if apiResource.Name == resource {
+				return nil, nil
+			}
+		}
+		err = fmt.Errorf("%s not found", resource)
+	}
+	return []Finding{{
+		Check:    "gateway-api",
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("%s of %s is not served (%v), the route could not be created", resource, gatewayGroupVersion, err),
+		Fix:      "install the gateway api crds: kubectl apply -f https://github.com/kubernetes-sigs/gateway-api/releases/latest/download/standard-install.yaml, along with a gateway implementation, or set --kube.routing=ingress",
+	}}, nil
+}
+
+func checkStorageClasses(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	var findings []Finding
+	checked := make(map[string]bool)
+	for _, name := range opts.StorageClassNames {
+		if checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		if name == "" {
+			finding, err := checkDefaultStorageClass(clientset, ctx)
+			if err != nil {
+				return nil, err
+			}
+			if finding != nil {
+				findings = append(findings, *finding)
+			}
+			continue
+		}
+
+		_, err := clientset.StorageV1().StorageClasses().Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			findings = append(findings, Finding{
+				Check:    "storageclass",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("storageclass %s not found, pvcs would stay pending", name),
+				Fix:      fmt.Sprintf("install the provisioner of %s (for openebs-hostpath: helm upgrade --install openebs openebs --repo https://openebs.github.io/openebs --namespace openebs --create-namespace), or set --kube.pvc.storageclassname to one listed by kubectl get storageclass", name),
+			})
+			continue
+		}
+		if apierrors.IsForbidden(err) {
+			findings = append(findings, Finding{
+				Check:    "storageclass",
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("not allowed to get storageclass %s, skipped", name),
+				Fix:      "grant get on storageclasses.storage.k8s.io, or make sure the storage class exists",
+			})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get storageclass %s: %v", name, err)
+		}
+	}
+	return findings, nil
+}
+
+func checkDefaultStorageClass(clientset kubernetes.Interface, ctx context.Context) (*Finding, error) {
+	storageClasses, err := clientset.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if apierrors.IsForbidden(err) {
+		return &Finding{
+			Check:    "storageclass",
+			Severity: SeverityWarning,
+			Message:  "not allowed to list storageclasses, default storage class not checked",
+			Fix:      "grant list on storageclasses.storage.k8s.io, or make sure a default storage class exists",
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list storageclasses: %v", err)
+	}
+	for _, storageClass := range storageClasses.Items {
+		if storageClass.Annotations[defaultStorageClassAnnotation] == "true" {
+			return nil, nil
+		}
+	}
+	return &Finding{
+		Check:    "storageclass",
+		Severity: SeverityError,
+		Message:  "no storage class is set and the cluster has no default storage class, pvcs would stay pending",
+		Fix:      fmt.Sprintf("set a storage class name, or mark one as default: kubectl patch storageclass <name> -p '{\"metadata\":{\"annotations\":{\"%s\":\"true\"}}}'", defaultStorageClassAnnotation),
+	}, nil
+}
+
+func checkMetricsServer(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	if !opts.HPA {
+		return nil, nil
+	}
+
+	if _, err := clientset.Discovery().ServerResourcesForGroupVersion(metricsGroupVersion); err != nil {
+		return []Finding{{
+			Check:    "metrics-server",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("%s is not served (%v), the hpa could not read cpu usage", metricsGroupVersion, err),
+			Fix:      "install metrics-server: kubectl apply -f https://github.com/kubernetes-sigs/metrics-server/releases/latest/download/components.yaml, or disable the hpa with --kube.hpa.enabled=false",
+		}}, nil
+	}
+	return nil, nil
+}
+
+func checkPrometheusOperator(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	if opts.Monitor == "" {
+		return nil, nil
+	}
+
+	resource := MonitorGVR(opts.Monitor).Resource
+	resources, err := clientset.Discovery().ServerResourcesForGroupVersion(monitoringGroupVersion)
+	if err == nil {
+		for _, apiResource := range resources.APIResources {
+			if apiResource.Name == resource {
+				return nil, nil
+			}
+		}
+		err = fmt.Errorf("%s not found", resource)
+	}
+	return []Finding{{
+		Check:    "prometheus-operator",
+		Severity: SeverityError,
+		Message:  fmt.Sprintf("%s of %s is not served (%v), the app would not be scraped", resource, monitoringGroupVersion, err),
+		Fix:      "install prometheus-operator: helm upgrade --install kube-prometheus-stack kube-prometheus-stack --repo https://prometheus-community.github.io/helm-charts --namespace monitoring --create-namespace, or leave --kube.metrics.monitor empty to rely on the prometheus.io annotations",
+	}}, nil
+}
+
+// permissionSet 按资源合并发布过程中用到的 verb，保持资源首次出现的顺序
+type permissionSet struct {
+	permissions []permission
+}
+
+func (set *permissionSet) add(group, resource string, namespaced bool, verbs ...string) {
+	for i := range set.permissions {
+		p := &set.permissions[i]
+		if p.group == group && p.resource == resource {
+			for _, verb := range verbs {
+				if !helpers.Contains(p.verbs, verb) {
+					p.verbs = append(p.verbs, verb)
+				}
+			}
+			return
+		}
+	}
+	set.permissions = append(set.permissions, permission{verbs, group, resource, namespaced})
+}
+
+// requiredPermissions 列出发布过程中会调用的 API，verb 与实际的调用一致：
+// 创建或更新都先 create，已存在时 get 后 update，关闭的组件以及清理、重建时 delete
+func requiredPermissions(opts PreflightOptions) []permission {
+	set := &permissionSet{}
+	set.add("", "namespaces", false, "get", "create", "update")
+	// 拉取凭证在类型变化或改用公开镜像时删除
+	set.add("", "secrets", true, "get", "create", "update", "delete")
+	set.add("", "serviceaccounts", true, "get", "create", "update")
+	set.add("", "services", true, "get", "create", "update")
+	set.add("", "pods", true, "list")
+
+	for _, workload := range []struct {
+		name     string
+		resource string
+	}{
+		{WorkloadDeployment, "deployments"},
+		{WorkloadStatefulSet, "statefulsets"},
+		{WorkloadDaemonSet, "daemonsets"},
+	} {
+		// 其他类型的工作负载只需读取与删除，用于切换工作负载类型；当前工作负载在不可变字段变化时删除重建
+		if workload.name == opts.Workload {
+			set.add("apps", workload.resource, true, "get", "create", "update", "delete")
+		} else {
+			set.add("apps", workload.resource, true, "get", "delete")
+		}
+	}
+	if opts.Migrate {
+		// 迁移 PVC 前将 Deployment 缩容到 0，结束后恢复
+		set.add("apps", "deployments/scale", true, "get", "update")
+	}
+
+	set.add("", "persistentvolumeclaims", true, "get", "create", "update", "delete")
+	if opts.Ingress {
+		set.add("networking.k8s.io", "ingresses", true, "get", "create", "update")
+		if opts.IngressController == IngressControllerTraefik {
+			set.add(middlewareGVR.Group, middlewareGVR.Resource, true, "get", "create", "update", "delete")
+		}
+	}
+	if opts.Route != "" {
+		gvr := RouteGVR(opts.Route)
+		set.add(gvr.Group, gvr.Resource, true, "get", "create", "update")
+		// 改用 Gateway 路由后删除遗留的 Ingress
+		set.add("networking.k8s.io", "ingresses", true, "delete")
+	}
+	if opts.Canary {
+		// 金丝雀的 Service 与 nginx 的金丝雀 Ingress 在推广或回滚后删除
+		set.add("", "services", true, "delete")
+		if opts.Route == "" {
+			set.add("networking.k8s.io", "ingresses", true, "get", "create", "update", "delete")
+		}
+	}
+	set.add("autoscaling", "horizontalpodautoscalers", true, "get", "create", "update", "delete")
+	if opts.Jobs {
+		set.add("batch", "jobs", true, "create", "get")
+		set.add("", "pods/log", true, "get")
+	}
+	// 关闭的 ResourceQuota 与 LimitRange 会被删除
+	if opts.ResourceQuota {
+		set.add("", "resourcequotas", true, "create", "get", "update")
+	}
+	set.add("", "resourcequotas", true, "delete")
+	if opts.LimitRange {
+		set.add("", "limitranges", true, "create", "get", "update")
+	}
+	set.add("", "limitranges", true, "delete")
+	if opts.Monitor != "" {
+		gvr := MonitorGVR(opts.Monitor)
+		set.add(gvr.Group, gvr.Resource, true, "get", "create", "update")
+	}
+	if opts.Snapshot {
+		set.add(volumeSnapshotGVR.Group, volumeSnapshotGVR.Resource, true, "create", "get")
+	}
+	if opts.Prune {
+		for _, resource := range []struct {
+			group    string
+			resource string
+		}{
+			{"networking.k8s.io", "ingresses"},
+			{"autoscaling", "horizontalpodautoscalers"},
+			{"", "services"},
+			{"apps", "deployments"},
+			{"apps", "statefulsets"},
+			{"apps", "daemonsets"},
+			{"", "serviceaccounts"},
+			{"", "secrets"},
+			{"", "resourcequotas"},
+			{"", "limitranges"},
+		} {
+			set.add(resource.group, resource.resource, true, "list", "delete")
+		}
+	}
+	return set.permissions
+}
+
+// checkPermissions 以 SelfSubjectAccessReview 逐项检查当前凭证的 RBAC 权限
+func checkPermissions(clientset kubernetes.Interface, ctx context.Context, opts PreflightOptions) ([]Finding, error) {
+	var findings []Finding
+	for _, permission := range requiredPermissions(opts) {
+		resource, subresource, _ := strings.Cut(permission.resource, "/")
+		for _, verb := range permission.verbs {
+			attributes := &authorizationv1.ResourceAttributes{
+				Verb:        verb,
+				Group:       permission.group,
+				Resource:    resource,
+				Subresource: subresource,
+			}
+			if permission.namespaced {
+				attributes.Namespace = opts.Namespace
+			}
+
+			review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: attributes,
+				},
+			}, metav1.CreateOptions{})
+			if err != nil {
+				return nil, fmt.Errorf("failed to review access to %s %s: %v", verb, permission.resource, err)
+			}
+			if review.Status.Allowed {
+				continue
+			}
+
+			findings = append(findings, Finding{
+				Check:    "rbac",
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("not allowed to %s %s%s", verb, qualifiedResource(permission), scopeOf(permission, opts.Namespace)),
+				Fix:      fixPermission(verb, permission, opts.Namespace),
+			})
+		}
+	}
+	return findings, nil
+}
+
+func qualifiedResource(permission permission) string {
+	if permission.group == "" {
+		return permission.resource
+	}
+	resource, subresource, found := strings.Cut(permission.resource, "/")
+	if found {
+		return fmt.Sprintf("%s.%s/%s", resource, permission.group, subresource)
+	}
+	return fmt.Sprintf("%s.%s", resource, permission.group)
+}
+
+func scopeOf(permission permission, namespace string) string {
+	if permission.namespaced {
+		return " in namespace " + namespace
+	}
+	return " at cluster scope"
+}
+
+func fixPermission(verb string, permission permission, namespace string) string {
+	role := fmt.Sprintf("appdeployer-%s-%s", strings.ReplaceAll(permission.resource, "/", "-"), verb)
+	if permission.namespaced {
+		return fmt.Sprintf("kubectl create role %s --verb=%s --resource=%s -n %s && kubectl create rolebinding %s --role=%s --user=<user> -n %s",
+			role, verb, qualifiedResource(permission), namespace, role, role, namespace)
+	}
+	return fmt.Sprintf("kubectl create clusterrole %s --verb=%s --resource=%s && kubectl create clusterrolebinding %s --clusterrole=%s --user=<user>",
+		role, verb, qualifiedResource(permission), role, role)
+}
@@ -0,0 +1,279 @@
+package kube
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// allowAccess 使 SelfSubjectAccessReview 只拒绝 denied 中列出的 verb resource
+func allowAccess(clientset *fake.Clientset, denied ...string) {
+	clientset.PrependReactor("create", "selfsubjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SelfSubjectAccessReview)
+		attributes := review.Spec.ResourceAttributes
+		resource := attributes.Resource
+		if attributes.Subresource != "" {
+			resource += "/" + attributes.Subresource
+		}
+		review.Status.Allowed = true
+		for _, d := range denied {
+			if d == attributes.Verb+" "+resource {
+				review.Status.Allowed = false
+			}
+		}
+		return true, review, nil
+	})
+}
+
+func newTestPreflightOptions() PreflightOptions {
+	return PreflightOptions{
+		Name:              "hellogo",
+		Namespace:         testNamespace,
+		Workload:          WorkloadDeployment,
+		Ingress:           true,
+		HPA:               true,
+		StorageClassNames: []string{"openebs-hostpath"},
+	}
+}
+
+func newReadyClientset() *fake.Clientset {
+	clientset := fake.NewSimpleClientset(
+		&networkingv1.IngressClass{ObjectMeta: metav1.ObjectMeta{Name: IngressClassName}},
+		&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "openebs-hostpath"}},
+	)
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = []*metav1.APIResourceList{
+		{GroupVersion: metricsGroupVersion},
+	}
+	return clientset
+}
+
+func findingOf(findings []Finding, check string) *Finding {
+	for _, finding := range findings {
+		if finding.Check == check {
+			return &finding
+		}
+	}
+	return nil
+}
+
+func TestPreflightPassed(t *testing.T) {
+	clientset := newReadyClientset()
+	allowAccess(clientset)
+	findings, err := Preflight(clientset, context.Background(), newTestPreflightOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no finding, got %v", findings)
+	}
+	if err := PreflightFailed(findings); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPreflightMissingDependencies(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	allowAccess(clientset)
+	findings, err := Preflight(clientset, context.Background(), newTestPreflightOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, check := range []string{"ingressclass", "storageclass", "metrics-server"} {
+		finding := findingOf(findings, check)
+		if finding == nil {
+			t.Errorf("expected a %s finding, got %v", check, findings)
+			continue
+		}
+		if finding.Severity != SeverityError || finding.Fix == "" {
+			t.Errorf("expected an error with a fix, got %v", finding)
+		}
+	}
+	assertErrorContains(t, PreflightFailed(findings), "ingressclass")
+}
+
+func TestPreflightGatewayAPI(t *testing.T) {
+	opts := newTestPreflightOptions()
+	opts.Ingress = false
+	opts.Route = RouteKindGRPC
+
+	clientset := newReadyClientset()
+	allowAccess(clientset, "create grpcroutes")
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = append(clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources, &metav1.APIResourceList{
+		GroupVersion: gatewayGroupVersion,
+		APIResources: []metav1.APIResource{{Name: "httproutes"}},
+	})
+	findings, err := Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finding := findingOf(findings, "gateway-api"); finding == nil || !strings.Contains(finding.Message, "grpcroutes") {
+		t.Errorf("expected a gateway-api finding of grpcroutes, got %v", findings)
+	}
+	if finding := findingOf(findings, "rbac"); finding == nil || !strings.Contains(finding.Message, "create grpcroutes.gateway.networking.k8s.io") {
+		t.Errorf("expected a rbac finding of grpcroutes, got %v", findings)
+	}
+	if findingOf(findings, "ingressclass") != nil {
+		t.Errorf("expected the ingress class not to be checked, got %v", findings)
+	}
+}
+
+func TestPreflightPrometheusOperator(t *testing.T) {
+	opts := newTestPreflightOptions()
+	opts.Monitor = MonitorPodMonitor
+
+	clientset := newReadyClientset()
+	allowAccess(clientset)
+	findings, err := Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finding := findingOf(findings, "prometheus-operator"); finding == nil || !strings.Contains(finding.Message, "podmonitors") {
+		t.Errorf("expected a prometheus-operator finding of podmonitors, got %v", findings)
+	}
+
+	clientset = newReadyClientset()
+	allowAccess(clientset)
+	clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources = append(clientset.Discovery().(*fakediscovery.FakeDiscovery).Resources, &metav1.APIResourceList{
+		GroupVersion: monitoringGroupVersion,
+		APIResources: []metav1.APIResource{{Name: "servicemonitors"}, {Name: "podmonitors"}},
+	})
+	findings, err = Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no finding, got %v", findings)
+	}
+}
+
+func TestPreflightDefaultStorageClass(t *testing.T) {
+	opts := newTestPreflightOptions()
+	opts.StorageClassNames = []string{""}
+
+	clientset := newReadyClientset()
+	allowAccess(clientset)
+	findings, err := Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findingOf(findings, "storageclass") == nil {
+		t.Errorf("expected a storageclass finding without a default storage class, got %v", findings)
+	}
+
+	clientset = newReadyClientset()
+	allowAccess(clientset)
+	clientset.StorageV1().StorageClasses().Create(context.Background(), &storagev1.StorageClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "standard",
+			Annotations: map[string]string{defaultStorageClassAnnotation: "true"},
+		},
+	}, metav1.CreateOptions{})
+	findings, err = Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("expected no finding with a default storage class, got %v", findings)
+	}
+}
+
+func TestPreflightPermissions(t *testing.T) {
+	opts := newTestPreflightOptions()
+	opts.Jobs = true
+
+	clientset := newReadyClientset()
+	allowAccess(clientset, "create namespaces", "update deployments", "get pods/log")
+	findings, err := Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	for _, finding := range findings {
+		if finding.Check != "rbac" {
+			t.Errorf("unexpected finding %v", finding)
+		}
+		messages = append(messages, finding.Message)
+	}
+	expected := []string{
+		"not allowed to create namespaces at cluster scope",
+		"not allowed to update deployments.apps in namespace " + testNamespace,
+		"not allowed to get pods/log in namespace " + testNamespace,
+	}
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected findings %q, got %q", expected, messages)
+	}
+	if !strings.Contains(findings[1].Fix, "--verb=update --resource=deployments.apps -n "+testNamespace) {
+		t.Errorf("unexpected fix %s", findings[1].Fix)
+	}
+}
+
+func TestRequiredPermissionsFollowCalls(t *testing.T) {
+	verbsOf := func(permissions []permission, resource string) []string {
+		for _, permission := range permissions {
+			if permission.resource == resource {
+				return permission.verbs
+			}
+		}
+		return nil
+	}
+
+	opts := newTestPreflightOptions()
+	permissions := requiredPermissions(opts)
+	for resource, expected := range map[string]string{
+		"namespaces":      "get create update",
+		"secrets":         "get create update delete",
+		"serviceaccounts": "get create update",
+		"services":        "get create update",
+		"ingresses":       "get create update",
+		"resourcequotas":  "delete",
+	} {
+		if verbs := strings.Join(verbsOf(permissions, resource), " "); verbs != expected {
+			t.Errorf("expected verbs '%s' of %s, got '%s'", expected, resource, verbs)
+		}
+	}
+	if verbsOf(permissions, "deployments/scale") != nil {
+		t.Error("expected no scale permission without pvc migration")
+	}
+
+	opts.Canary = true
+	opts.Migrate = true
+	opts.Prune = true
+	permissions = requiredPermissions(opts)
+	for resource, expected := range map[string]string{
+		"services":          "get create update delete list",
+		"serviceaccounts":   "get create update list delete",
+		"ingresses":         "get create update delete list",
+		"deployments/scale": "get update",
+	} {
+		if verbs := strings.Join(verbsOf(permissions, resource), " "); verbs != expected {
+			t.Errorf("expected verbs '%s' of %s, got '%s'", expected, resource, verbs)
+		}
+	}
+}
+
+func TestPreflightNames(t *testing.T) {
+	opts := newTestPreflightOptions()
+	opts.Name = "Hello_Go"
+	opts.Namespace = strings.Repeat("a", 64)
+
+	clientset := newReadyClientset()
+	allowAccess(clientset)
+	findings, err := Preflight(clientset, context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findingOf(findings, "appname") == nil || findingOf(findings, "namespace") == nil {
+		t.Errorf("expected appname and namespace findings, got %v", findings)
+	}
+}
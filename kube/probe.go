@@ -10,9 +10,11 @@ type Probe interface {
 }
 
 type HttpGetProbe struct {
-	Path   string
-	Port   intstr.IntOrString
-	Scheme corev1.URIScheme
+	Path        string
+	Port        intstr.IntOrString
+	Host        string
+	Scheme      corev1.URIScheme
+	HTTPHeaders []corev1.HTTPHeader
 	ProbeParams
 }
 
@@ -20,21 +22,25 @@ func (probe HttpGetProbe) GetProbe() *corev1.Probe {
 	return &corev1.Probe{
 		ProbeHandler: corev1.ProbeHandler{
 			HTTPGet: &corev1.HTTPGetAction{
-				Path:   probe.Path,
-				Port:   probe.Port,
-				Scheme: probe.Scheme,
+				Path:        probe.Path,
+				Port:        probe.Port,
+				Host:        probe.Host,
+				Scheme:      probe.Scheme,
+				HTTPHeaders: probe.HTTPHeaders,
 			},
 		},
-		InitialDelaySeconds: probe.InitialDelaySeconds,
-		TimeoutSeconds:      probe.TimeoutSeconds,
-		PeriodSeconds:       probe.PeriodSeconds,
-		SuccessThreshold:    probe.SuccessThreshold,
-		FailureThreshold:    probe.FailureThreshold,
+		InitialDelaySeconds:           probe.InitialDelaySeconds,
+		TimeoutSeconds:                probe.TimeoutSeconds,
+		PeriodSeconds:                 probe.PeriodSeconds,
+		SuccessThreshold:              probe.SuccessThreshold,
+		FailureThreshold:              probe.FailureThreshold,
+		TerminationGracePeriodSeconds: probe.terminationGracePeriodSeconds(),
 	}
 }
 
 type TCPSocketProbe struct {
 	Port intstr.IntOrString
+	Host string
 	ProbeParams
 }
 
@@ -43,13 +49,15 @@ func (probe TCPSocketProbe) GetProbe() *corev1.Probe {
 		ProbeHandler: corev1.ProbeHandler{
 			TCPSocket: &corev1.TCPSocketAction{
 				Port: probe.Port,
+				Host: probe.Host,
 			},
 		},
-		InitialDelaySeconds: probe.InitialDelaySeconds,
-		TimeoutSeconds:      probe.TimeoutSeconds,
-		PeriodSeconds:       probe.PeriodSeconds,
-		SuccessThreshold:    probe.SuccessThreshold,
-		FailureThreshold:    probe.FailureThreshold,
+		InitialDelaySeconds:           probe.InitialDelaySeconds,
+		TimeoutSeconds:                probe.TimeoutSeconds,
+		PeriodSeconds:                 probe.PeriodSeconds,
+		SuccessThreshold:              probe.SuccessThreshold,
+		FailureThreshold:              probe.FailureThreshold,
+		TerminationGracePeriodSeconds: probe.terminationGracePeriodSeconds(),
 	}
 }
 
@@ -69,10 +77,45 @@ func (probe ExecProbe) GetProbe() *corev1.Probe {
 				},
 			},
 		},
-		InitialDelaySeconds: probe.InitialDelaySeconds,
-		TimeoutSeconds:      probe.TimeoutSeconds,
-		PeriodSeconds:       probe.PeriodSeconds,
-		SuccessThreshold:    probe.SuccessThreshold,
-		FailureThreshold:    probe.FailureThreshold,
+		InitialDelaySeconds:           probe.InitialDelaySeconds,
+		TimeoutSeconds:                probe.TimeoutSeconds,
+		PeriodSeconds:                 probe.PeriodSeconds,
+		SuccessThreshold:              probe.SuccessThreshold,
+		FailureThreshold:              probe.FailureThreshold,
+		TerminationGracePeriodSeconds: probe.terminationGracePeriodSeconds(),
 	}
 }
+
+type GRPCProbe struct {
+	Port    int32
+	Service string
+	ProbeParams
+}
+
+func (probe GRPCProbe) GetProbe() *corev1.Probe {
+	grpc := &corev1.GRPCAction{
+		Port: probe.Port,
+	}
+	if probe.Service != "" {
+		grpc.Service = &probe.Service
+	}
+	return &corev1.Probe{
+		ProbeHandler: corev1.ProbeHandler{
+			GRPC: grpc,
+		},
+		InitialDelaySeconds:           probe.InitialDelaySeconds,
+		TimeoutSeconds:                probe.TimeoutSeconds,
+		PeriodSeconds:                 probe.PeriodSeconds,
+		SuccessThreshold:              probe.SuccessThreshold,
+		FailureThreshold:              probe.FailureThreshold,
+		TerminationGracePeriodSeconds: probe.terminationGracePeriodSeconds(),
+	}
+}
+
+func (params ProbeParams) terminationGracePeriodSeconds() *int64 {
+	if params.TerminationGracePeriodSeconds <= 0 {
+		return nil
+	}
+	seconds := params.TerminationGracePeriodSeconds
+	return &seconds
+}
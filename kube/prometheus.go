@@ -0,0 +1,103 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prometheusTimeout 为单次 Prometheus 查询的最长时间
+const prometheusTimeout = 30 * time.Second
+
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type prometheusSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+// QueryPrometheus 通过 Prometheus 的即时查询接口执行 PromQL，查询结果须为标量或只含一条序列的向量
+func QueryPrometheus(ctx context.Context, prometheusURL, query string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, prometheusTimeout)
+	defer cancel()
+
+	endpoint := strings.TrimSuffix(prometheusURL, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, fmt.Errorf("invalid prometheus url %s: %v", prometheusURL, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query prometheus: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read prometheus response: %v", err)
+	}
+	var result prometheusResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return 0, fmt.Errorf("failed to parse prometheus response with status %d: %v", resp.StatusCode, err)
+	}
+	if result.Status != "success" {
+		return 0, fmt.Errorf("prometheus query failed, %s: %s", result.ErrorType, result.Error)
+	}
+
+	switch result.Data.ResultType {
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(result.Data.Result, &value); err != nil {
+			return 0, fmt.Errorf("failed to parse prometheus scalar: %v", err)
+		}
+		return parsePrometheusValue(value)
+	case "vector":
+		var samples []prometheusSample
+		if err := json.Unmarshal(result.Data.Result, &samples); err != nil {
+			return 0, fmt.Errorf("failed to parse prometheus vector: %v", err)
+		}
+		if len(samples) == 0 {
+			return 0, fmt.Errorf("prometheus query returned no data")
+		}
+		if len(samples) > 1 {
+			return 0, fmt.Errorf("prometheus query returned %d series, aggregate them into one, e.g. with sum()", len(samples))
+		}
+		return parsePrometheusValue(samples[0].Value)
+	default:
+		return 0, fmt.Errorf("unsupported prometheus result type: %s", result.Data.ResultType)
+	}
+}
+
+// parsePrometheusValue 解析形如 [时间戳, "数值"] 的样本值，NaN 视为没有数据
+func parsePrometheusValue(value []interface{}) (float64, error) {
+	if len(value) != 2 {
+		return 0, fmt.Errorf("unexpected prometheus value: %v", value)
+	}
+	text, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected prometheus value: %v", value)
+	}
+	number, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected prometheus value %s: %v", text, err)
+	}
+	if math.IsNaN(number) {
+		return 0, fmt.Errorf("prometheus query returned NaN")
+	}
+	return number, nil
+}
@@ -0,0 +1,71 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestPrometheus 启动代替 Prometheus 的 HTTP 服务，按查询语句返回 result 函数给出的响应数据
+func newTestPrometheus(t *testing.T, result func(query string) string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, result(r.URL.Query().Get("query")))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func prometheusVector(values ...string) string {
+	samples := ""
+	for i, value := range values {
+		if i > 0 {
+			samples += ","
+		}
+		samples += fmt.Sprintf(`{"metric":{"pod":"hellogo-%d"},"value":[1700000000.0,"%s"]}`, i, value)
+	}
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"vector","result":[%s]}}`, samples)
+}
+
+func TestQueryPrometheus(t *testing.T) {
+	ctx := context.Background()
+	responses := map[string]string{
+		"vector": prometheusVector("0.25"),
+		"scalar": `{"status":"success","data":{"resultType":"scalar","result":[1700000000.0,"3"]}}`,
+	}
+	server := newTestPrometheus(t, func(query string) string { return responses[query] })
+
+	if value, err := QueryPrometheus(ctx, server.URL+"/", "vector"); err != nil || value != 0.25 {
+		t.Errorf("expected the vector to be 0.25, got %v, %v", value, err)
+	}
+	if value, err := QueryPrometheus(ctx, server.URL, "scalar"); err != nil || value != 3 {
+		t.Errorf("expected the scalar to be 3, got %v, %v", value, err)
+	}
+}
+
+func TestQueryPrometheusFailure(t *testing.T) {
+	ctx := context.Background()
+	responses := map[string]string{
+		"empty":  prometheusVector(),
+		"series": prometheusVector("1", "2"),
+		"nan":    prometheusVector("NaN"),
+		"bad":    `{"status":"error","errorType":"bad_data","error":"parse error"}`,
+	}
+	server := newTestPrometheus(t, func(query string) string { return responses[query] })
+
+	for query, expected := range map[string]string{
+		"empty":  "returned no data",
+		"series": "returned 2 series",
+		"nan":    "returned NaN",
+		"bad":    "prometheus query failed, bad_data: parse error",
+	} {
+		_, err := QueryPrometheus(ctx, server.URL, query)
+		assertErrorContains(t, err, expected)
+	}
+}
@@ -0,0 +1,148 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// pruneKinds 为发布后清理的资源，先删除对外暴露的资源再删除工作负载；PVC 保存数据，由保留策略单独处理
+var pruneKinds = []string{
+	KindIngress, "httproute", "grpcroute", KindMiddleware, "servicemonitor", "podmonitor",
+	KindHPA, KindService, WorkloadDeployment, WorkloadStatefulSet, WorkloadDaemonSet,
+	KindServiceAccount, KindSecret, KindResourceQuota, KindLimitRange,
+}
+
+// PruneOptions 列出一次发布后应用应保留的资源
+type PruneOptions struct {
+	App       string
+	Namespace string
+	Keep      []OwnedObject
+}
+
+// Prune 删除带有应用标签但已不在发布内容中的资源，如关闭 TLS 后遗留的证书 Secret，返回删除的资源
+func Prune(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts PruneOptions, logHandler func(msg string)) ([]OwnedObject, error) {
+	keep := make(map[OwnedObject]bool)
+	for _, object := range opts.Keep {
+		keep[object] = true
+	}
+	selector := labels.SelectorFromSet(ownerLabels(opts.App)).String()
+
+	var pruned []OwnedObject
+	for _, kind := range pruneKinds {
+		names, err := listOwned(clientset, dynamicClient, ctx, kind, opts.Namespace, selector)
+		if err != nil {
+			return pruned, err
+		}
+		for _, name := range names {
+			object := OwnedObject{Kind: kind, Name: name}
+			if keep[object] {
+				continue
+			}
+			if err := deleteOwned(clientset, dynamicClient, ctx, object, opts.Namespace); err != nil {
+				return pruned, err
+			}
+			logHandler(fmt.Sprintf("%s %s pruned as it is no longer deployed by app %s", kind, name, opts.App))
+			pruned = append(pruned, object)
+		}
+	}
+	return pruned, nil
+}
+
+// listOwned 返回命名空间下匹配标签的某类资源的名称，CRD 未安装时返回空
+func listOwned(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, kind, namespace, selector string) ([]string, error) {
+	listOptions := metav1.ListOptions{LabelSelector: selector}
+
+	var list runtime.Object
+	var err error
+	switch kind {
+	case WorkloadDeployment:
+		list, err = clientset.AppsV1().Deployments(namespace).List(ctx, listOptions)
+	case WorkloadStatefulSet:
+		list, err = clientset.AppsV1().StatefulSets(namespace).List(ctx, listOptions)
+	case WorkloadDaemonSet:
+		list, err = clientset.AppsV1().DaemonSets(namespace).List(ctx, listOptions)
+	case KindService:
+		list, err = clientset.CoreV1().Services(namespace).List(ctx, listOptions)
+	case KindIngress:
+		list, err = clientset.NetworkingV1().Ingresses(namespace).List(ctx, listOptions)
+	case KindHPA:
+		list, err = clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).List(ctx, listOptions)
+	case KindServiceAccount:
+		list, err = clientset.CoreV1().ServiceAccounts(namespace).List(ctx, listOptions)
+	case KindSecret:
+		list, err = clientset.CoreV1().Secrets(namespace).List(ctx, listOptions)
+	case KindResourceQuota:
+		list, err = clientset.CoreV1().ResourceQuotas(namespace).List(ctx, listOptions)
+	case KindLimitRange:
+		list, err = clientset.CoreV1().LimitRanges(namespace).List(ctx, listOptions)
+	default:
+		gvr, found := ownedGVRs[kind]
+		if !found {
+			return nil, fmt.Errorf("unsupported kind of owned object: '%s'", kind)
+		}
+		// 未安装或无权访问的 CRD 不会有该应用创建的资源
+		list, err = dynamicClient.Resource(gvr).Namespace(namespace).List(ctx, listOptions)
+		if apierrors.IsNotFound(err) || apierrors.IsForbidden(err) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s of namespace %s: %v", kind, namespace, err)
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s of namespace %s: %v", kind, namespace, err)
+	}
+	var names []string
+	for _, item := range items {
+		accessor, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, accessor.GetName())
+	}
+	return names, nil
+}
+
+func deleteOwned(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, object OwnedObject, namespace string) error {
+	deleteOptions := metav1.DeleteOptions{}
+
+	var err error
+	switch object.Kind {
+	case WorkloadDeployment:
+		err = clientset.AppsV1().Deployments(namespace).Delete(ctx, object.Name, deleteOptions)
+	case WorkloadStatefulSet:
+		err = clientset.AppsV1().StatefulSets(namespace).Delete(ctx, object.Name, deleteOptions)
+	case WorkloadDaemonSet:
+		err = clientset.AppsV1().DaemonSets(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindService:
+		err = clientset.CoreV1().Services(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindIngress:
+		err = clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindHPA:
+		err = clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindServiceAccount:
+		err = clientset.CoreV1().ServiceAccounts(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindSecret:
+		err = clientset.CoreV1().Secrets(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindResourceQuota:
+		err = clientset.CoreV1().ResourceQuotas(namespace).Delete(ctx, object.Name, deleteOptions)
+	case KindLimitRange:
+		err = clientset.CoreV1().LimitRanges(namespace).Delete(ctx, object.Name, deleteOptions)
+	default:
+		err = dynamicClient.Resource(ownedGVRs[object.Kind]).Namespace(namespace).Delete(ctx, object.Name, deleteOptions)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to prune %s %s: %v", object.Kind, object.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPruneDynamicClient() *dynamicfake.FakeDynamicClient {
+	return dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		httpRouteGVR:      "HTTPRouteList",
+		grpcRouteGVR:      "GRPCRouteList",
+		middlewareGVR:     "MiddlewareList",
+		serviceMonitorGVR: "ServiceMonitorList",
+		podMonitorGVR:     "PodMonitorList",
+	})
+}
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset(
+		// 属于其他应用以及不由 appdeployer 管理的资源不会被清理
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "tls-other", Namespace: testNamespace, Labels: ownerLabels("other")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "manual", Namespace: testNamespace}},
+	)
+	dynamicClient := newTestPruneDynamicClient()
+
+	if err := CreateOrUpdateDeployment(clientset, ctx, newTestDeploymentOptions(), func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateOrUpdateService(clientset, ctx, ServiceOptions{Name: "hellogo", Namespace: testNamespace, Port: 80, TargetPort: 8080}, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	ingressOptions := IngressOptions{Name: "hellogo", Namespace: testNamespace, Host: "hellogo.com", TLS: true, SelfSigned: true, SelfSignedYears: 1}
+	if err := CreateOrUpdateIngress(clientset, dynamicClient, ctx, ingressOptions, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	// TLS 关闭后证书 Secret 不再属于发布内容，后台任务也不再需要 Service
+	logs := &logRecorder{}
+	pruned, err := Prune(clientset, dynamicClient, ctx, PruneOptions{
+		App:       "hellogo",
+		Namespace: testNamespace,
+		Keep: []OwnedObject{
+			{Kind: WorkloadDeployment, Name: "hellogo"},
+			{Kind: KindIngress, Name: "hellogo"},
+		},
+	}, logs.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 2 {
+		t.Errorf("expected the service and the tls secret to be pruned, got %v", pruned)
+	}
+	logs.assertContains(t, "secret tls-hellogo pruned")
+	logs.assertContains(t, "service hellogo pruned")
+
+	if _, err := clientset.CoreV1().Services(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{}); err == nil {
+		t.Error("expected the service to be pruned")
+	}
+	if _, err := clientset.AppsV1().Deployments(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected the deployment to be kept, got %v", err)
+	}
+	for _, name := range []string{"tls-other", "manual"} {
+		if _, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, name, metav1.GetOptions{}); err != nil {
+			t.Errorf("expected secret %s to be kept, got %v", name, err)
+		}
+	}
+}
+
+func TestPruneFailure(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	failOn(clientset, "list", "secrets")
+	_, err := Prune(clientset, newTestPruneDynamicClient(), context.Background(), PruneOptions{App: "hellogo", Namespace: testNamespace}, func(string) {})
+	assertErrorContains(t, err, "failed to list secret of namespace hello")
+}
+
+func TestPruneAdoptedTLSSecret(t *testing.T) {
+	ctx := context.Background()
+	// 之前版本创建的证书 Secret 没有标签，接管后由下次发布加上标签
+	clientset := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls-hellogo", Namespace: testNamespace},
+		Type:       corev1.SecretTypeTLS,
+	})
+	dynamicClient := newTestPruneDynamicClient()
+
+	ownership := OwnershipOptions{App: "hellogo", Namespace: testNamespace, Objects: []OwnedObject{{Kind: KindSecret, Name: "tls-hellogo"}}}
+	assertErrorContains(t, CheckOwnership(clientset, dynamicClient, ctx, ownership, func(string) {}), "refusing to modify secret tls-hellogo")
+	ownership.Adopt = true
+	if err := CheckOwnership(clientset, dynamicClient, ctx, ownership, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	ingressOptions := IngressOptions{Name: "hellogo", Namespace: testNamespace, Host: "hellogo.com", TLS: true, SelfSigned: true, SelfSignedYears: 1}
+	if err := CreateOrUpdateIngress(clientset, dynamicClient, ctx, ingressOptions, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 之后的发布不再需要 --adopt
+	ownership.Adopt = false
+	if err := CheckOwnership(clientset, dynamicClient, ctx, ownership, func(string) {}); err != nil {
+		t.Fatalf("expected the adopted tls secret to be owned by the app, got %v", err)
+	}
+
+	// TLS 关闭后被清理
+	pruned, err := Prune(clientset, dynamicClient, ctx, PruneOptions{
+		App:       "hellogo",
+		Namespace: testNamespace,
+		Keep:      []OwnedObject{{Kind: KindIngress, Name: "hellogo"}},
+	}, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0].Name != "tls-hellogo" {
+		t.Errorf("expected the adopted tls secret to be pruned, got %v", pruned)
+	}
+	if _, err := clientset.CoreV1().Secrets(testNamespace).Get(ctx, "tls-hellogo", metav1.GetOptions{}); err == nil {
+		t.Error("expected the tls secret to be deleted")
+	}
+}
@@ -9,41 +9,73 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	RetentionPolicyRetain = "retain"
+	RetentionPolicyDelete = "delete"
+)
+
 type PVCOptions struct {
-	Name             string
-	Namespace        string
-	AccessMode       string `form:"accessmode" json:"accessmode"`
-	StorageClassName string `form:"storageclassname" json:"storageclassname"`
-	StorageSize      string `form:"storagesize" json:"storagesize"`
+	Name              string
+	Namespace         string
+	AccessMode        string `form:"accessmode" json:"accessmode"`
+	StorageClassName  string `form:"storageclassname" json:"storageclassname"`
+	StorageSize       string `form:"storagesize" json:"storagesize"`
+	RetentionPolicy   string `form:"retentionpolicy" json:"retentionpolicy"`
+	SnapshotClassName string `form:"snapshotclassname" json:"snapshotclassname"`
+
+	// App 为 PVC 所属的应用，为空时取 Name；迁移存储或按卷创建的 PVC 名称与应用名称不同
+	App string
 }
 
-func CreateOrUpdatePVC(clientset *kubernetes.Clientset, ctx context.Context, opts PVCOptions, logHandler func(msg string)) error {
+func CreateOrUpdatePVC(clientset kubernetes.Interface, ctx context.Context, opts PVCOptions, logHandler func(msg string)) error {
+	spec, err := newPVCSpec(opts.AccessMode, opts.StorageClassName, opts.StorageSize)
+	if err != nil {
+		return fmt.Errorf("invalid pvc %s: %v", opts.Name, err)
+	}
+
+	app := opts.App
+	if app == "" {
+		app = opts.Name
+	}
+
 	pvc := &corev1.PersistentVolumeClaim{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels:    ownerLabels(app),
 		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.PersistentVolumeAccessMode(MustConvert(opts.AccessMode)),
-			},
-			StorageClassName: &opts.StorageClassName,
-			Resources: corev1.VolumeResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse(opts.StorageSize),
-				},
-			},
-		},
+		Spec: spec,
 	}
 
 	if _, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create pvc resource: %v", err)
 		}
-		logHandler("pvc resource successfully updated")
+
+		// PVC 的规格中只有容量可以更新，且只能扩大
+		live, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pvc resource: %v", err)
+		}
+		labeled := setOwnerLabels(&live.ObjectMeta, app)
+		if live.Spec.Resources.Requests.Storage().Cmp(*spec.Resources.Requests.Storage()) < 0 {
+			live.Spec.Resources.Requests[corev1.ResourceStorage] = *spec.Resources.Requests.Storage()
+			if _, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+				return fmt.Errorf("failed to expand pvc resource: %v", err)
+			}
+			logHandler(fmt.Sprintf("pvc resource successfully expanded to %s", opts.StorageSize))
+		} else {
+			if labeled {
+				if _, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+					return fmt.Errorf("failed to update pvc resource: %v", err)
+				}
+			}
+			logHandler("pvc resource successfully updated")
+		}
 	} else {
 		logHandler("pvc resource successfully created")
 	}
@@ -51,29 +83,80 @@ func CreateOrUpdatePVC(clientset *kubernetes.Clientset, ctx context.Context, opt
 	return nil
 }
 
-func DeletePVC(clientset *kubernetes.Clientset, ctx context.Context, opts HPAOptions, logHandler func(msg string)) error {
-	err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
-	if err != nil && !apierrors.IsNotFound(err) {
-		return fmt.Errorf("failed to delete hpa resource: %v", err)
+// DeletePVC 按保留策略处理不再使用的 PVC。
+// 策略为 retain 时保留 PVC；为 delete 时必须确认数据丢失，并在删除前创建 VolumeSnapshot 以便恢复
+func DeletePVC(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts PVCOptions, confirmDataLoss bool, logHandler func(msg string)) error {
+	if _, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			logHandler(fmt.Sprintf("pvc resource %s in namespace %s not found, no action taken\n", opts.Name, opts.Namespace))
+			return nil
+		}
+		return fmt.Errorf("failed to get pvc resource: %v", err)
 	}
-	if apierrors.IsNotFound(err) {
-		logHandler(fmt.Sprintf("pvc resource %s in namespace %s not found, no action taken\n", opts.Name, opts.Namespace))
-	} else {
-		logHandler(fmt.Sprintf("pvc resource %s in namespace %s successfully deleted\n", opts.Name, opts.Namespace))
+
+	if strings.ToLower(opts.RetentionPolicy) != RetentionPolicyDelete {
+		logHandler(fmt.Sprintf("pvc resource %s in namespace %s retained by retention policy\n", opts.Name, opts.Namespace))
+		return nil
 	}
+
+	if !confirmDataLoss {
+		return fmt.Errorf("pvc resource %s in namespace %s is about to be deleted, rerun with --confirm-data-loss to proceed", opts.Name, opts.Namespace)
+	}
+
+	snapshotName, err := CreateVolumeSnapshot(dynamicClient, ctx, opts.Name, opts.Namespace, opts.SnapshotClassName, logHandler)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot pvc %s, deletion aborted: %v", opts.Name, err)
+	}
+
+	err = clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete pvc resource: %v", err)
+	}
+	logHandler(fmt.Sprintf("pvc resource %s in namespace %s successfully deleted, restore it from volumesnapshot %s\n", opts.Name, opts.Namespace, snapshotName))
 	return nil
 }
 
-func MustConvert(v string) corev1.PersistentVolumeAccessMode {
+// newPVCSpec 构造 PVC 规格，storageClassName 为空时使用集群默认的 StorageClass
+func newPVCSpec(accessMode, storageClassName, storageSize string) (corev1.PersistentVolumeClaimSpec, error) {
+	mode, err := ConvertAccessMode(accessMode)
+	if err != nil {
+		return corev1.PersistentVolumeClaimSpec{}, err
+	}
+
+	size, err := resource.ParseQuantity(storageSize)
+	if err != nil {
+		return corev1.PersistentVolumeClaimSpec{}, fmt.Errorf("invalid storage size '%s': %v", storageSize, err)
+	}
+
+	spec := corev1.PersistentVolumeClaimSpec{
+		AccessModes: []corev1.PersistentVolumeAccessMode{
+			mode,
+		},
+		Resources: corev1.VolumeResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceStorage: size,
+			},
+		},
+	}
+	if storageClassName != "" {
+		spec.StorageClassName = &storageClassName
+	}
+	return spec, nil
+}
+
+// ConvertAccessMode 将不区分大小写的访问模式转换为 Kubernetes 的访问模式，为空时默认为 ReadWriteOnce
+func ConvertAccessMode(v string) (corev1.PersistentVolumeAccessMode, error) {
 	v = strings.ToLower(v)
 	switch v {
 	case "readonlymany":
-		return corev1.ReadOnlyMany
-	case "readwriteonce":
-		return corev1.ReadWriteOnce
+		return corev1.ReadOnlyMany, nil
+	case "", "readwriteonce":
+		return corev1.ReadWriteOnce, nil
 	case "readwritemany":
-		return corev1.ReadWriteMany
+		return corev1.ReadWriteMany, nil
+	case "readwriteoncepod":
+		return corev1.ReadWriteOncePod, nil
 	default:
-		panic(fmt.Errorf("unsupported access mode: %s", v))
+		return "", fmt.Errorf("unsupported access mode: %s", v)
 	}
 }
@@ -0,0 +1,179 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestPVC(name, size string) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+// newTestDynamicClient 返回支持 VolumeSnapshot 的 fake 动态客户端，创建的快照立即可用
+func newTestDynamicClient(objects ...runtime.Object) *dynamicfake.FakeDynamicClient {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		volumeSnapshotGVR: "VolumeSnapshotList",
+	}, objects...)
+	dynamicClient.PrependReactor("create", "volumesnapshots", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		snapshot := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		_ = unstructured.SetNestedField(snapshot.Object, true, "status", "readyToUse")
+		_ = unstructured.SetNestedField(snapshot.Object, "1Gi", "status", "restoreSize")
+		return false, nil, nil
+	})
+	return dynamicClient
+}
+
+func TestCreateOrUpdatePVC(t *testing.T) {
+	ctx := context.Background()
+	opts := PVCOptions{Name: "hellogo", Namespace: testNamespace, AccessMode: "readwriteonce", StorageClassName: "ssd", StorageSize: "1Gi"}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdatePVC(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *pvc.Spec.StorageClassName != "ssd" {
+		t.Errorf("expected storage class ssd, got %s", *pvc.Spec.StorageClassName)
+	}
+	logs.assertContains(t, "successfully created")
+
+	// 容量不变时不更新
+	if err := CreateOrUpdatePVC(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	opts.StorageSize = "2Gi"
+	if err := CreateOrUpdatePVC(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	pvc, _ = clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "2Gi" {
+		t.Errorf("expected pvc expanded to 2Gi, got %s", size.String())
+	}
+	logs.assertContains(t, "successfully expanded to 2Gi")
+
+	opts.StorageSize = "1Gi"
+	if err := CreateOrUpdatePVC(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	pvc, _ = clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "2Gi" {
+		t.Errorf("expected pvc not to shrink, got %s", size.String())
+	}
+
+	opts.AccessMode = "readwritesometimes"
+	assertErrorContains(t, CreateOrUpdatePVC(clientset, ctx, opts, logs.handle), "invalid pvc hellogo")
+}
+
+func TestDeletePVC(t *testing.T) {
+	ctx := context.Background()
+	opts := PVCOptions{Name: "hellogo", Namespace: testNamespace}
+
+	t.Run("not found", func(t *testing.T) {
+		logs := &logRecorder{}
+		if err := DeletePVC(fake.NewSimpleClientset(), newTestDynamicClient(), ctx, opts, false, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		logs.assertContains(t, "not found, no action taken")
+	})
+
+	t.Run("retained", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("hellogo", "1Gi"))
+		logs := &logRecorder{}
+		if err := DeletePVC(clientset, newTestDynamicClient(), ctx, opts, true, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{}); err != nil {
+			t.Errorf("expected pvc to be retained: %v", err)
+		}
+		logs.assertContains(t, "retained by retention policy")
+	})
+
+	deleteOpts := opts
+	deleteOpts.RetentionPolicy = RetentionPolicyDelete
+
+	t.Run("not confirmed", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("hellogo", "1Gi"))
+		err := DeletePVC(clientset, newTestDynamicClient(), ctx, deleteOpts, false, func(string) {})
+		assertErrorContains(t, err, "--confirm-data-loss")
+	})
+
+	t.Run("snapshot then delete", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("hellogo", "1Gi"))
+		dynamicClient := newTestDynamicClient()
+		logs := &logRecorder{}
+		if err := DeletePVC(clientset, dynamicClient, ctx, deleteOpts, true, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{}); err == nil {
+			t.Error("expected pvc to be deleted")
+		}
+		snapshots, err := dynamicClient.Resource(volumeSnapshotGVR).Namespace(testNamespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(snapshots.Items) != 1 {
+			t.Fatalf("expected 1 volumesnapshot, got %d", len(snapshots.Items))
+		}
+		logs.assertContains(t, "restore it from volumesnapshot "+snapshots.Items[0].GetName())
+	})
+
+	t.Run("snapshot fails", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(newTestPVC("hellogo", "1Gi"))
+		dynamicClient := newTestDynamicClient()
+		dynamicClient.PrependReactor("create", "volumesnapshots", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(volumeSnapshotGVR.GroupResource(), "", nil)
+		})
+		err := DeletePVC(clientset, dynamicClient, ctx, deleteOpts, true, func(string) {})
+		assertErrorContains(t, err, "deletion aborted")
+		if _, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{}); err != nil {
+			t.Errorf("expected pvc to be kept when the snapshot fails: %v", err)
+		}
+	})
+}
+
+func TestConvertAccessMode(t *testing.T) {
+	for input, expected := range map[string]corev1.PersistentVolumeAccessMode{
+		"":                 corev1.ReadWriteOnce,
+		"ReadWriteOnce":    corev1.ReadWriteOnce,
+		"readonlymany":     corev1.ReadOnlyMany,
+		"ReadWriteMany":    corev1.ReadWriteMany,
+		"readwriteoncepod": corev1.ReadWriteOncePod,
+	} {
+		mode, err := ConvertAccessMode(input)
+		if err != nil {
+			t.Errorf("%q: %v", input, err)
+			continue
+		}
+		if mode != expected {
+			t.Errorf("%q: expected %s, got %s", input, expected, mode)
+		}
+	}
+	if _, err := ConvertAccessMode("readwritesometimes"); err == nil {
+		t.Error("expected an error for unknown access mode")
+	}
+}
@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceQuotaOptions 用于限制命名空间内资源的总用量
+type ResourceQuotaOptions struct {
+	Name      string
+	Namespace string
+	Enabled   bool `form:"enabled" json:"enabled"`
+	// 形如 requests.cpu=4、limits.memory=8Gi、pods=20
+	Hard []string `form:"hard" json:"hard"`
+}
+
+// LimitRangeOptions 用于为命名空间内的容器设置默认的资源配额及上下限
+type LimitRangeOptions struct {
+	Name           string
+	Namespace      string
+	Enabled        bool     `form:"enabled" json:"enabled"`
+	Default        []string `form:"default" json:"default"`
+	DefaultRequest []string `form:"defaultrequest" json:"defaultrequest"`
+	Max            []string `form:"max" json:"max"`
+	Min            []string `form:"min" json:"min"`
+}
+
+func CreateOrUpdateResourceQuota(clientset kubernetes.Interface, ctx context.Context, opts ResourceQuotaOptions, logHandler func(msg string)) error {
+	hard, err := newResourceList(opts.Hard)
+	if err != nil {
+		return fmt.Errorf("invalid resource quota: %v", err)
+	}
+	if len(hard) == 0 {
+		return fmt.Errorf("invalid resource quota: at least one hard limit is required")
+	}
+
+	quota := &corev1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
+		},
+		Spec: corev1.ResourceQuotaSpec{
+			Hard: hard,
+		},
+	}
+
+	if _, err := clientset.CoreV1().ResourceQuotas(opts.Namespace).Create(ctx, quota, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create resourcequota resource: %v", err)
+		}
+		if _, err := clientset.CoreV1().ResourceQuotas(opts.Namespace).Update(ctx, quota, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update resourcequota resource: %v", err)
+		}
+		logHandler("resourcequota resource successfully updated")
+	} else {
+		logHandler("resourcequota resource successfully created")
+	}
+
+	return nil
+}
+
+func DeleteResourceQuota(clientset kubernetes.Interface, ctx context.Context, opts ResourceQuotaOptions, logHandler func(msg string)) error {
+	err := clientset.CoreV1().ResourceQuotas(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete resourcequota resource: %v", err)
+	}
+	if apierrors.IsNotFound(err) {
+		logHandler(fmt.Sprintf("resourcequota resource %s in namespace %s not found, no action taken\n", opts.Name, opts.Namespace))
+	} else {
+		logHandler(fmt.Sprintf("resourcequota resource %s in namespace %s successfully deleted\n", opts.Name, opts.Namespace))
+	}
+	return nil
+}
+
+func CreateOrUpdateLimitRange(clientset kubernetes.Interface, ctx context.Context, opts LimitRangeOptions, logHandler func(msg string)) error {
+	item := corev1.LimitRangeItem{
+		Type: corev1.LimitTypeContainer,
+	}
+	for _, limit := range []struct {
+		field string
+		pairs []string
+		list  *corev1.ResourceList
+	}{
+		{"default", opts.Default, &item.Default},
+		{"defaultrequest", opts.DefaultRequest, &item.DefaultRequest},
+		{"max", opts.Max, &item.Max},
+		{"min", opts.Min, &item.Min},
+	} {
+		list, err := newResourceList(limit.pairs)
+		if err != nil {
+			return fmt.Errorf("invalid %s of limit range: %v", limit.field, err)
+		}
+		if len(list) > 0 {
+			*limit.list = list
+		}
+	}
+	if item.Default == nil && item.DefaultRequest == nil && item.Max == nil && item.Min == nil {
+		return fmt.Errorf("invalid limit range: at least one of default, defaultrequest, max and min is required")
+	}
+
+	limitRange := &corev1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
+		},
+		Spec: corev1.LimitRangeSpec{
+			Limits: []corev1.LimitRangeItem{item},
+		},
+	}
+
+	if _, err := clientset.CoreV1().LimitRanges(opts.Namespace).Create(ctx, limitRange, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create limitrange resource: %v", err)
+		}
+		if _, err := clientset.CoreV1().LimitRanges(opts.Namespace).Update(ctx, limitRange, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update limitrange resource: %v", err)
+		}
+		logHandler("limitrange resource successfully updated")
+	} else {
+		logHandler("limitrange resource successfully created")
+	}
+
+	return nil
+}
+
+func DeleteLimitRange(clientset kubernetes.Interface, ctx context.Context, opts LimitRangeOptions, logHandler func(msg string)) error {
+	err := clientset.CoreV1().LimitRanges(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete limitrange resource: %v", err)
+	}
+	if apierrors.IsNotFound(err) {
+		logHandler(fmt.Sprintf("limitrange resource %s in namespace %s not found, no action taken\n", opts.Name, opts.Namespace))
+	} else {
+		logHandler(fmt.Sprintf("limitrange resource %s in namespace %s successfully deleted\n", opts.Name, opts.Namespace))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateResourceQuota(t *testing.T) {
+	ctx := context.Background()
+	opts := ResourceQuotaOptions{Name: "hellogo", Namespace: testNamespace, Hard: []string{"requests.cpu=4", "pods=20"}}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateResourceQuota(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully created")
+
+	opts.Hard = []string{"pods=10"}
+	if err := CreateOrUpdateResourceQuota(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	quota, err := clientset.CoreV1().ResourceQuotas(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pods := quota.Spec.Hard[corev1.ResourcePods]; pods.Value() != 10 {
+		t.Errorf("expected pods=10, got %s", pods.String())
+	}
+	logs.assertContains(t, "successfully updated")
+
+	opts.Hard = nil
+	assertErrorContains(t, CreateOrUpdateResourceQuota(clientset, ctx, opts, logs.handle), "at least one hard limit is required")
+	opts.Hard = []string{"pods=-1"}
+	assertErrorContains(t, CreateOrUpdateResourceQuota(clientset, ctx, opts, logs.handle), "must not be negative")
+}
+
+func TestDeleteResourceQuota(t *testing.T) {
+	ctx := context.Background()
+	opts := ResourceQuotaOptions{Name: "hellogo", Namespace: testNamespace}
+
+	clientset := fake.NewSimpleClientset(&corev1.ResourceQuota{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteResourceQuota(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteResourceQuota(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+
+	failOn(clientset, "delete", "resourcequotas")
+	assertErrorContains(t, DeleteResourceQuota(clientset, ctx, opts, logs.handle), "failed to delete resourcequota resource")
+}
+
+func TestCreateOrUpdateLimitRange(t *testing.T) {
+	ctx := context.Background()
+	opts := LimitRangeOptions{
+		Name:           "hellogo",
+		Namespace:      testNamespace,
+		Default:        []string{"cpu=500m", "memory=512Mi"},
+		DefaultRequest: []string{"cpu=100m"},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateLimitRange(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	limitRange, err := clientset.CoreV1().LimitRanges(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	item := limitRange.Spec.Limits[0]
+	if item.Type != corev1.LimitTypeContainer || item.Max != nil {
+		t.Errorf("unexpected limit range item %+v", item)
+	}
+	logs.assertContains(t, "successfully created")
+
+	if err := CreateOrUpdateLimitRange(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	assertErrorContains(t, CreateOrUpdateLimitRange(clientset, ctx, LimitRangeOptions{Name: "hellogo", Namespace: testNamespace}, logs.handle), "at least one of default")
+	opts.Max = []string{"cpu"}
+	assertErrorContains(t, CreateOrUpdateLimitRange(clientset, ctx, opts, logs.handle), "invalid max of limit range")
+}
+
+func TestDeleteLimitRange(t *testing.T) {
+	ctx := context.Background()
+	opts := LimitRangeOptions{Name: "hellogo", Namespace: testNamespace}
+
+	clientset := fake.NewSimpleClientset(&corev1.LimitRange{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteLimitRange(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteLimitRange(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+}
@@ -0,0 +1,277 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// migrateImage 用于在 PVC 之间复制数据的镜像
+const migrateImage = "busybox:1.36"
+
+// migrateJobDeadlineSeconds 为复制数据的 Job 的最长运行秒数
+const migrateJobDeadlineSeconds = 1800
+
+// migrateTimeout 为等待 Pod 退出与复制 Job 完成的最长时间
+const migrateTimeout = migrateJobDeadlineSeconds*time.Second + 5*time.Minute
+
+const surgeLabel = "appdeployer/surge"
+
+// SurgeDeploymentName 返回顶替旧 Deployment 的临时 Deployment 名称
+func SurgeDeploymentName(name string) string {
+	return name + "-surge"
+}
+
+// OrphanWorkload 删除工作负载但保留其 Pod，等待删除完成后由新建的同名工作负载接管
+func OrphanWorkload(clientset kubernetes.Interface, ctx context.Context, workload, name, namespace string, logHandler func(msg string)) error {
+	orphan := metav1.DeletePropagationOrphan
+	opts := metav1.DeleteOptions{PropagationPolicy: &orphan}
+
+	var err error
+	switch workload {
+	case WorkloadStatefulSet:
+		err = clientset.AppsV1().StatefulSets(namespace).Delete(ctx, name, opts)
+	case WorkloadDaemonSet:
+		err = clientset.AppsV1().DaemonSets(namespace).Delete(ctx, name, opts)
+	default:
+		err = clientset.AppsV1().Deployments(namespace).Delete(ctx, name, opts)
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s %s: %v", workload, name, err)
+	}
+
+	for {
+		live, err := getWorkload(clientset, ctx, workload, name, namespace)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s %s to be deleted: %v", workload, name, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	logHandler(fmt.Sprintf("%s %s deleted, its pods are left running for the new one to adopt", workload, name))
+	return nil
+}
+
+// SurgeDeployment 以旧 Deployment 的 Pod 模板创建临时 Deployment，待其就绪后删除旧 Deployment
+func SurgeDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	live, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s: %v", name, err)
+	}
+
+	template := *live.Spec.Template.DeepCopy()
+	if template.Labels == nil {
+		template.Labels = make(map[string]string)
+	}
+	template.Labels["name"] = name
+	template.Labels[surgeLabel] = "true"
+
+	surge := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      SurgeDeploymentName(name),
+			Namespace: namespace,
+			Labels:    live.Labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: live.Spec.Replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name":     name,
+					surgeLabel: "true",
+				},
+			},
+			Template: template,
+		},
+	}
+
+	if _, err := clientset.AppsV1().Deployments(namespace).Create(ctx, surge, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create deployment %s: %v", surge.Name, err)
+		}
+		if _, err := clientset.AppsV1().Deployments(namespace).Update(ctx, surge, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update deployment %s: %v", surge.Name, err)
+		}
+	}
+	logHandler(fmt.Sprintf("deployment %s created to serve traffic while %s is recreated", surge.Name, name))
+
+	if err := WaitForRollout(clientset, ctx, WorkloadDeployment, surge.Name, namespace, logHandler); err != nil {
+		return err
+	}
+
+	foreground := metav1.DeletePropagationForeground
+	if err := clientset.AppsV1().Deployments(namespace).Delete(ctx, name, metav1.DeleteOptions{PropagationPolicy: &foreground}); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete deployment %s: %v", name, err)
+	}
+	for {
+		live, err := getWorkload(clientset, ctx, WorkloadDeployment, name, namespace)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for deployment %s to be deleted: %v", name, ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	logHandler(fmt.Sprintf("deployment %s deleted, it will be recreated", name))
+	return nil
+}
+
+// DeleteSurgeDeployment 删除重建期间顶替旧 Deployment 的临时 Deployment
+func DeleteSurgeDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	return DeleteDeployment(clientset, ctx, DeploymentOptions{
+		Name:      SurgeDeploymentName(name),
+		Namespace: namespace,
+	}, logHandler)
+}
+
+// MigratePVC 按新的规格创建 PVC，将 Deployment 缩容为 0 后用 Job 复制数据，返回新 PVC 的名称。
+// 旧 PVC 予以保留，确认数据无误后可手动删除；Deployment 的副本数在随后的更新中恢复，迁移失败或超时时立即恢复
+func MigratePVC(clientset kubernetes.Interface, ctx context.Context, opts PVCOptions, deploymentName string, logHandler func(msg string)) (string, error) {
+	now := time.Now().Unix()
+	newName := fmt.Sprintf("%s-%d", deploymentName, now)
+	if err := CreateOrUpdatePVC(clientset, ctx, PVCOptions{
+		Name:             newName,
+		Namespace:        opts.Namespace,
+		AccessMode:       opts.AccessMode,
+		StorageClassName: opts.StorageClassName,
+		StorageSize:      opts.StorageSize,
+		App:              deploymentName,
+	}, logHandler); err != nil {
+		return "", err
+	}
+
+	// 停止写入并释放 ReadWriteOnce 卷，保证复制出的数据一致
+	replicas, err := scaleDeployment(clientset, ctx, deploymentName, opts.Namespace, 0)
+	if err != nil {
+		if deleteErr := deleteMigrationPVC(clientset, ctx, newName, opts.Namespace, logHandler); deleteErr != nil {
+			return "", fmt.Errorf("%v, %v", err, deleteErr)
+		}
+		return "", err
+	}
+	logHandler(fmt.Sprintf("deployment %s scaled down to 0 for data migration", deploymentName))
+
+	migrateCtx, cancel := context.WithTimeout(ctx, migrateTimeout)
+	defer cancel()
+	err = waitForPodsGone(clientset, migrateCtx, "name="+deploymentName, opts.Namespace)
+	if err == nil {
+		err = RunJob(clientset, migrateCtx, JobOptions{
+			Name:      fmt.Sprintf("%s-migrate-%d", deploymentName, now),
+			Namespace: opts.Namespace,
+			Labels: map[string]string{
+				"app":    deploymentName,
+				"hook":   "migrate",
+				AppLabel: deploymentName,
+			},
+			Volumes: []corev1.Volume{
+				{
+					Name: "from",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: opts.Name,
+							ReadOnly:  true,
+						},
+					},
+				},
+				{
+					Name: "to",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: newName,
+						},
+					},
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: "from", MountPath: "/from", ReadOnly: true},
+				{Name: "to", MountPath: "/to"},
+			},
+			Hook: Hook{
+				Image:                   migrateImage,
+				Command:                 "cp -a /from/. /to/",
+				ActiveDeadlineSeconds:   migrateJobDeadlineSeconds,
+				TTLSecondsAfterFinished: 600,
+			},
+		}, logHandler)
+	}
+	if err != nil {
+		// 超时或取消后仍须恢复副本数并删除新建的 PVC，因此不沿用已结束的 ctx
+		if ctx.Err() != nil {
+			ctx = context.Background()
+		}
+		if _, scaleErr := scaleDeployment(clientset, ctx, deploymentName, opts.Namespace, replicas); scaleErr != nil {
+			err = fmt.Errorf("%v, %v", err, scaleErr)
+		}
+		if deleteErr := deleteMigrationPVC(clientset, ctx, newName, opts.Namespace, logHandler); deleteErr != nil {
+			err = fmt.Errorf("%v, %v", err, deleteErr)
+		}
+		return "", fmt.Errorf("failed to migrate pvc %s: %v", opts.Name, err)
+	}
+
+	logHandler(fmt.Sprintf("pvc %s migrated to %s, the old one is retained, delete it once the data is verified", opts.Name, newName))
+	return newName, nil
+}
+
+// deleteMigrationPVC 删除迁移失败后遗留的新 PVC，避免每次重试都多出一个
+func deleteMigrationPVC(clientset kubernetes.Interface, ctx context.Context, name, namespace string, logHandler func(msg string)) error {
+	err := clientset.CoreV1().PersistentVolumeClaims(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete pvc %s: %v", name, err)
+	}
+	logHandler(fmt.Sprintf("pvc %s created for the migration is deleted", name))
+	return nil
+}
+
+// scaleDeployment 调整 Deployment 的副本数，返回调整前的副本数
+func scaleDeployment(clientset kubernetes.Interface, ctx context.Context, name, namespace string, replicas int32) (int32, error) {
+	scale, err := clientset.AppsV1().Deployments(namespace).GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get scale of deployment %s: %v", name, err)
+	}
+
+	previous := scale.Spec.Replicas
+	scale.Spec.Replicas = replicas
+	if _, err := clientset.AppsV1().Deployments(namespace).UpdateScale(ctx, name, scale, metav1.UpdateOptions{}); err != nil {
+		return 0, fmt.Errorf("failed to scale deployment %s: %v", name, err)
+	}
+	return previous, nil
+}
+
+func waitForPodsGone(clientset kubernetes.Interface, ctx context.Context, labelSelector, namespace string) error {
+	for {
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: labelSelector,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %v", err)
+		}
+		if len(pods.Items) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for pods %s to terminate: %v", labelSelector, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package kube
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMigratePVCRestoresReplicasOnTimeout(t *testing.T) {
+	// Pod 一直不退出，迁移在 ctx 到期后放弃
+	pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "hellogo-1", Namespace: testNamespace, Labels: map[string]string{"name": "hellogo"}}}
+	clientset := newTestScaleClient(newTestOperationDeployment(), pod)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	opts := PVCOptions{Name: "hellogo", Namespace: testNamespace, AccessMode: "readwriteonce", StorageClassName: "standard", StorageSize: "1Gi"}
+	_, err := MigratePVC(clientset, ctx, opts, "hellogo", func(string) {})
+	assertErrorContains(t, err, "timed out waiting for pods name=hellogo to terminate")
+
+	deployment, err := clientset.AppsV1().Deployments(testNamespace).Get(context.Background(), "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *deployment.Spec.Replicas != 2 {
+		t.Errorf("expected the replicas to be restored to 2, got %d", *deployment.Spec.Replicas)
+	}
+
+	// 新建的 PVC 随迁移失败一并删除
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvcs.Items) != 0 {
+		t.Errorf("expected the new pvc to be deleted, got %s", pvcs.Items[0].Name)
+	}
+}
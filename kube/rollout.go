@@ -0,0 +1,152 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// WaitForRollout 等待工作负载的所有副本更新到最新版本并就绪
+func WaitForRollout(clientset kubernetes.Interface, ctx context.Context, workload, name, namespace string, logHandler func(msg string)) error {
+	logHandler(fmt.Sprintf("waiting for %s %s rollout to finish...", workload, name))
+	for {
+		done, err := isRolloutDone(clientset, ctx, workload, name, namespace)
+		if err != nil {
+			return err
+		}
+		if done {
+			logHandler(fmt.Sprintf("%s %s successfully rolled out", workload, name))
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s %s rollout: %v", workload, name, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+func isRolloutDone(clientset kubernetes.Interface, ctx context.Context, workload, name, namespace string) (bool, error) {
+	switch workload {
+	case WorkloadStatefulSet:
+		sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get statefulset: %v", err)
+		}
+		replicas := int32(1)
+		if sts.Spec.Replicas != nil {
+			replicas = *sts.Spec.Replicas
+		}
+		return sts.Status.ObservedGeneration >= sts.Generation &&
+			sts.Status.UpdatedReplicas == replicas &&
+			sts.Status.ReadyReplicas == replicas &&
+			sts.Status.CurrentRevision == sts.Status.UpdateRevision, nil
+	case WorkloadDaemonSet:
+		ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get daemonset: %v", err)
+		}
+		return ds.Status.ObservedGeneration >= ds.Generation &&
+			ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+			ds.Status.NumberAvailable == ds.Status.DesiredNumberScheduled, nil
+	default:
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get deployment: %v", err)
+		}
+		for _, cond := range deployment.Status.Conditions {
+			if cond.Type == appsv1.DeploymentProgressing && cond.Reason == "ProgressDeadlineExceeded" {
+				return false, fmt.Errorf("deployment %s exceeded its progress deadline", name)
+			}
+		}
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.UpdatedReplicas == replicas &&
+			deployment.Status.Replicas == replicas &&
+			deployment.Status.AvailableReplicas == replicas, nil
+	}
+}
+
+// GetPodTemplate 返回工作负载当前的 Pod 模板，不存在时返回 nil
+func GetPodTemplate(clientset kubernetes.Interface, ctx context.Context, workload, name, namespace string) (*corev1.PodTemplateSpec, error) {
+	var template *corev1.PodTemplateSpec
+	var err error
+	switch workload {
+	case WorkloadStatefulSet:
+		var sts *appsv1.StatefulSet
+		if sts, err = clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template = &sts.Spec.Template
+		}
+	case WorkloadDaemonSet:
+		var ds *appsv1.DaemonSet
+		if ds, err = clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template = &ds.Spec.Template
+		}
+	default:
+		var deployment *appsv1.Deployment
+		if deployment, err = clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{}); err == nil {
+			template = &deployment.Spec.Template
+		}
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s %s: %v", workload, name, err)
+	}
+	return template, nil
+}
+
+// RollbackPodTemplate 将工作负载的 Pod 模板还原为发布前的版本
+func RollbackPodTemplate(clientset kubernetes.Interface, ctx context.Context, workload, name, namespace string, template *corev1.PodTemplateSpec, logHandler func(msg string)) error {
+	if template == nil {
+		logHandler(fmt.Sprintf("no previous revision of %s %s, rollback skipped", workload, name))
+		return nil
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		switch workload {
+		case WorkloadStatefulSet:
+			sts, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			sts.Spec.Template = *template
+			_, err = clientset.AppsV1().StatefulSets(namespace).Update(ctx, sts, metav1.UpdateOptions{})
+			return err
+		case WorkloadDaemonSet:
+			ds, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			ds.Spec.Template = *template
+			_, err = clientset.AppsV1().DaemonSets(namespace).Update(ctx, ds, metav1.UpdateOptions{})
+			return err
+		default:
+			deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			deployment.Spec.Template = *template
+			_, err = clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+			return err
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back %s %s: %v", workload, name, err)
+	}
+
+	logHandler(fmt.Sprintf("%s %s successfully rolled back", workload, name))
+	return nil
+}
@@ -0,0 +1,340 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	RoutingIngress = "ingress"
+	RoutingGateway = "gateway"
+)
+
+const (
+	RouteKindHTTP = "http"
+	RouteKindGRPC = "grpc"
+)
+
+// routeTimeout 为等待网关接受路由的最长时间
+const routeTimeout = 2 * time.Minute
+
+const gatewayGroupVersion = "gateway.networking.k8s.io/v1"
+
+var httpRouteGVR = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1",
+	Resource: "httproutes",
+}
+
+var grpcRouteGVR = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1",
+	Resource: "grpcroutes",
+}
+
+// RouteBackend 为路由转发的一个后端服务，Weight 为空时使用默认权重 1，为 0 时不转发流量
+type RouteBackend struct {
+	Service string `form:"service" json:"service"`
+	Port    int32  `form:"port" json:"port"`
+	Weight  *int32 `form:"weight" json:"weight"`
+}
+
+// RouteOptions 用于创建挂到 Gateway 上的 HTTPRoute 或 GRPCRoute
+type RouteOptions struct {
+	Name             string
+	Namespace        string
+	Port             int32
+	Kind             string   `form:"kind" json:"kind"`
+	Gateway          string   `form:"gateway" json:"gateway"`
+	GatewayNamespace string   `form:"gatewaynamespace" json:"gatewaynamespace"`
+	SectionName      string   `form:"sectionname" json:"sectionname"`
+	Hostnames        []string `form:"hostnames" json:"hostnames"`
+	// Paths 默认按前缀匹配，以 = 开头为精确匹配，以 ~ 开头为正则匹配，仅用于 HTTPRoute
+	Paths []string `form:"paths" json:"paths"`
+	// Methods 格式为 service 或 service/method，仅用于 GRPCRoute
+	Methods  []string       `form:"methods" json:"methods"`
+	Headers  []string       `form:"headers" json:"headers"`
+	Backends []RouteBackend `form:"backends" json:"backends"`
+}
+
+// RouteGVR 返回路由类型对应的资源
+func RouteGVR(kind string) schema.GroupVersionResource {
+	if kind == RouteKindGRPC {
+		return grpcRouteGVR
+	}
+	return httpRouteGVR
+}
+
+// CreateOrUpdateRoute 创建或更新路由，并等待 Gateway 接受路由且后端引用解析成功
+func CreateOrUpdateRoute(dynamicClient dynamic.Interface, ctx context.Context, opts RouteOptions, logHandler func(msg string)) error {
+	route, err := newRoute(opts)
+	if err != nil {
+		return err
+	}
+
+	gvr := RouteGVR(opts.Kind)
+	resourceName := strings.TrimSuffix(gvr.Resource, "s")
+	created, err := createOrUpdateUnstructured(dynamicClient, ctx, gvr, route)
+	if err != nil {
+		return fmt.Errorf("failed to create or update %s resource: %v", resourceName, err)
+	}
+	if created {
+		logHandler(fmt.Sprintf("%s resource successfully created, waiting for gateway %s to accept it...", resourceName, opts.Gateway))
+	} else {
+		logHandler(fmt.Sprintf("%s resource successfully updated, waiting for gateway %s to accept it...", resourceName, opts.Gateway))
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, routeTimeout)
+	defer cancel()
+	if err := waitForRoute(dynamicClient, waitCtx, gvr, opts); err != nil {
+		return err
+	}
+
+	logHandler(fmt.Sprintf("%s %s accepted by gateway %s", resourceName, opts.Name, opts.Gateway))
+	return nil
+}
+
+// DeleteIngress 删除 Ingress，用于切换到 Gateway 路由
+func DeleteIngress(clientset kubernetes.Interface, ctx context.Context, opts IngressOptions, logHandler func(msg string)) error {
+	err := clientset.NetworkingV1().Ingresses(opts.Namespace).Delete(ctx, opts.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ingress resource: %v", err)
+	}
+	if apierrors.IsNotFound(err) {
+		logHandler(fmt.Sprintf("ingress resource %s in namespace %s not found, no action taken", opts.Name, opts.Namespace))
+	} else {
+		logHandler(fmt.Sprintf("ingress resource %s in namespace %s successfully deleted", opts.Name, opts.Namespace))
+	}
+	return nil
+}
+
+func newRoute(opts RouteOptions) (*unstructured.Unstructured, error) {
+	parentRef := map[string]interface{}{
+		"group": httpRouteGVR.Group,
+		"kind":  "Gateway",
+		"name":  opts.Gateway,
+	}
+	if !helpers.IsBlank(opts.GatewayNamespace) {
+		parentRef["namespace"] = opts.GatewayNamespace
+	}
+	if !helpers.IsBlank(opts.SectionName) {
+		parentRef["sectionName"] = opts.SectionName
+	}
+
+	matches, err := newRouteMatches(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := map[string]interface{}{
+		"backendRefs": newBackendRefs(opts),
+	}
+	if len(matches) > 0 {
+		rule["matches"] = matches
+	}
+
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"rules":      []interface{}{rule},
+	}
+	if len(opts.Hostnames) > 0 {
+		hostnames := make([]interface{}, 0, len(opts.Hostnames))
+		for _, hostname := range opts.Hostnames {
+			hostnames = append(hostnames, hostname)
+		}
+		spec["hostnames"] = hostnames
+	}
+
+	kind := "HTTPRoute"
+	if opts.Kind == RouteKindGRPC {
+		kind = "GRPCRoute"
+	}
+
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": gatewayGroupVersion,
+			"kind":       kind,
+			"metadata": map[string]interface{}{
+				"name":      opts.Name,
+				"namespace": opts.Namespace,
+				"labels": map[string]interface{}{
+					"app":          opts.Name,
+					ManagedByLabel: managedBy,
+					AppLabel:       opts.Name,
+				},
+			},
+			"spec": spec,
+		},
+	}, nil
+}
+
+// newRouteMatches 为每个路径或方法生成一个匹配条件，请求头条件附加到每个匹配条件上
+func newRouteMatches(opts RouteOptions) ([]interface{}, error) {
+	headers, err := newHTTPHeaders(opts.Headers)
+	if err != nil {
+		return nil, err
+	}
+	var headerMatches []interface{}
+	for _, header := range headers {
+		headerMatches = append(headerMatches, map[string]interface{}{
+			"type":  "Exact",
+			"name":  header.Name,
+			"value": header.Value,
+		})
+	}
+
+	var matches []interface{}
+	if opts.Kind == RouteKindGRPC {
+		for _, method := range opts.Methods {
+			service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+			if helpers.IsBlank(service) {
+				return nil, fmt.Errorf("invalid grpc method: '%s'", method)
+			}
+			methodMatch := map[string]interface{}{
+				"type":    "Exact",
+				"service": service,
+			}
+			if !helpers.IsBlank(name) {
+				methodMatch["method"] = name
+			}
+			matches = append(matches, newRouteMatch("method", methodMatch, headerMatches))
+		}
+	} else {
+		for _, path := range opts.Paths {
+			pathType := "PathPrefix"
+			switch {
+			case strings.HasPrefix(path, "="):
+				pathType, path = "Exact", path[1:]
+			case strings.HasPrefix(path, "~"):
+				pathType, path = "RegularExpression", path[1:]
+			}
+			if !strings.HasPrefix(path, "/") {
+				return nil, fmt.Errorf("invalid path: '%s', it must start with /", path)
+			}
+			matches = append(matches, newRouteMatch("path", map[string]interface{}{
+				"type":  pathType,
+				"value": path,
+			}, headerMatches))
+		}
+	}
+
+	if len(matches) == 0 && len(headerMatches) > 0 {
+		matches = append(matches, map[string]interface{}{"headers": headerMatches})
+	}
+	return matches, nil
+}
+
+func newRouteMatch(key string, value map[string]interface{}, headerMatches []interface{}) map[string]interface{} {
+	match := map[string]interface{}{key: value}
+	if len(headerMatches) > 0 {
+		match["headers"] = headerMatches
+	}
+	return match
+}
+
+// newBackendRefs 未指定后端时转发到应用自身的 Service
+func newBackendRefs(opts RouteOptions) []interface{} {
+	backends := opts.Backends
+	if len(backends) == 0 {
+		backends = []RouteBackend{{}}
+	}
+
+	var backendRefs []interface{}
+	for _, backend := range backends {
+		service := backend.Service
+		if helpers.IsBlank(service) {
+			service = opts.Name
+		}
+		port := backend.Port
+		if port == 0 {
+			port = opts.Port
+		}
+		backendRef := map[string]interface{}{
+			"name": service,
+			"port": int64(port),
+		}
+		if backend.Weight != nil {
+			backendRef["weight"] = int64(*backend.Weight)
+		}
+		backendRefs = append(backendRefs, backendRef)
+	}
+	return backendRefs
+}
+
+// waitForRoute 轮询路由状态直到 Gateway 上报 Accepted 与 ResolvedRefs 均为 True
+func waitForRoute(dynamicClient dynamic.Interface, ctx context.Context, gvr schema.GroupVersionResource, opts RouteOptions) error {
+	resourceName := strings.TrimSuffix(gvr.Resource, "s")
+	for {
+		route, err := dynamicClient.Resource(gvr).Namespace(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get %s %s: %v", resourceName, opts.Name, err)
+		}
+
+		// 状态过期或条件尚未上报时继续等待
+		conditions := routeConditions(route, opts.Gateway)
+		ready := true
+		for _, conditionType := range []string{"Accepted", "ResolvedRefs"} {
+			condition, found := conditions[conditionType]
+			if !found || condition.ObservedGeneration < route.GetGeneration() {
+				ready = false
+				continue
+			}
+			if condition.Status == metav1.ConditionFalse {
+				return fmt.Errorf("%s %s is rejected by gateway %s, %s: %s", resourceName, opts.Name, opts.Gateway, condition.Reason, condition.Message)
+			}
+			if condition.Status != metav1.ConditionTrue {
+				ready = false
+			}
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for gateway %s to accept %s %s: %v", opts.Gateway, resourceName, opts.Name, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// routeConditions 返回路由在指定 Gateway 下的状态条件
+func routeConditions(route *unstructured.Unstructured, gateway string) map[string]metav1.Condition {
+	conditions := make(map[string]metav1.Condition)
+	parents, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, parent := range parents {
+		parentMap, ok := parent.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(parentMap, "parentRef", "name"); name != gateway {
+			continue
+		}
+		items, _, _ := unstructured.NestedSlice(parentMap, "conditions")
+		for _, item := range items {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var condition metav1.Condition
+			condition.Type, _, _ = unstructured.NestedString(itemMap, "type")
+			status, _, _ := unstructured.NestedString(itemMap, "status")
+			condition.Status = metav1.ConditionStatus(status)
+			condition.Reason, _, _ = unstructured.NestedString(itemMap, "reason")
+			condition.Message, _, _ = unstructured.NestedString(itemMap, "message")
+			condition.ObservedGeneration, _, _ = unstructured.NestedInt64(itemMap, "observedGeneration")
+			conditions[condition.Type] = condition
+		}
+	}
+	return conditions
+}
@@ -0,0 +1,178 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// newTestRouteClient 返回支持 Gateway 路由的 fake 动态客户端，写入的路由立即带上 gateway 上报的 ResolvedRefs 状态
+func newTestRouteClient(resolved metav1.ConditionStatus, reason string) *dynamicfake.FakeDynamicClient {
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		httpRouteGVR: "HTTPRouteList",
+		grpcRouteGVR: "GRPCRouteList",
+	})
+	setStatus := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		var route *unstructured.Unstructured
+		switch action := action.(type) {
+		case k8stesting.CreateAction:
+			route = action.GetObject().(*unstructured.Unstructured)
+		case k8stesting.UpdateAction:
+			route = action.GetObject().(*unstructured.Unstructured)
+		}
+		_ = unstructured.SetNestedSlice(route.Object, []interface{}{
+			map[string]interface{}{
+				"parentRef": map[string]interface{}{"name": "public"},
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Accepted", "status": "True", "reason": "Accepted"},
+					map[string]interface{}{"type": "ResolvedRefs", "status": string(resolved), "reason": reason, "message": "backend not found"},
+				},
+			},
+		}, "status", "parents")
+		return false, nil, nil
+	}
+	for _, verb := range []string{"create", "update"} {
+		dynamicClient.PrependReactor(verb, "httproutes", setStatus)
+		dynamicClient.PrependReactor(verb, "grpcroutes", setStatus)
+	}
+	return dynamicClient
+}
+
+func TestCreateOrUpdateRoute(t *testing.T) {
+	ctx := context.Background()
+	stableWeight, canaryWeight := int32(90), int32(10)
+	opts := RouteOptions{
+		Name:      "hellogo",
+		Namespace: testNamespace,
+		Port:      8000,
+		Kind:      RouteKindHTTP,
+		Gateway:   "public",
+		Hostnames: []string{"hellogo.com"},
+		Paths:     []string{"/api", "=/healthz"},
+		Headers:   []string{"x-canary: true"},
+		Backends:  []RouteBackend{{Weight: &stableWeight}, {Service: "hellogo-canary", Weight: &canaryWeight}},
+	}
+
+	dynamicClient := newTestRouteClient(metav1.ConditionTrue, "ResolvedRefs")
+	logs := &logRecorder{}
+	if err := CreateOrUpdateRoute(dynamicClient, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "httproute resource successfully created")
+	logs.assertContains(t, "accepted by gateway public")
+
+	route, err := dynamicClient.Resource(httpRouteGVR).Namespace(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+	if len(hostnames) != 1 || hostnames[0] != "hellogo.com" {
+		t.Errorf("expected hostname hellogo.com, got %v", hostnames)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	rule := rules[0].(map[string]interface{})
+	matches := rule["matches"].([]interface{})
+	if len(matches) != 2 {
+		t.Fatalf("expected 2 matches, got %v", matches)
+	}
+	if pathType, _, _ := unstructured.NestedString(matches[1].(map[string]interface{}), "path", "type"); pathType != "Exact" {
+		t.Errorf("expected exact match of /healthz, got %s", pathType)
+	}
+	if headers, _, _ := unstructured.NestedSlice(matches[0].(map[string]interface{}), "headers"); len(headers) != 1 {
+		t.Errorf("expected header match on every path, got %v", matches[0])
+	}
+	backendRefs := rule["backendRefs"].([]interface{})
+	canary := backendRefs[1].(map[string]interface{})
+	if canary["name"] != "hellogo-canary" || canary["port"] != int64(8000) || canary["weight"] != int64(10) {
+		t.Errorf("unexpected canary backend %v", canary)
+	}
+
+	if err := CreateOrUpdateRoute(dynamicClient, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "httproute resource successfully updated")
+}
+
+func TestNewBackendRefsWeights(t *testing.T) {
+	zero := int32(0)
+	opts := RouteOptions{Name: "hellogo", Port: 8000, Backends: []RouteBackend{{}, {Service: "hellogo-canary", Weight: &zero}}}
+	backendRefs := newBackendRefs(opts)
+	if _, ok := backendRefs[0].(map[string]interface{})["weight"]; ok {
+		t.Errorf("expected the default weight without a weight set, got %v", backendRefs[0])
+	}
+	if weight, ok := backendRefs[1].(map[string]interface{})["weight"]; !ok || weight != int64(0) {
+		t.Errorf("expected an explicit weight 0 to be written, got %v", backendRefs[1])
+	}
+}
+
+func TestCreateOrUpdateRouteRejected(t *testing.T) {
+	opts := RouteOptions{Name: "hellogo", Namespace: testNamespace, Port: 8000, Kind: RouteKindHTTP, Gateway: "public"}
+	dynamicClient := newTestRouteClient(metav1.ConditionFalse, "BackendNotFound")
+	assertErrorContains(t, CreateOrUpdateRoute(dynamicClient, context.Background(), opts, func(string) {}), "rejected by gateway public, BackendNotFound")
+}
+
+func TestCreateOrUpdateGRPCRoute(t *testing.T) {
+	ctx := context.Background()
+	opts := RouteOptions{
+		Name:      "hellogo",
+		Namespace: testNamespace,
+		Port:      8000,
+		Kind:      RouteKindGRPC,
+		Gateway:   "public",
+		Methods:   []string{"helloworld.Greeter/SayHello", "grpc.health.v1.Health"},
+	}
+
+	dynamicClient := newTestRouteClient(metav1.ConditionTrue, "ResolvedRefs")
+	logs := &logRecorder{}
+	if err := CreateOrUpdateRoute(dynamicClient, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "grpcroute resource successfully created")
+
+	route, err := dynamicClient.Resource(grpcRouteGVR).Namespace(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _, _ := unstructured.NestedSlice(route.Object, "spec", "rules")
+	matches := rules[0].(map[string]interface{})["matches"].([]interface{})
+	method, _, _ := unstructured.NestedStringMap(matches[0].(map[string]interface{}), "method")
+	if method["service"] != "helloworld.Greeter" || method["method"] != "SayHello" {
+		t.Errorf("unexpected method match %v", method)
+	}
+	if _, found, _ := unstructured.NestedString(matches[1].(map[string]interface{}), "method", "method"); found {
+		t.Errorf("expected a match on the whole service, got %v", matches[1])
+	}
+}
+
+func TestCreateOrUpdateRouteInvalidPath(t *testing.T) {
+	opts := RouteOptions{Name: "hellogo", Namespace: testNamespace, Kind: RouteKindHTTP, Gateway: "public", Paths: []string{"api"}}
+	assertErrorContains(t, CreateOrUpdateRoute(newTestRouteClient(metav1.ConditionTrue, ""), context.Background(), opts, func(string) {}), "it must start with /")
+}
+
+func TestDeleteIngress(t *testing.T) {
+	ctx := context.Background()
+	opts := IngressOptions{Name: "hellogo", Namespace: testNamespace}
+
+	clientset := fake.NewSimpleClientset(&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteIngress(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteIngress(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+
+	failOn(clientset, "delete", "ingresses")
+	assertErrorContains(t, DeleteIngress(clientset, ctx, opts, logs.handle), "failed to delete ingress resource")
+}
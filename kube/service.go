@@ -16,13 +16,25 @@ type ServiceOptions struct {
 	Namespace  string
 	Port       int32 `form:"port" json:"port"`
 	TargetPort int32
+	// MetricsPort 为独立于应用端口的指标端口，为 0 时不暴露
+	MetricsPort int32
+
+	// Enabled 为 false 时不创建 Service，适用于不对外提供服务的后台任务
+	Enabled bool `form:"enabled" json:"enabled"`
+
+	// App 为 Service 所属的应用，为空时取 Name；Component 标记应用的附属资源，如金丝雀的 Service
+	App       string
+	Component string
 }
 
-func CreateOrUpdateService(clientset *kubernetes.Clientset, ctx context.Context, opts ServiceOptions, logHandler func(msg string)) error {
+func CreateOrUpdateService(clientset kubernetes.Interface, ctx context.Context, opts ServiceOptions, logHandler func(msg string)) error {
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels: map[string]string{
+				"name": opts.Name,
+			},
 		},
 		Spec: corev1.ServiceSpec{
 			Type: corev1.ServiceTypeClusterIP,
@@ -38,11 +50,42 @@ func CreateOrUpdateService(clientset *kubernetes.Clientset, ctx context.Context,
 			},
 		},
 	}
+	app := opts.App
+	if app == "" {
+		app = opts.Name
+	}
+	for key, value := range componentLabels(app, opts.Component) {
+		service.Labels[key] = value
+	}
+
+	if opts.MetricsPort != 0 && opts.MetricsPort != opts.TargetPort {
+		service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+			Name:       "metrics",
+			Port:       opts.MetricsPort,
+			TargetPort: intstr.FromString("metrics"),
+		})
+	}
+	if err := setLastApplied(&service.ObjectMeta, service.Spec); err != nil {
+		return err
+	}
 
 	if _, err := clientset.CoreV1().Services(opts.Namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create service resource: %v", err)
 		}
+
+		// 在现有对象上合并，保留已分配的 ClusterIP 以及其他控制器写入的标签、注解，更新端口以暴露新增的指标端口
+		live, err := clientset.CoreV1().Services(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get service resource: %v", err)
+		}
+		mergeObjectMeta(&live.ObjectMeta, service.ObjectMeta)
+		live.Spec.Type = service.Spec.Type
+		live.Spec.Ports = service.Spec.Ports
+		live.Spec.Selector = service.Spec.Selector
+		if _, err := clientset.CoreV1().Services(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update service resource: %v", err)
+		}
 		logHandler("service resource successfully updated")
 	} else {
 		logHandler("service resource successfully created")
@@ -50,3 +93,73 @@ func CreateOrUpdateService(clientset *kubernetes.Clientset, ctx context.Context,
 
 	return nil
 }
+
+// CreateOrUpdateHeadlessService 为 StatefulSet 创建无头服务，使每个 Pod 拥有稳定的 DNS 名称
+func CreateOrUpdateHeadlessService(clientset kubernetes.Interface, ctx context.Context, opts ServiceOptions, logHandler func(msg string)) error {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      HeadlessServiceName(opts.Name),
+			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
+		},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeClusterIP,
+			ClusterIP: corev1.ClusterIPNone,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "app",
+					Port:       opts.Port,
+					TargetPort: intstr.FromInt32(opts.TargetPort),
+				},
+			},
+			Selector: map[string]string{
+				"name": opts.Name,
+			},
+			PublishNotReadyAddresses: true,
+		},
+	}
+
+	if _, err := clientset.CoreV1().Services(opts.Namespace).Create(ctx, service, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create headless service resource: %v", err)
+		}
+
+		// 在现有对象上合并，为之前版本创建或接管的 Service 加上标签，并更新端口
+		live, err := clientset.CoreV1().Services(opts.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get headless service resource: %v", err)
+		}
+		mergeObjectMeta(&live.ObjectMeta, service.ObjectMeta)
+		live.Spec.Ports = service.Spec.Ports
+		live.Spec.Selector = service.Spec.Selector
+		live.Spec.PublishNotReadyAddresses = service.Spec.PublishNotReadyAddresses
+		if _, err := clientset.CoreV1().Services(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update headless service resource: %v", err)
+		}
+		logHandler("headless service resource successfully updated")
+	} else {
+		logHandler("headless service resource successfully created")
+	}
+
+	return nil
+}
+
+func HeadlessServiceName(name string) string {
+	return name + "-headless"
+}
+
+// mergeObjectMeta 将期望的标签与注解写到现有对象上，不删除其他控制器写入的
+func mergeObjectMeta(live *metav1.ObjectMeta, desired metav1.ObjectMeta) {
+	if live.Labels == nil {
+		live.Labels = make(map[string]string)
+	}
+	for key, value := range desired.Labels {
+		live.Labels[key] = value
+	}
+	if live.Annotations == nil {
+		live.Annotations = make(map[string]string)
+	}
+	for key, value := range desired.Annotations {
+		live.Annotations[key] = value
+	}
+}
@@ -0,0 +1,112 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateService(t *testing.T) {
+	ctx := context.Background()
+	opts := ServiceOptions{Name: "hellogo", Namespace: testNamespace, Port: 8000, TargetPort: 8080}
+
+	t.Run("create", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		logs := &logRecorder{}
+		if err := CreateOrUpdateService(clientset, ctx, opts, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		service, err := clientset.CoreV1().Services(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if service.Spec.Selector["name"] != "hellogo" {
+			t.Errorf("expected selector name=hellogo, got %v", service.Spec.Selector)
+		}
+		if service.Spec.Ports[0].TargetPort.IntValue() != 8080 {
+			t.Errorf("expected target port 8080, got %s", service.Spec.Ports[0].TargetPort.String())
+		}
+		logs.assertContains(t, "successfully created")
+	})
+
+	t.Run("already exists", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset(&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "hellogo",
+				Namespace:   testNamespace,
+				Labels:      map[string]string{"team": "web"},
+				Annotations: map[string]string{"cloud.google.com/neg": `{"ingress":true}`},
+			},
+			Spec: corev1.ServiceSpec{ClusterIP: "10.96.0.10", SessionAffinity: corev1.ServiceAffinityClientIP},
+		})
+		logs := &logRecorder{}
+		metricsOpts := opts
+		metricsOpts.MetricsPort = 9090
+		if err := CreateOrUpdateService(clientset, ctx, metricsOpts, logs.handle); err != nil {
+			t.Fatal(err)
+		}
+		service, err := clientset.CoreV1().Services(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if service.Spec.ClusterIP != "10.96.0.10" {
+			t.Errorf("expected cluster ip to be kept, got %s", service.Spec.ClusterIP)
+		}
+		if service.Spec.SessionAffinity != corev1.ServiceAffinityClientIP {
+			t.Errorf("expected the session affinity to be kept, got %s", service.Spec.SessionAffinity)
+		}
+		if service.Labels["team"] != "web" || service.Labels[AppLabel] != "hellogo" {
+			t.Errorf("expected the owner labels merged onto the existing ones, got %v", service.Labels)
+		}
+		if service.Annotations["cloud.google.com/neg"] == "" || service.Annotations[LastAppliedAnnotation] == "" {
+			t.Errorf("expected the annotations of other controllers to be kept, got %v", service.Annotations)
+		}
+		if len(service.Spec.Ports) != 2 || service.Spec.Ports[1].Name != "metrics" || service.Spec.Ports[1].Port != 9090 {
+			t.Errorf("expected a metrics port 9090, got %v", service.Spec.Ports)
+		}
+		logs.assertContains(t, "successfully updated")
+	})
+
+	t.Run("create fails", func(t *testing.T) {
+		clientset := fake.NewSimpleClientset()
+		failOn(clientset, "create", "services")
+		err := CreateOrUpdateService(clientset, ctx, opts, func(string) {})
+		assertErrorContains(t, err, "failed to create service resource")
+	})
+}
+
+func TestCreateOrUpdateHeadlessService(t *testing.T) {
+	ctx := context.Background()
+	opts := ServiceOptions{Name: "hellogo", Namespace: testNamespace, Port: 8000, TargetPort: 8080}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateHeadlessService(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	service, err := clientset.CoreV1().Services(testNamespace).Get(ctx, HeadlessServiceName("hellogo"), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.Spec.ClusterIP != corev1.ClusterIPNone {
+		t.Errorf("expected headless service, got cluster ip %s", service.Spec.ClusterIP)
+	}
+	logs.assertContains(t, "successfully created")
+
+	// 之前版本创建的无标签 Service 被加上标签并更新端口
+	clientset = fake.NewSimpleClientset(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: HeadlessServiceName("hellogo"), Namespace: testNamespace},
+		Spec:       corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, Ports: []corev1.ServicePort{{Name: "app", Port: 80}}},
+	})
+	if err := CreateOrUpdateHeadlessService(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully updated")
+	service, _ = clientset.CoreV1().Services(testNamespace).Get(ctx, HeadlessServiceName("hellogo"), metav1.GetOptions{})
+	if service.Labels[AppLabel] != "hellogo" || service.Spec.Ports[0].Port != 8000 || service.Spec.ClusterIP != corev1.ClusterIPNone {
+		t.Errorf("expected the existing headless service to be labeled and updated, got %+v", service)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -13,25 +14,43 @@ import (
 type ServiceAccountOptions struct {
 	Name      string
 	Namespace string
+	// ImagePullSecrets 为 Pod 拉取镜像使用的 Secret，已存在的 ServiceAccount 会同步为该列表
+	ImagePullSecrets []string
+
+	// Enabled 为 false 时不创建应用的 ServiceAccount，Pod 使用命名空间的 default
+	Enabled bool `form:"enabled" json:"enabled"`
 }
 
-func CreateOrUpdateServiceAccount(clientset *kubernetes.Clientset, ctx context.Context, opts ServiceAccountOptions, logHandler func(msg string)) error {
+func CreateOrUpdateServiceAccount(clientset kubernetes.Interface, ctx context.Context, opts ServiceAccountOptions, logHandler func(msg string)) error {
+	imagePullSecrets := localObjectReferences(opts.ImagePullSecrets)
+
 	serviceAccount := &corev1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      opts.Name,
 			Namespace: opts.Namespace,
+			Labels:    ownerLabels(opts.Name),
 		},
-		ImagePullSecrets: []corev1.LocalObjectReference{
-			{
-				Name: "docker-" + opts.Name,
-			},
-		},
+		ImagePullSecrets: imagePullSecrets,
 	}
 
 	if _, err := clientset.CoreV1().ServiceAccounts(opts.Namespace).Create(ctx, serviceAccount, metav1.CreateOptions{}); err != nil {
 		if !apierrors.IsAlreadyExists(err) {
 			return fmt.Errorf("failed to create serviceaccount resource: %v", err)
 		}
+
+		live, err := clientset.CoreV1().ServiceAccounts(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get serviceaccount resource: %v", err)
+		}
+		labeled := setOwnerLabels(&live.ObjectMeta, opts.Name)
+		if !labeled && equality.Semantic.DeepEqual(live.ImagePullSecrets, imagePullSecrets) {
+			logHandler("serviceaccount resource unchanged")
+			return nil
+		}
+		live.ImagePullSecrets = imagePullSecrets
+		if _, err := clientset.CoreV1().ServiceAccounts(opts.Namespace).Update(ctx, live, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update serviceaccount resource: %v", err)
+		}
 		logHandler("serviceaccount resource successfully updated")
 	} else {
 		logHandler("serviceaccount resource successfully created")
@@ -39,3 +58,14 @@ func CreateOrUpdateServiceAccount(clientset *kubernetes.Clientset, ctx context.C
 
 	return nil
 }
+
+// localObjectReferences 将 Secret 名称转换为 ServiceAccount 与 Pod 引用 pull secret 的形式
+func localObjectReferences(names []string) []corev1.LocalObjectReference {
+	var refs []corev1.LocalObjectReference
+	for _, name := range names {
+		refs = append(refs, corev1.LocalObjectReference{
+			Name: name,
+		})
+	}
+	return refs
+}
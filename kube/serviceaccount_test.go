@@ -0,0 +1,48 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateServiceAccount(t *testing.T) {
+	ctx := context.Background()
+	opts := ServiceAccountOptions{Name: "hellogo", Namespace: testNamespace, ImagePullSecrets: []string{"docker-hellogo"}}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateServiceAccount(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	serviceAccount, err := clientset.CoreV1().ServiceAccounts(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serviceAccount.ImagePullSecrets) != 1 || serviceAccount.ImagePullSecrets[0].Name != "docker-hellogo" {
+		t.Errorf("expected image pull secret docker-hellogo, got %v", serviceAccount.ImagePullSecrets)
+	}
+	logs.assertContains(t, "successfully created")
+
+	if err := CreateOrUpdateServiceAccount(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "unchanged")
+
+	// 同步 imagePullSecrets
+	opts.ImagePullSecrets = []string{"regcred"}
+	if err := CreateOrUpdateServiceAccount(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	serviceAccount, _ = clientset.CoreV1().ServiceAccounts(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if len(serviceAccount.ImagePullSecrets) != 1 || serviceAccount.ImagePullSecrets[0].Name != "regcred" {
+		t.Errorf("expected image pull secrets to be synced to regcred, got %v", serviceAccount.ImagePullSecrets)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	failing := fake.NewSimpleClientset()
+	failOn(failing, "create", "serviceaccounts")
+	assertErrorContains(t, CreateOrUpdateServiceAccount(failing, ctx, opts, func(string) {}), "failed to create serviceaccount resource")
+}
@@ -0,0 +1,164 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// snapshotTimeout 为等待 VolumeSnapshot 就绪的最长时间
+const snapshotTimeout = 5 * time.Minute
+
+var volumeSnapshotGVR = schema.GroupVersionResource{
+	Group:    "snapshot.storage.k8s.io",
+	Version:  "v1",
+	Resource: "volumesnapshots",
+}
+
+// RestoreOptions 用于从 VolumeSnapshot 恢复出一个新的 PVC
+type RestoreOptions struct {
+	Name             string
+	Namespace        string
+	SnapshotName     string
+	AccessMode       string
+	StorageClassName string
+	StorageSize      string
+
+	// App 为 PVC 所属的应用，为空时取 Name；恢复到其他名称时仍归属于原应用
+	App string
+}
+
+// CreateVolumeSnapshot 为 PVC 创建 CSI 快照并等待其可用，返回快照名称
+func CreateVolumeSnapshot(dynamicClient dynamic.Interface, ctx context.Context, pvcName, namespace, snapshotClassName string, logHandler func(msg string)) (string, error) {
+	name := fmt.Sprintf("%s-%d", pvcName, time.Now().Unix())
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvcName,
+		},
+	}
+	if !helpers.IsBlank(snapshotClassName) {
+		spec["volumeSnapshotClassName"] = snapshotClassName
+	}
+
+	snapshot := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": namespace,
+			},
+			"spec": spec,
+		},
+	}
+
+	if _, err := dynamicClient.Resource(volumeSnapshotGVR).Namespace(namespace).Create(ctx, snapshot, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("failed to create volumesnapshot resource: %v", err)
+	}
+	logHandler(fmt.Sprintf("volumesnapshot %s of pvc %s created, waiting for it to be ready...", name, pvcName))
+
+	waitCtx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+	if _, err := waitForVolumeSnapshot(dynamicClient, waitCtx, name, namespace); err != nil {
+		return "", err
+	}
+
+	logHandler(fmt.Sprintf("volumesnapshot %s is ready to use", name))
+	return name, nil
+}
+
+// waitForVolumeSnapshot 轮询快照状态直到 readyToUse，返回快照的恢复大小
+func waitForVolumeSnapshot(dynamicClient dynamic.Interface, ctx context.Context, name, namespace string) (string, error) {
+	for {
+		snapshot, err := dynamicClient.Resource(volumeSnapshotGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get volumesnapshot %s: %v", name, err)
+		}
+
+		if message, found, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message"); found {
+			return "", fmt.Errorf("volumesnapshot %s failed: %s", name, message)
+		}
+		if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); ready {
+			restoreSize, _, _ := unstructured.NestedString(snapshot.Object, "status", "restoreSize")
+			return restoreSize, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("timed out waiting for volumesnapshot %s: %v", name, ctx.Err())
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// RestorePVC 以 VolumeSnapshot 为数据源创建 PVC，已存在同名 PVC 时拒绝覆盖
+func RestorePVC(clientset kubernetes.Interface, dynamicClient dynamic.Interface, ctx context.Context, opts RestoreOptions, logHandler func(msg string)) error {
+	waitCtx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+	restoreSize, err := waitForVolumeSnapshot(dynamicClient, waitCtx, opts.SnapshotName, opts.Namespace)
+	if err != nil {
+		return err
+	}
+
+	storageSize := opts.StorageSize
+	if helpers.IsBlank(storageSize) {
+		storageSize = restoreSize
+	}
+	if helpers.IsBlank(storageSize) {
+		return fmt.Errorf("restore size of volumesnapshot %s is unknown, storage size is required", opts.SnapshotName)
+	}
+
+	spec, err := newPVCSpec(opts.AccessMode, opts.StorageClassName, storageSize)
+	if err != nil {
+		return fmt.Errorf("invalid pvc %s: %v", opts.Name, err)
+	}
+
+	// 恢复出的卷不能小于快照大小
+	if !helpers.IsBlank(restoreSize) {
+		if size, err := resource.ParseQuantity(restoreSize); err == nil && spec.Resources.Requests.Storage().Cmp(size) < 0 {
+			return fmt.Errorf("storage size %s is smaller than restore size %s of volumesnapshot %s", storageSize, restoreSize, opts.SnapshotName)
+		}
+	}
+
+	apiGroup := volumeSnapshotGVR.Group
+	spec.DataSource = &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     "VolumeSnapshot",
+		Name:     opts.SnapshotName,
+	}
+
+	app := opts.App
+	if app == "" {
+		app = opts.Name
+	}
+
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    ownerLabels(app),
+		},
+		Spec: spec,
+	}
+
+	if _, err := clientset.CoreV1().PersistentVolumeClaims(opts.Namespace).Create(ctx, pvc, metav1.CreateOptions{}); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("pvc %s already exists in namespace %s, delete it or restore to another name", opts.Name, opts.Namespace)
+		}
+		return fmt.Errorf("failed to create pvc resource: %v", err)
+	}
+
+	logHandler(fmt.Sprintf("pvc %s successfully restored from volumesnapshot %s", opts.Name, opts.SnapshotName))
+	return nil
+}
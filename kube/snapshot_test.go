@@ -0,0 +1,72 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestVolumeSnapshot(name string, status map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "snapshot.storage.k8s.io/v1",
+			"kind":       "VolumeSnapshot",
+			"metadata": map[string]interface{}{
+				"name":      name,
+				"namespace": testNamespace,
+			},
+			"status": status,
+		},
+	}
+}
+
+func TestRestorePVC(t *testing.T) {
+	ctx := context.Background()
+	snapshot := newTestVolumeSnapshot("hellogo-1700000000", map[string]interface{}{
+		"readyToUse":  true,
+		"restoreSize": "2Gi",
+	})
+	opts := RestoreOptions{Name: "hellogo", Namespace: testNamespace, SnapshotName: snapshot.GetName()}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := RestorePVC(clientset, newTestDynamicClient(snapshot), ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	pvc, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pvc.Spec.DataSource == nil || pvc.Spec.DataSource.Name != snapshot.GetName() {
+		t.Errorf("expected pvc restored from %s, got %v", snapshot.GetName(), pvc.Spec.DataSource)
+	}
+	if size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; size.String() != "2Gi" {
+		t.Errorf("expected storage size to default to restore size 2Gi, got %s", size.String())
+	}
+	if app, managed := ownerOf(pvc); app != "hellogo" || !managed {
+		t.Errorf("expected restored pvc to be owned by hellogo, got labels %v", pvc.Labels)
+	}
+	logs.assertContains(t, "successfully restored")
+
+	// 不覆盖已存在的 PVC
+	err = RestorePVC(clientset, newTestDynamicClient(snapshot), ctx, opts, logs.handle)
+	assertErrorContains(t, err, "already exists")
+
+	opts.Name = "hellogo-small"
+	opts.StorageSize = "1Gi"
+	err = RestorePVC(clientset, newTestDynamicClient(snapshot), ctx, opts, logs.handle)
+	assertErrorContains(t, err, "smaller than restore size")
+}
+
+func TestRestorePVCFromFailedSnapshot(t *testing.T) {
+	snapshot := newTestVolumeSnapshot("hellogo-1700000000", map[string]interface{}{
+		"error": map[string]interface{}{"message": "driver does not support snapshots"},
+	})
+	opts := RestoreOptions{Name: "hellogo", Namespace: testNamespace, SnapshotName: snapshot.GetName()}
+	err := RestorePVC(fake.NewSimpleClientset(), newTestDynamicClient(snapshot), context.Background(), opts, func(string) {})
+	assertErrorContains(t, err, "driver does not support snapshots")
+}
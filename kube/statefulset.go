@@ -0,0 +1,144 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	PodManagementPolicyOrderedReady = "orderedready"
+	PodManagementPolicyParallel     = "parallel"
+)
+
+// StatefulSetOptions 用于配置 StatefulSet 创建或更新的选项
+type StatefulSetOptions struct {
+	PodManagementPolicy string `form:"podmanagementpolicy" json:"podmanagementpolicy"`
+	ServiceName         string
+	DeploymentOptions   DeploymentOptions
+	PVCOptions          PVCOptions
+}
+
+func CreateOrUpdateStatefulSet(clientset kubernetes.Interface, ctx context.Context, opts StatefulSetOptions, logHandler func(msg string)) error {
+	statefulSet, err := newStatefulSet(opts)
+	if err != nil {
+		return err
+	}
+	if err := setLastApplied(&statefulSet.ObjectMeta, statefulSet.Spec); err != nil {
+		return err
+	}
+
+	if _, err := clientset.AppsV1().StatefulSets(statefulSet.Namespace).Create(ctx, statefulSet, metav1.CreateOptions{}); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create statefulset resource: %v", err)
+		}
+		logHandler("statefulset resource already exists, attempting update...")
+		if _, err := clientset.AppsV1().StatefulSets(statefulSet.Namespace).Update(ctx, statefulSet, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update statefulset resource: %v", err)
+		}
+		logHandler("statefulset resource successfully updated")
+	} else {
+		logHandler("statefulset resource successfully created")
+	}
+
+	return nil
+}
+
+// newStatefulSet 构造期望的 StatefulSet，发布计划也用它来比对不可变字段
+func newStatefulSet(opts StatefulSetOptions) (*appsv1.StatefulSet, error) {
+	podManagementPolicy, err := convertPodManagementPolicy(opts.PodManagementPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	template, err := newPodTemplateSpec(opts.DeploymentOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.DeploymentOptions.Name,
+			Namespace: opts.DeploymentOptions.Namespace,
+			Labels:    ownerLabels(opts.DeploymentOptions.Name),
+		},
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:            &opts.DeploymentOptions.Replicas,
+			ServiceName:         opts.ServiceName,
+			PodManagementPolicy: podManagementPolicy,
+			UpdateStrategy: appsv1.StatefulSetUpdateStrategy{
+				Type: appsv1.RollingUpdateStatefulSetStrategyType,
+			},
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					"name": opts.DeploymentOptions.Name,
+				},
+			},
+			Template:        template,
+			MinReadySeconds: opts.DeploymentOptions.MinReadySeconds,
+		},
+	}
+	if opts.DeploymentOptions.RevisionHistoryLimit > 0 {
+		statefulSet.Spec.RevisionHistoryLimit = &opts.DeploymentOptions.RevisionHistoryLimit
+	}
+
+	// 每个副本通过 volumeClaimTemplates 获得独立的 PVC，命名为 data-<name>-<ordinal>
+	if opts.DeploymentOptions.VolumeMount.Enabled {
+		spec, err := newPVCSpec(opts.PVCOptions.AccessMode, opts.PVCOptions.StorageClassName, opts.PVCOptions.StorageSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume claim template: %v", err)
+		}
+
+		statefulSet.Spec.VolumeClaimTemplates = append(statefulSet.Spec.VolumeClaimTemplates, corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "data",
+			},
+			Spec: spec,
+		})
+
+		statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts = append(statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "data",
+			MountPath: opts.DeploymentOptions.VolumeMount.MountPath,
+		})
+	}
+
+	claimTemplates, err := setVolumes(&statefulSet.Spec.Template, opts.DeploymentOptions, true)
+	if err != nil {
+		return nil, err
+	}
+	statefulSet.Spec.VolumeClaimTemplates = append(statefulSet.Spec.VolumeClaimTemplates, claimTemplates...)
+
+	return statefulSet, nil
+}
+
+func DeleteStatefulSet(clientset kubernetes.Interface, ctx context.Context, opts StatefulSetOptions, logHandler func(msg string)) error {
+	name := opts.DeploymentOptions.Name
+	namespace := opts.DeploymentOptions.Namespace
+	err := clientset.AppsV1().StatefulSets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete statefulset resource: %v", err)
+	}
+	if apierrors.IsNotFound(err) {
+		logHandler(fmt.Sprintf("statefulset resource %s in namespace %s not found, no action taken\n", name, namespace))
+	} else {
+		logHandler(fmt.Sprintf("statefulset resource %s in namespace %s successfully deleted\n", name, namespace))
+	}
+	return nil
+}
+
+func convertPodManagementPolicy(v string) (appsv1.PodManagementPolicyType, error) {
+	switch strings.ToLower(v) {
+	case "", PodManagementPolicyOrderedReady:
+		return appsv1.OrderedReadyPodManagement, nil
+	case PodManagementPolicyParallel:
+		return appsv1.ParallelPodManagement, nil
+	default:
+		return "", fmt.Errorf("unsupported pod management policy: '%s'", v)
+	}
+}
@@ -0,0 +1,69 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateStatefulSet(t *testing.T) {
+	ctx := context.Background()
+	deploymentOptions := newTestDeploymentOptions()
+	deploymentOptions.VolumeMount = VolumeMount{Enabled: true, MountPath: "/data"}
+	opts := StatefulSetOptions{
+		PodManagementPolicy: "Parallel",
+		ServiceName:         HeadlessServiceName("hellogo"),
+		DeploymentOptions:   deploymentOptions,
+		PVCOptions:          PVCOptions{AccessMode: "readwriteonce", StorageSize: "1Gi"},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	logs := &logRecorder{}
+	if err := CreateOrUpdateStatefulSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	statefulSet, err := clientset.AppsV1().StatefulSets(testNamespace).Get(ctx, "hellogo", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statefulSet.Spec.PodManagementPolicy != appsv1.ParallelPodManagement {
+		t.Errorf("expected parallel pod management, got %s", statefulSet.Spec.PodManagementPolicy)
+	}
+	if len(statefulSet.Spec.VolumeClaimTemplates) != 1 || statefulSet.Spec.VolumeClaimTemplates[0].Name != "data" {
+		t.Errorf("expected a data volume claim template, got %v", statefulSet.Spec.VolumeClaimTemplates)
+	}
+	logs.assertContains(t, "successfully created")
+
+	if err := CreateOrUpdateStatefulSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully updated")
+
+	opts.PodManagementPolicy = "random"
+	if err := CreateOrUpdateStatefulSet(clientset, ctx, opts, logs.handle); err == nil {
+		t.Error("expected an error for unsupported pod management policy")
+	}
+}
+
+func TestDeleteStatefulSet(t *testing.T) {
+	ctx := context.Background()
+	opts := StatefulSetOptions{DeploymentOptions: DeploymentOptions{Name: "hellogo", Namespace: testNamespace}}
+
+	clientset := fake.NewSimpleClientset(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "hellogo", Namespace: testNamespace}})
+	logs := &logRecorder{}
+	if err := DeleteStatefulSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "successfully deleted")
+
+	if err := DeleteStatefulSet(clientset, ctx, opts, logs.handle); err != nil {
+		t.Fatal(err)
+	}
+	logs.assertContains(t, "not found, no action taken")
+
+	failOn(clientset, "delete", "statefulsets")
+	assertErrorContains(t, DeleteStatefulSet(clientset, ctx, opts, logs.handle), "failed to delete statefulset resource")
+}
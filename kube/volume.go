@@ -0,0 +1,241 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/guobinqiu/appdeployer/helpers"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	VolumeTypePVC       = "pvc"
+	VolumeTypeEmptyDir  = "emptydir"
+	VolumeTypeClaim     = "claim"
+	VolumeTypeHostPath  = "hostpath"
+	VolumeTypeNFS       = "nfs"
+	VolumeTypeConfigMap = "configmap"
+	VolumeTypeSecret    = "secret"
+)
+
+// Volume 描述挂载到应用容器中的一个卷
+type Volume struct {
+	Name      string `form:"name" json:"name"`
+	Type      string `form:"type" json:"type"`
+	MountPath string `form:"mountpath" json:"mountpath"`
+	SubPath   string `form:"subpath" json:"subpath"`
+	ReadOnly  bool   `form:"readonly" json:"readonly"`
+
+	// pvc 类型，为每个卷创建名为 <app>-<name> 的 PVC
+	AccessMode       string `form:"accessmode" json:"accessmode"`
+	StorageClassName string `form:"storageclassname" json:"storageclassname"`
+	StorageSize      string `form:"storagesize" json:"storagesize"`
+
+	// emptydir 类型，medium 为 memory 时使用内存作为存储介质
+	Medium    string `form:"medium" json:"medium"`
+	SizeLimit string `form:"sizelimit" json:"sizelimit"`
+
+	// claim 类型，引用已存在的 PVC
+	ClaimName string `form:"claimname" json:"claimname"`
+
+	// hostpath 与 nfs 类型
+	Server string `form:"server" json:"server"`
+	Path   string `form:"path" json:"path"`
+
+	// configmap 与 secret 类型
+	ConfigMapName string `form:"configmapname" json:"configmapname"`
+	SecretName    string `form:"secretname" json:"secretname"`
+}
+
+// VolumePVCName 返回 pvc 类型卷对应的 PVC 名称
+func VolumePVCName(app string, volume Volume) string {
+	return fmt.Sprintf("%s-%s", app, volume.Name)
+}
+
+// CreateOrUpdateVolumePVCs 为所有 pvc 类型的卷创建 PVC
+func CreateOrUpdateVolumePVCs(clientset kubernetes.Interface, ctx context.Context, opts DeploymentOptions, logHandler func(msg string)) error {
+	for _, volume := range opts.Volumes {
+		if strings.ToLower(volume.Type) != VolumeTypePVC {
+			continue
+		}
+		if err := CreateOrUpdatePVC(clientset, ctx, PVCOptions{
+			Name:             VolumePVCName(opts.Name, volume),
+			Namespace:        opts.Namespace,
+			AccessMode:       volume.AccessMode,
+			StorageClassName: volume.StorageClassName,
+			StorageSize:      volume.StorageSize,
+			App:              opts.Name,
+		}, logHandler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setVolumes 将卷及其挂载点加入 Pod 模板。
+// withClaimTemplates 为 true 时（StatefulSet）pvc 类型的卷改为返回 volumeClaimTemplates，每个副本独享一份
+func setVolumes(template *corev1.PodTemplateSpec, opts DeploymentOptions, withClaimTemplates bool) ([]corev1.PersistentVolumeClaim, error) {
+	var claimTemplates []corev1.PersistentVolumeClaim
+
+	// 应用 PVC（data）与宿主机目录（hostpath-N）占用的名称不能再使用。
+	// data 即使未开启 volumemount 也保留，否则发布计划会把同名卷的 PVC 当作应用 PVC 删除
+	reserved := map[string]bool{"data": true}
+	for _, volume := range template.Spec.Volumes {
+		reserved[volume.Name] = true
+	}
+	for _, mount := range template.Spec.Containers[0].VolumeMounts {
+		reserved[mount.Name] = true
+	}
+	names := make(map[string]bool)
+
+	for _, volume := range opts.Volumes {
+		if err := validateVolume(volume); err != nil {
+			return nil, err
+		}
+		if reserved[volume.Name] {
+			return nil, fmt.Errorf("volume name '%s' is reserved for kube.deployment.volumemount or kube.daemonset.hostpaths", volume.Name)
+		}
+		if names[volume.Name] {
+			return nil, fmt.Errorf("duplicate volume name: '%s'", volume.Name)
+		}
+		names[volume.Name] = true
+
+		template.Spec.Containers[0].VolumeMounts = append(template.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: volume.MountPath,
+			SubPath:   volume.SubPath,
+			ReadOnly:  volume.ReadOnly,
+		})
+
+		if strings.ToLower(volume.Type) == VolumeTypePVC && withClaimTemplates {
+			spec, err := newPVCSpec(volume.AccessMode, volume.StorageClassName, volume.StorageSize)
+			if err != nil {
+				return nil, fmt.Errorf("invalid volume '%s': %v", volume.Name, err)
+			}
+			claimTemplates = append(claimTemplates, corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: volume.Name,
+				},
+				Spec: spec,
+			})
+			continue
+		}
+
+		source, err := newVolumeSource(opts.Name, volume)
+		if err != nil {
+			return nil, fmt.Errorf("invalid volume '%s': %v", volume.Name, err)
+		}
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name:         volume.Name,
+			VolumeSource: source,
+		})
+	}
+
+	return claimTemplates, nil
+}
+
+func validateVolume(volume Volume) error {
+	if errs := validation.IsDNS1123Label(volume.Name); len(errs) > 0 {
+		return fmt.Errorf("invalid volume name '%s': %s", volume.Name, strings.Join(errs, ", "))
+	}
+	if helpers.IsBlank(volume.MountPath) {
+		return fmt.Errorf("mountpath of volume '%s' is required", volume.Name)
+	}
+
+	var required map[string]string
+	switch strings.ToLower(volume.Type) {
+	case VolumeTypePVC:
+		required = map[string]string{"storagesize": volume.StorageSize}
+	case VolumeTypeEmptyDir:
+	case VolumeTypeClaim:
+		required = map[string]string{"claimname": volume.ClaimName}
+	case VolumeTypeHostPath:
+		required = map[string]string{"path": volume.Path}
+	case VolumeTypeNFS:
+		required = map[string]string{"server": volume.Server, "path": volume.Path}
+	case VolumeTypeConfigMap:
+		required = map[string]string{"configmapname": volume.ConfigMapName}
+	case VolumeTypeSecret:
+		required = map[string]string{"secretname": volume.SecretName}
+	default:
+		return fmt.Errorf("unsupported type of volume '%s': '%s'", volume.Name, volume.Type)
+	}
+
+	for field, value := range required {
+		if helpers.IsBlank(value) {
+			return fmt.Errorf("%s of volume '%s' is required", field, volume.Name)
+		}
+	}
+	return nil
+}
+
+func newVolumeSource(app string, volume Volume) (corev1.VolumeSource, error) {
+	switch strings.ToLower(volume.Type) {
+	case VolumeTypePVC:
+		return corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: VolumePVCName(app, volume),
+				ReadOnly:  volume.ReadOnly,
+			},
+		}, nil
+	case VolumeTypeEmptyDir:
+		emptyDir := &corev1.EmptyDirVolumeSource{}
+		switch strings.ToLower(volume.Medium) {
+		case "":
+		case "memory":
+			emptyDir.Medium = corev1.StorageMediumMemory
+		default:
+			return corev1.VolumeSource{}, fmt.Errorf("unsupported emptydir medium: '%s'", volume.Medium)
+		}
+		if !helpers.IsBlank(volume.SizeLimit) {
+			sizeLimit, err := resource.ParseQuantity(volume.SizeLimit)
+			if err != nil {
+				return corev1.VolumeSource{}, fmt.Errorf("invalid size limit '%s': %v", volume.SizeLimit, err)
+			}
+			emptyDir.SizeLimit = &sizeLimit
+		}
+		return corev1.VolumeSource{EmptyDir: emptyDir}, nil
+	case VolumeTypeClaim:
+		return corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: volume.ClaimName,
+				ReadOnly:  volume.ReadOnly,
+			},
+		}, nil
+	case VolumeTypeHostPath:
+		return corev1.VolumeSource{
+			HostPath: &corev1.HostPathVolumeSource{
+				Path: volume.Path,
+			},
+		}, nil
+	case VolumeTypeNFS:
+		return corev1.VolumeSource{
+			NFS: &corev1.NFSVolumeSource{
+				Server:   volume.Server,
+				Path:     volume.Path,
+				ReadOnly: volume.ReadOnly,
+			},
+		}, nil
+	case VolumeTypeConfigMap:
+		return corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{
+					Name: volume.ConfigMapName,
+				},
+			},
+		}, nil
+	case VolumeTypeSecret:
+		return corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: volume.SecretName,
+			},
+		}, nil
+	default:
+		return corev1.VolumeSource{}, fmt.Errorf("unsupported volume type: '%s'", volume.Type)
+	}
+}
@@ -0,0 +1,108 @@
+package kube
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateOrUpdateVolumePVCs(t *testing.T) {
+	ctx := context.Background()
+	opts := newTestDeploymentOptions()
+	opts.Volumes = []Volume{
+		{Name: "uploads", Type: "PVC", MountPath: "/uploads", StorageSize: "5Gi"},
+		{Name: "cache", Type: VolumeTypeEmptyDir, MountPath: "/cache"},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	if err := CreateOrUpdateVolumePVCs(clientset, ctx, opts, func(string) {}); err != nil {
+		t.Fatal(err)
+	}
+	pvcs, err := clientset.CoreV1().PersistentVolumeClaims(testNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pvcs.Items) != 1 || pvcs.Items[0].Name != "hellogo-uploads" {
+		t.Errorf("expected only pvc hellogo-uploads, got %v", pvcs.Items)
+	}
+}
+
+func TestSetVolumes(t *testing.T) {
+	opts := newTestDeploymentOptions()
+	opts.Volumes = []Volume{
+		{Name: "uploads", Type: VolumeTypePVC, MountPath: "/uploads", StorageSize: "5Gi"},
+		{Name: "cache", Type: VolumeTypeEmptyDir, MountPath: "/cache", Medium: "memory", SizeLimit: "64Mi"},
+		{Name: "config", Type: VolumeTypeConfigMap, MountPath: "/etc/hellogo", ConfigMapName: "hellogo", ReadOnly: true},
+	}
+
+	template, err := newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claimTemplates, err := setVolumes(&template, opts, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimTemplates) != 0 || len(template.Spec.Volumes) != 3 {
+		t.Fatalf("expected 3 pod volumes, got %v", template.Spec.Volumes)
+	}
+	if template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName != "hellogo-uploads" {
+		t.Errorf("expected claim hellogo-uploads, got %s", template.Spec.Volumes[0].PersistentVolumeClaim.ClaimName)
+	}
+	if template.Spec.Volumes[1].EmptyDir.Medium != corev1.StorageMediumMemory {
+		t.Errorf("expected memory medium, got %s", template.Spec.Volumes[1].EmptyDir.Medium)
+	}
+
+	// StatefulSet 的 pvc 卷改为 volumeClaimTemplates
+	template, _ = newPodTemplateSpec(opts)
+	claimTemplates, err = setVolumes(&template, opts, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimTemplates) != 1 || len(template.Spec.Volumes) != 2 {
+		t.Errorf("expected 1 claim template and 2 pod volumes, got %v and %v", claimTemplates, template.Spec.Volumes)
+	}
+
+	for name, volume := range map[string]Volume{
+		"duplicate":        {Name: "cache", Type: VolumeTypeEmptyDir, MountPath: "/tmp"},
+		"invalid name":     {Name: "Cache_Dir", Type: VolumeTypeEmptyDir, MountPath: "/tmp"},
+		"missing server":   {Name: "shared", Type: VolumeTypeNFS, MountPath: "/shared", Path: "/exports"},
+		"unsupported type": {Name: "other", Type: "iscsi", MountPath: "/other"},
+	} {
+		invalid := opts
+		invalid.Volumes = append(append([]Volume{}, opts.Volumes...), volume)
+		template, _ := newPodTemplateSpec(invalid)
+		if _, err := setVolumes(&template, invalid, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSetVolumesRejectsReservedNames(t *testing.T) {
+	opts := newTestDeploymentOptions()
+	opts.Volumes = []Volume{{Name: "data", Type: VolumeTypeEmptyDir, MountPath: "/tmp"}}
+	template, err := newPodTemplateSpec(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{Name: "data"})
+	_, err = setVolumes(&template, opts, false)
+	assertErrorContains(t, err, "volume name 'data' is reserved")
+
+	// 未开启 volumemount 时 data 同样保留
+	opts.Volumes = []Volume{{Name: "data", Type: VolumeTypePVC, MountPath: "/data", StorageSize: "1Gi"}}
+	template, _ = newPodTemplateSpec(opts)
+	_, err = setVolumes(&template, opts, false)
+	assertErrorContains(t, err, "volume name 'data' is reserved")
+
+	opts.Volumes = []Volume{{Name: "hostpath-0", Type: VolumeTypeEmptyDir, MountPath: "/tmp"}}
+	template, _ = newPodTemplateSpec(opts)
+	if err := setHostPathVolumes(&template, []string{"/var/log:/host/log"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = setVolumes(&template, opts, false)
+	assertErrorContains(t, err, "volume name 'hostpath-0' is reserved")
+}